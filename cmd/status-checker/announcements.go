@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Severities of announcements.
+const (
+	severityInfo     = "info"
+	severityWarning  = "warning"
+	severityCritical = "critical"
+)
+
+var knownSeverities = []string{severityInfo, severityWarning, severityCritical}
+
+// Announcement is a message posted by the operators, it is part of the
+// public status payload between Start and End. Without Start it is shown
+// right away, without End until it is deleted.
+type Announcement struct {
+	Id       string    `json:"id"`
+	Title    string    `json:"title"`
+	Body     string    `json:"body,omitempty"`
+	Severity string    `json:"severity"`
+	Start    time.Time `json:"start,omitzero"`
+	End      time.Time `json:"end,omitzero"`
+}
+
+func (a Announcement) active(now time.Time) bool {
+	return !now.Before(a.Start) && (a.End.IsZero() || now.Before(a.End))
+}
+
+func (a *Announcement) validate() error {
+	if a.Title == "" {
+		return fmt.Errorf("announcement without title")
+	}
+	if a.Severity == "" {
+		a.Severity = severityInfo
+	}
+	if !slices.Contains(knownSeverities, a.Severity) {
+		return fmt.Errorf("unknown severity %q, use %s", a.Severity, strings.Join(knownSeverities, ", "))
+	}
+	if !a.End.IsZero() && !a.End.After(a.Start) {
+		return fmt.Errorf("end has to be after start")
+	}
+	return nil
+}
+
+// activeAnnouncements returns the announcements to show at now.
+func activeAnnouncements(now time.Time) []Announcement {
+	management.mu.Lock()
+	defer management.mu.Unlock()
+
+	active := []Announcement{}
+	for _, announcement := range management.state.Announcements {
+		if announcement.active(now) {
+			active = append(active, announcement)
+		}
+	}
+	return active
+}
+
+func handleListAnnouncements(w http.ResponseWriter, r *http.Request) {
+	management.mu.Lock()
+	defer management.mu.Unlock()
+	writeJSON(w, http.StatusOK, management.state.Announcements)
+}
+
+func handleCreateAnnouncement(w http.ResponseWriter, r *http.Request) {
+	var announcement Announcement
+	if !decodeJSON(w, r, &announcement) {
+		return
+	}
+	if err := announcement.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	announcement.Id = randomHex(8)
+
+	management.mu.Lock()
+	defer management.mu.Unlock()
+
+	management.state.Announcements = slices.DeleteFunc(management.state.Announcements, func(a Announcement) bool {
+		return !a.End.IsZero() && time.Now().After(a.End)
+	})
+	management.state.Announcements = append(management.state.Announcements, announcement)
+	management.commit(r, "announcement.create", announcement.Id, nil, announcement)
+	writeJSON(w, http.StatusCreated, announcement)
+}
+
+func handleUpdateAnnouncement(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	var announcement Announcement
+	if !decodeJSON(w, r, &announcement) {
+		return
+	}
+	if err := announcement.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	announcement.Id = id
+
+	management.mu.Lock()
+	defer management.mu.Unlock()
+
+	i := slices.IndexFunc(management.state.Announcements, func(a Announcement) bool { return a.Id == id })
+	if i < 0 {
+		http.Error(w, "unknown announcement", http.StatusNotFound)
+		return
+	}
+	before := management.state.Announcements[i]
+	management.state.Announcements[i] = announcement
+	management.commit(r, "announcement.update", id, before, announcement)
+	writeJSON(w, http.StatusOK, announcement)
+}
+
+func handleDeleteAnnouncement(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	management.mu.Lock()
+	defer management.mu.Unlock()
+
+	i := slices.IndexFunc(management.state.Announcements, func(a Announcement) bool { return a.Id == id })
+	if i < 0 {
+		http.Error(w, "unknown announcement", http.StatusNotFound)
+		return
+	}
+	before := management.state.Announcements[i]
+	management.state.Announcements = slices.Delete(management.state.Announcements, i, i+1)
+	management.commit(r, "announcement.delete", id, before, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Defaults of LatencyAnomaly.
+const (
+	defaultAnomalySigma        = 3
+	defaultAnomalyRounds       = 3
+	defaultAnomalyWindow       = 100
+	defaultAnomalyMinDeviation = 50 // milliseconds
+	// anomalyWarmup is the number of checks a baseline needs before
+	// deviations from it are flagged.
+	anomalyWarmup = 30
+)
+
+// LatencyAnomaly flags healthy targets as degraded while their response
+// times are well above their rolling baseline. A target is degraded once
+// Rounds consecutive checks were Sigma standard deviations and at least
+// MinDeviation milliseconds above the baseline, and no longer once Rounds
+// consecutive checks weren't. The baseline is an exponentially weighted
+// mean and variance over about Window checks. If Notify is set, the start
+// and end of anomalies are sent to the webhooks.
+type LatencyAnomaly struct {
+	Sigma        float64 `json:"sigma,omitempty"`
+	Rounds       int     `json:"rounds,omitempty"`
+	Window       int     `json:"window,omitempty"`
+	MinDeviation int     `json:"minDeviation,omitempty"`
+	Notify       bool    `json:"notify,omitempty"`
+}
+
+func (a LatencyAnomaly) validate() error {
+	if a.Sigma < 0 || a.Rounds < 0 || a.Window < 0 || a.MinDeviation < 0 {
+		return fmt.Errorf("latencyAnomaly settings can't be negative")
+	}
+	return nil
+}
+
+func (a LatencyAnomaly) sigma() float64 {
+	if a.Sigma == 0 {
+		return defaultAnomalySigma
+	}
+	return a.Sigma
+}
+
+func (a LatencyAnomaly) rounds() int {
+	if a.Rounds == 0 {
+		return defaultAnomalyRounds
+	}
+	return a.Rounds
+}
+
+func (a LatencyAnomaly) window() int {
+	if a.Window == 0 {
+		return defaultAnomalyWindow
+	}
+	return a.Window
+}
+
+func (a LatencyAnomaly) minDeviation() float64 {
+	if a.MinDeviation == 0 {
+		return defaultAnomalyMinDeviation
+	}
+	return float64(a.MinDeviation)
+}
+
+// latencyBaseline is the rolling baseline of the response times of a target
+// in milliseconds.
+type latencyBaseline struct {
+	mean     float64
+	variance float64
+	samples  int
+	// anomalous and normal count the consecutive checks above and within
+	// the threshold
+	anomalous int
+	normal    int
+	degraded  bool
+	// latest is the response time of the latest check, expected the
+	// baseline mean before it
+	latest   float64
+	expected float64
+}
+
+var (
+	anomalyMu sync.Mutex
+	baselines = make(map[string]*latencyBaseline)
+)
+
+// observeAnomaly adds the result of a check to the baseline of the target.
+// Failed checks reset the anomaly, the target is down instead. Anomalous
+// response times are left out of the baseline until the target is degraded,
+// so single outliers don't hide a slowdown while a lasting one becomes the
+// new baseline.
+func observeAnomaly(item string, state StatusState, settings *LatencyAnomaly) {
+	anomalyMu.Lock()
+	defer anomalyMu.Unlock()
+	if settings == nil {
+		delete(baselines, item)
+		return
+	}
+	b, ok := baselines[item]
+	if !ok {
+		b = &latencyBaseline{}
+		baselines[item] = b
+	}
+	if !state.Healthy || state.ResponseCode == 0 {
+		b.anomalous, b.normal, b.degraded = 0, 0, false
+		return
+	}
+
+	ms := float64(state.ResponseTime) / float64(time.Millisecond)
+	b.latest, b.expected = ms, b.mean
+	if b.samples >= anomalyWarmup {
+		deviation := ms - b.mean
+		if deviation > settings.sigma()*math.Sqrt(b.variance) && deviation >= settings.minDeviation() {
+			b.anomalous++
+			b.normal = 0
+			b.degraded = b.degraded || b.anomalous >= settings.rounds()
+			if !b.degraded {
+				return
+			}
+		} else {
+			b.normal++
+			b.anomalous = 0
+			b.degraded = b.degraded && b.normal < settings.rounds()
+		}
+	}
+
+	if b.samples == 0 {
+		b.mean = ms
+	} else {
+		alpha := 2 / float64(settings.window()+1)
+		diff := ms - b.mean
+		b.mean += alpha * diff
+		b.variance = (1 - alpha) * (b.variance + alpha*diff*diff)
+	}
+	b.samples++
+}
+
+// isDegraded reports whether the target has a latency anomaly.
+func isDegraded(item string) bool {
+	anomalyMu.Lock()
+	defer anomalyMu.Unlock()
+	b, ok := baselines[item]
+	return ok && b.degraded
+}
+
+// snapshotDegraded returns the degraded targets so the start and end of
+// anomalies can be detected after the next check round.
+func snapshotDegraded() map[string]bool {
+	anomalyMu.Lock()
+	defer anomalyMu.Unlock()
+	degraded := make(map[string]bool)
+	for item, b := range baselines {
+		if b.degraded {
+			degraded[item] = true
+		}
+	}
+	return degraded
+}
+
+// detectAnomalies returns the alerts for the anomalies that started or ended
+// since the snapshot, if the config asks for notifications.
+func detectAnomalies(previous map[string]bool) []alert {
+	stateMu.RLock()
+	notify := config.LatencyAnomaly != nil && config.LatencyAnomaly.Notify
+	stateMu.RUnlock()
+	if !notify {
+		return nil
+	}
+
+	now := time.Now()
+	var alerts []alert
+	anomalyMu.Lock()
+	defer anomalyMu.Unlock()
+	for item, b := range baselines {
+		if b.degraded == previous[item] {
+			continue
+		}
+		message := fmt.Sprintf("response time %.0fms is back to normal", b.latest)
+		if b.degraded {
+			message = fmt.Sprintf("response time %.0fms is well above the usual %.0fms", b.latest, b.expected)
+		}
+		alerts = append(alerts, alert{Target: item, Alert: alertLatencyAnomaly, Firing: b.degraded, Message: message, Time: now})
+	}
+	return alerts
+}
@@ -0,0 +1,472 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Silence suppresses notifications for the given targets until it expires.
+// Without targets everything is silenced.
+type Silence struct {
+	Id      string    `json:"id"`
+	Targets []string  `json:"targets,omitempty"`
+	Until   time.Time `json:"until"`
+	Comment string    `json:"comment,omitempty"`
+}
+
+// Maintenance is a planned window in which the targets are expected to be
+// down, notifications are suppressed during it. Without targets the window
+// applies to everything.
+type Maintenance struct {
+	Id      string    `json:"id"`
+	Targets []string  `json:"targets,omitempty"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Comment string    `json:"comment,omitempty"`
+}
+
+func appliesTo(targets []string, target string) bool {
+	return len(targets) == 0 || slices.Contains(targets, target)
+}
+
+// managedState is everything changed through the management API, it is
+// persisted next to the status state.
+type managedState struct {
+	Targets       []Target       `json:"targets"`
+	Silences      []Silence      `json:"silences"`
+	Maintenance   []Maintenance  `json:"maintenance"`
+	Announcements []Announcement `json:"announcements"`
+}
+
+type managementStore struct {
+	mu    sync.Mutex
+	path  string // empty if nothing is persisted
+	state managedState
+	audit *auditLog
+}
+
+var management = &managementStore{
+	state: managedState{Targets: []Target{}, Silences: []Silence{}, Maintenance: []Maintenance{}, Announcements: []Announcement{}},
+	audit: &auditLog{},
+}
+
+// setupManagement loads the managed state and audit log from the data path
+// and adds the managed targets to the config.
+func setupManagement(dataPath string, persist bool) error {
+	if persist {
+		management.path = dataPath + "managed_state.json"
+		management.audit.path = dataPath + "audit.ndjson"
+		if err := os.MkdirAll(dataPath, os.ModePerm); err != nil {
+			return err
+		}
+		if err := management.load(); err != nil {
+			return err
+		}
+		if err := management.audit.load(); err != nil {
+			return err
+		}
+	}
+
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	for _, target := range management.state.Targets {
+		if err := addManagedTarget(target); err != nil {
+			slog.Warn("Skipping managed target", "target", target.Url, "error", err)
+		}
+	}
+	return nil
+}
+
+func (s *managementStore) load() error {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &s.state); err != nil {
+		return err
+	}
+	s.state.Targets, err = transformTargetSecrets(s.state.Targets, secrets.decrypt)
+	return err
+}
+
+// save persists the managed state with the secrets encrypted if a key is
+// configured, the caller has to hold s.mu.
+func (s *managementStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+	stored := s.state
+	var err error
+	stored.Targets, err = transformTargetSecrets(s.state.Targets, secrets.encrypt)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// muted reports whether notifications about the target are suppressed by a
+// silence or maintenance window.
+func (s *managementStore) muted(target string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, silence := range s.state.Silences {
+		if now.Before(silence.Until) && appliesTo(silence.Targets, target) {
+			return true
+		}
+	}
+	return s.maintenanceRunning(target, now)
+}
+
+// inMaintenance reports whether a maintenance window of the target is
+// running.
+func (s *managementStore) inMaintenance(target string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.maintenanceRunning(target, now)
+}
+
+// maintenanceRunning is inMaintenance for callers holding s.mu.
+func (s *managementStore) maintenanceRunning(target string, now time.Time) bool {
+	for _, maintenance := range s.state.Maintenance {
+		if !now.Before(maintenance.Start) && now.Before(maintenance.End) && appliesTo(maintenance.Targets, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// publicMaintenance returns the active and upcoming maintenance windows by
+// start time with the targets that aren't public on the status page of
+// namespace removed. Windows without targets are only on the main page.
+func publicMaintenance(now time.Time, namespace string) []Maintenance {
+	management.mu.Lock()
+	windows := slices.Clone(management.state.Maintenance)
+	management.mu.Unlock()
+
+	stateMu.RLock()
+	defer stateMu.RUnlock()
+	public := []Maintenance{}
+	for _, maintenance := range windows {
+		if !now.Before(maintenance.End) {
+			continue
+		}
+		if len(maintenance.Targets) > 0 {
+			maintenance.Targets = slices.DeleteFunc(slices.Clone(maintenance.Targets), func(target string) bool { return !isPublicIn(target, namespace) })
+			if len(maintenance.Targets) == 0 {
+				continue
+			}
+		} else if namespace != "" {
+			continue
+		}
+		public = append(public, maintenance)
+	}
+	slices.SortFunc(public, func(a, b Maintenance) int { return a.Start.Compare(b.Start) })
+	return public
+}
+
+var errTargetNotAllowed = errors.New("target not allowed")
+
+// addManagedTarget adds a target of the management API to the running config
+// if apiTargetPolicy allows it, the caller has to hold stateMu.
+func addManagedTarget(target Target) error {
+	parsed, err := url.Parse(target.Url)
+	if err != nil {
+		return err
+	}
+	if err := apiTargetPolicy.checkUrl(parsed); err != nil {
+		return fmt.Errorf("%w: %w", errTargetNotAllowed, err)
+	}
+	// the ping is requested after every check, so it is restricted the same
+	if target.PingUrl != "" {
+		parsed, err := url.Parse(target.PingUrl)
+		if err != nil {
+			return err
+		}
+		if err := apiTargetPolicy.checkUrl(parsed); err != nil {
+			return fmt.Errorf("%w: pingUrl: %w", errTargetNotAllowed, err)
+		}
+	}
+	target.managed = true
+
+	changed := config
+	changed.Targets = append(slices.Clone(config.Targets), target)
+	if err := changed.validate(); err != nil {
+		return err
+	}
+	setConfig(changed)
+	statusState[target.Url] = StatusState{Healthy: true}
+	return nil
+}
+
+// removeTarget removes a target from the running config, the caller has to
+// hold stateMu.
+func removeTarget(url string) error {
+	changed := config
+	changed.Targets = slices.DeleteFunc(slices.Clone(config.Targets), func(t Target) bool { return t.Url == url })
+	if err := changed.validate(); err != nil {
+		return err
+	}
+	setConfig(changed)
+	delete(statusState, url)
+	return nil
+}
+
+// actorKey is the context key of the identity of the API client, which is
+// recorded in the audit log.
+type actorKey struct{}
+
+func requestActor(r *http.Request) string {
+	actor, _ := r.Context().Value(actorKey{}).(string)
+	return actor
+}
+
+// registerManagement adds the management API to mux, every route requires a
+// token with the matching scope and a client from the allowed ranges.
+func registerManagement(mux *http.ServeMux, tokens []apiToken, allowed []netip.Prefix) {
+	protected := func(scope string, handler http.HandlerFunc) http.Handler {
+		return allowFrom(allowed, requireScope(tokens, scope, handler))
+	}
+
+	mux.Handle("GET /api/targets", protected(scopeRead, handleListTargets))
+	mux.Handle("POST /api/targets", protected(scopeManageTargets, handleCreateTarget))
+	mux.Handle("DELETE /api/targets/{target}", protected(scopeManageTargets, handleDeleteTarget))
+	mux.Handle("GET /api/silences", protected(scopeRead, handleListSilences))
+	mux.Handle("POST /api/silences", protected(scopeSilence, handleCreateSilence))
+	mux.Handle("DELETE /api/silences/{id}", protected(scopeSilence, handleDeleteSilence))
+	mux.Handle("GET /api/maintenance", protected(scopeRead, handleListMaintenance))
+	mux.Handle("POST /api/maintenance", protected(scopeSilence, handleCreateMaintenance))
+	mux.Handle("DELETE /api/maintenance/{id}", protected(scopeSilence, handleDeleteMaintenance))
+	mux.Handle("GET /api/announcements", protected(scopeRead, handleListAnnouncements))
+	mux.Handle("POST /api/announcements", protected(scopeAnnounce, instanceOnly(handleCreateAnnouncement)))
+	mux.Handle("PUT /api/announcements/{id}", protected(scopeAnnounce, instanceOnly(handleUpdateAnnouncement)))
+	mux.Handle("DELETE /api/announcements/{id}", protected(scopeAnnounce, instanceOnly(handleDeleteAnnouncement)))
+	mux.Handle("POST /api/results/{target}", protected(scopeReport, handleReportResult))
+	mux.Handle("GET /api/audit", protected(scopeAdmin, instanceOnly(handleAudit)))
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func decodeJSON(w http.ResponseWriter, r *http.Request, value any) bool {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(value); err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func handleListTargets(w http.ResponseWriter, r *http.Request) {
+	stateMu.RLock()
+	targets := make([]Target, 0, len(config.Targets))
+	for _, target := range config.Targets {
+		if targetsAllowed(r, []string{target.Url}) {
+			targets = append(targets, redactTarget(target))
+		}
+	}
+	stateMu.RUnlock()
+	writeJSON(w, http.StatusOK, targets)
+}
+
+func handleCreateTarget(w http.ResponseWriter, r *http.Request) {
+	var target Target
+	if !decodeJSON(w, r, &target) {
+		return
+	}
+	if namespace := tokenNamespace(r); namespace != "" {
+		if target.Namespace != "" && target.Namespace != namespace {
+			http.Error(w, fmt.Sprintf("tokens of namespace %q can only add targets to it", namespace), http.StatusForbidden)
+			return
+		}
+		target.Namespace = namespace
+	}
+
+	management.mu.Lock()
+	defer management.mu.Unlock()
+
+	stateMu.Lock()
+	err := addManagedTarget(target)
+	stateMu.Unlock()
+	if errors.Is(err, errTargetNotAllowed) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	management.state.Targets = append(management.state.Targets, target)
+	management.commit(r, "target.create", target.Url, nil, redactTarget(target))
+	writeJSON(w, http.StatusCreated, redactTarget(target))
+}
+
+func handleDeleteTarget(w http.ResponseWriter, r *http.Request) {
+	url := r.PathValue("target")
+	if !allowTargets(w, r, []string{url}) {
+		return
+	}
+
+	management.mu.Lock()
+	defer management.mu.Unlock()
+
+	i := slices.IndexFunc(management.state.Targets, func(t Target) bool { return t.Url == url })
+	if i < 0 {
+		http.Error(w, fmt.Sprintf("%q is not a target added through the API", url), http.StatusNotFound)
+		return
+	}
+
+	stateMu.Lock()
+	err := removeTarget(url)
+	stateMu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	before := management.state.Targets[i]
+	management.state.Targets = slices.Delete(management.state.Targets, i, i+1)
+	management.commit(r, "target.delete", url, redactTarget(before), nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handleListSilences(w http.ResponseWriter, r *http.Request) {
+	management.mu.Lock()
+	defer management.mu.Unlock()
+	stateMu.RLock()
+	defer stateMu.RUnlock()
+	silences := slices.DeleteFunc(slices.Clone(management.state.Silences), func(s Silence) bool { return !targetsAllowed(r, s.Targets) })
+	writeJSON(w, http.StatusOK, silences)
+}
+
+func handleCreateSilence(w http.ResponseWriter, r *http.Request) {
+	var silence Silence
+	if !decodeJSON(w, r, &silence) {
+		return
+	}
+	if !silence.Until.After(time.Now()) {
+		http.Error(w, "until has to be in the future", http.StatusBadRequest)
+		return
+	}
+	if !allowTargets(w, r, silence.Targets) {
+		return
+	}
+	silence.Id = randomHex(8)
+
+	management.mu.Lock()
+	defer management.mu.Unlock()
+
+	// expired silences have no effect anymore
+	management.state.Silences = slices.DeleteFunc(management.state.Silences, func(s Silence) bool { return time.Now().After(s.Until) })
+	management.state.Silences = append(management.state.Silences, silence)
+	management.commit(r, "silence.create", silence.Id, nil, silence)
+	writeJSON(w, http.StatusCreated, silence)
+}
+
+func handleDeleteSilence(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	management.mu.Lock()
+	defer management.mu.Unlock()
+
+	i := slices.IndexFunc(management.state.Silences, func(s Silence) bool { return s.Id == id })
+	if i < 0 {
+		http.Error(w, "unknown silence", http.StatusNotFound)
+		return
+	}
+	if !allowTargets(w, r, management.state.Silences[i].Targets) {
+		return
+	}
+	before := management.state.Silences[i]
+	management.state.Silences = slices.Delete(management.state.Silences, i, i+1)
+	management.commit(r, "silence.delete", id, before, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handleListMaintenance(w http.ResponseWriter, r *http.Request) {
+	management.mu.Lock()
+	defer management.mu.Unlock()
+	stateMu.RLock()
+	defer stateMu.RUnlock()
+	windows := slices.DeleteFunc(slices.Clone(management.state.Maintenance), func(m Maintenance) bool { return !targetsAllowed(r, m.Targets) })
+	writeJSON(w, http.StatusOK, windows)
+}
+
+func handleCreateMaintenance(w http.ResponseWriter, r *http.Request) {
+	var maintenance Maintenance
+	if !decodeJSON(w, r, &maintenance) {
+		return
+	}
+	if !maintenance.End.After(maintenance.Start) {
+		http.Error(w, "end has to be after start", http.StatusBadRequest)
+		return
+	}
+	if !allowTargets(w, r, maintenance.Targets) {
+		return
+	}
+	maintenance.Id = randomHex(8)
+
+	management.mu.Lock()
+	defer management.mu.Unlock()
+
+	management.state.Maintenance = slices.DeleteFunc(management.state.Maintenance, func(m Maintenance) bool { return time.Now().After(m.End) })
+	management.state.Maintenance = append(management.state.Maintenance, maintenance)
+	management.commit(r, "maintenance.create", maintenance.Id, nil, maintenance)
+	if subscriptions != nil {
+		subscriptions.notifyMaintenance(maintenance)
+	}
+	writeJSON(w, http.StatusCreated, maintenance)
+}
+
+func handleDeleteMaintenance(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	management.mu.Lock()
+	defer management.mu.Unlock()
+
+	i := slices.IndexFunc(management.state.Maintenance, func(m Maintenance) bool { return m.Id == id })
+	if i < 0 {
+		http.Error(w, "unknown maintenance window", http.StatusNotFound)
+		return
+	}
+	if !allowTargets(w, r, management.state.Maintenance[i].Targets) {
+		return
+	}
+	before := management.state.Maintenance[i]
+	management.state.Maintenance = slices.Delete(management.state.Maintenance, i, i+1)
+	management.commit(r, "maintenance.delete", id, before, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// commit persists the managed state and records the change in the audit
+// log, the caller has to hold s.mu. Errors are logged as the change is
+// already applied.
+func (s *managementStore) commit(r *http.Request, action string, object string, before any, after any) {
+	if err := s.save(); err != nil {
+		slog.Error("Error saving managed state", "error", err)
+	}
+	s.audit.record(r, action, object, before, after)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// auditMemoryLimit is the number of entries kept in memory for /api/audit,
+// the audit file keeps all of them.
+const auditMemoryLimit = 10000
+
+// auditEntry records a single change made through the management API.
+// Before is empty for created and After for deleted objects.
+type auditEntry struct {
+	Time   time.Time       `json:"time"`
+	Actor  string          `json:"actor"`
+	Remote string          `json:"remote"`
+	Action string          `json:"action"`
+	Object string          `json:"object"`
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+// auditLog appends entries to an NDJSON file, if path is set, and keeps the
+// latest ones in memory.
+type auditLog struct {
+	mu      sync.Mutex
+	path    string
+	entries []auditEntry
+}
+
+func (l *auditLog) load() error {
+	file, err := os.Open(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 4<<20)
+	for scanner.Scan() {
+		var entry auditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return err
+		}
+		l.append(entry)
+	}
+	return scanner.Err()
+}
+
+// append adds an entry to the in-memory log, the caller has to hold l.mu.
+func (l *auditLog) append(entry auditEntry) {
+	l.entries = append(l.entries, entry)
+	if len(l.entries) > auditMemoryLimit {
+		l.entries = l.entries[len(l.entries)-auditMemoryLimit:]
+	}
+}
+
+func (l *auditLog) record(r *http.Request, action string, object string, before any, after any) {
+	entry := auditEntry{
+		Time:   time.Now(),
+		Actor:  requestActor(r),
+		Remote: r.RemoteAddr,
+		Action: action,
+		Object: object,
+		Before: auditValue(before),
+		After:  auditValue(after),
+	}
+	slog.Info("Audit", "actor", entry.Actor, "action", action, "object", object)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.append(entry)
+
+	if l.path == "" {
+		return
+	}
+	line, err := json.Marshal(entry)
+	if err == nil {
+		err = appendLine(l.path, line)
+	}
+	if err != nil {
+		slog.Error("Error writing audit log", "error", err)
+	}
+}
+
+func auditValue(value any) json.RawMessage {
+	if value == nil {
+		return nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+func appendLine(path string, line []byte) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// handleAudit returns the latest entries of the audit log, oldest first. The
+// number of entries is limited by the limit query parameter, 100 by default.
+func handleAudit(w http.ResponseWriter, r *http.Request) {
+	limit := 100
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	management.audit.mu.Lock()
+	entries := management.audit.entries
+	if len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	entries = append([]auditEntry{}, entries...)
+	management.audit.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, entries)
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+)
+
+// requestToken returns the token sent as bearer token or as basic auth
+// password, the latter allows tools like go tool pprof to pass it in the URL.
+func requestToken(r *http.Request) string {
+	if _, password, ok := r.BasicAuth(); ok {
+		return password
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return token
+	}
+	return ""
+}
+
+func tokenMatches(expected string, actual string) bool {
+	return expected != "" && subtle.ConstantTimeCompare([]byte(expected), []byte(actual)) == 1
+}
+
+// requireToken only passes requests with the given token to next.
+func requireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !tokenMatches(token, requestToken(r)) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="status-checker"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Scopes of API tokens. Every scope allows reading targets, silences,
+// maintenance windows and announcements, the audit log requires admin and
+// /probe the probe scope.
+const (
+	scopeRead          = "read"
+	scopeSilence       = "silence"
+	scopeManageTargets = "manage-targets"
+	scopeAnnounce      = "announce"
+	scopeReport        = "report"
+	scopeProbe         = "probe"
+	scopeAdmin         = "admin"
+)
+
+var knownScopes = []string{scopeRead, scopeSilence, scopeManageTargets, scopeAnnounce, scopeReport, scopeProbe, scopeAdmin}
+
+// apiToken grants the client presenting it the scopes, its name identifies
+// the client in the audit log. A token with a namespace only acts on the
+// targets of that namespace.
+type apiToken struct {
+	Name      string   `json:"name"`
+	Token     string   `json:"token"`
+	Scopes    []string `json:"scopes"`
+	Namespace string   `json:"namespace,omitempty"`
+}
+
+func (t apiToken) allows(scope string) bool {
+	return scope == scopeRead || slices.Contains(t.Scopes, scope) || slices.Contains(t.Scopes, scopeAdmin)
+}
+
+// readAPITokens reads a JSON array of apiToken from path.
+func readAPITokens(path string) ([]apiToken, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tokens []apiToken
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	names := make(map[string]bool)
+	for _, token := range tokens {
+		if token.Name == "" || token.Token == "" {
+			return nil, fmt.Errorf("%s: every token needs a name and a token", path)
+		}
+		if names[token.Name] {
+			return nil, fmt.Errorf("%s: duplicate token name %q", path, token.Name)
+		}
+		names[token.Name] = true
+		for _, scope := range token.Scopes {
+			if !slices.Contains(knownScopes, scope) {
+				return nil, fmt.Errorf("%s: unknown scope %q of token %q, use %s", path, scope, token.Name, strings.Join(knownScopes, ", "))
+			}
+		}
+	}
+	return tokens, nil
+}
+
+// matchingToken returns the token sent with the request.
+func matchingToken(tokens []apiToken, r *http.Request) (apiToken, bool) {
+	return findToken(tokens, requestToken(r))
+}
+
+// findToken returns the token matching actual. All tokens are compared so
+// the time taken doesn't reveal which one matched.
+func findToken(tokens []apiToken, actual string) (apiToken, bool) {
+	var matched apiToken
+	found := false
+	for _, token := range tokens {
+		if tokenMatches(token.Token, actual) && !found {
+			matched, found = token, true
+		}
+	}
+	return matched, found
+}
+
+// requireScope only passes requests with a token allowing scope to next.
+func requireScope(tokens []apiToken, scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := matchingToken(tokens, r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="status-checker"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !token.allows(scope) {
+			http.Error(w, fmt.Sprintf("token %q lacks the %s scope", token.Name, scope), http.StatusForbidden)
+			return
+		}
+		ctx := context.WithValue(r.Context(), actorKey{}, token.Name)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, namespaceKey{}, token.Namespace)))
+	})
+}
+
+// parseAllowlist parses a comma separated list of CIDR ranges, single
+// addresses are allowed as well.
+func parseAllowlist(list string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %q", entry)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR range %q", entry)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// allowFrom only passes requests from the allowed ranges to next, all
+// requests pass if the list is empty. The address of the connection is used
+// as forwarding headers could be set by anyone.
+func allowFrom(allowed []netip.Prefix, next http.Handler) http.Handler {
+	if len(allowed) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addrPort, err := netip.ParseAddrPort(r.RemoteAddr)
+		if err == nil {
+			addr := addrPort.Addr().Unmap()
+			for _, prefix := range allowed {
+				if prefix.Contains(addr) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+		}
+		http.Error(w, "forbidden", http.StatusForbidden)
+	})
+}
+
+// pageTokenCookie keeps the link token once the page was opened with it, so
+// the websocket and json requests of the page pass as well.
+const pageTokenCookie = "status_checker_token"
+
+// pageAccess protects the status page with basic auth, a shared link token
+// or both. The token may be given as token query parameter, which sets a
+// cookie, or like the API tokens.
+type pageAccess struct {
+	user     string
+	password string
+	token    string
+}
+
+func (p pageAccess) enabled() bool {
+	return p.password != "" || p.token != ""
+}
+
+func (p pageAccess) allows(w http.ResponseWriter, r *http.Request) bool {
+	if user, password, ok := r.BasicAuth(); ok && p.password != "" {
+		userMatches := subtle.ConstantTimeCompare([]byte(p.user), []byte(user)) == 1
+		if tokenMatches(p.password, password) && userMatches {
+			return true
+		}
+	}
+	if p.token == "" {
+		return false
+	}
+
+	if tokenMatches(p.token, r.URL.Query().Get("token")) {
+		http.SetCookie(w, &http.Cookie{
+			Name:     pageTokenCookie,
+			Value:    p.token,
+			Path:     "/",
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+		return true
+	}
+	if cookie, err := r.Cookie(pageTokenCookie); err == nil && tokenMatches(p.token, cookie.Value) {
+		return true
+	}
+	return tokenMatches(p.token, requestToken(r))
+}
+
+// requirePageAccess only passes requests allowed by p to next, all requests
+// pass if p is not enabled.
+func requirePageAccess(p pageAccess, next http.Handler) http.Handler {
+	if !p.enabled() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !p.allows(w, r) {
+			if p.password != "" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="status-checker"`)
+			}
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestApiTokenAllows(t *testing.T) {
+	tests := []struct {
+		scopes  []string
+		scope   string
+		allowed bool
+	}{
+		{nil, scopeRead, true},
+		{nil, scopeSilence, false},
+		{[]string{scopeSilence}, scopeSilence, true},
+		{[]string{scopeSilence}, scopeManageTargets, false},
+		{[]string{scopeReport}, scopeRead, true},
+		{[]string{scopeAnnounce, scopeReport}, scopeReport, true},
+		{[]string{scopeProbe}, scopeProbe, true},
+		{[]string{scopeProbe}, scopeManageTargets, false},
+		{[]string{scopeAdmin}, scopeManageTargets, true},
+		{[]string{scopeAdmin}, scopeAdmin, true},
+		{[]string{scopeManageTargets}, scopeAdmin, false},
+	}
+	for _, test := range tests {
+		token := apiToken{Name: "test", Token: "secret", Scopes: test.scopes}
+		if allowed := token.allows(test.scope); allowed != test.allowed {
+			t.Errorf("token with %v allows %s = %t, want %t", test.scopes, test.scope, allowed, test.allowed)
+		}
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	tokens := []apiToken{
+		{Name: "ci", Token: "ci-secret", Scopes: []string{scopeManageTargets}},
+		{Name: "acme", Token: "acme-secret", Scopes: []string{scopeSilence}, Namespace: "acme"},
+		{Name: "root", Token: "root-secret", Scopes: []string{scopeAdmin}},
+	}
+	var actor, namespace string
+	handler := requireScope(tokens, scopeSilence, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actor, namespace = requestActor(r), tokenNamespace(r)
+	}))
+
+	tests := []struct {
+		name      string
+		bearer    string
+		password  string
+		status    int
+		actor     string
+		namespace string
+	}{
+		{name: "no token", status: http.StatusUnauthorized},
+		{name: "unknown token", bearer: "other", status: http.StatusUnauthorized},
+		{name: "lacking scope", bearer: "ci-secret", status: http.StatusForbidden},
+		{name: "scope", bearer: "acme-secret", status: http.StatusOK, actor: "acme", namespace: "acme"},
+		{name: "admin", bearer: "root-secret", status: http.StatusOK, actor: "root"},
+		{name: "basic auth password", password: "root-secret", status: http.StatusOK, actor: "root"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actor, namespace = "", ""
+			r := httptest.NewRequest(http.MethodPost, "/api/silences", nil)
+			if test.bearer != "" {
+				r.Header.Set("Authorization", "Bearer "+test.bearer)
+			}
+			if test.password != "" {
+				r.SetBasicAuth("user", test.password)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != test.status {
+				t.Fatalf("status = %d, want %d", w.Code, test.status)
+			}
+			if actor != test.actor || namespace != test.namespace {
+				t.Errorf("actor and namespace = %q, %q, want %q, %q", actor, namespace, test.actor, test.namespace)
+			}
+			if test.status == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Errorf("no WWW-Authenticate header")
+			}
+		})
+	}
+}
+
+func TestReadAPITokens(t *testing.T) {
+	tests := []struct {
+		name  string
+		json  string
+		valid bool
+	}{
+		{"valid", `[{"name": "ci", "token": "a", "scopes": ["manage-targets", "report"]}, {"name": "acme", "token": "b", "scopes": ["read"], "namespace": "acme"}]`, true},
+		{"no scopes", `[{"name": "ci", "token": "a"}]`, true},
+		{"missing name", `[{"token": "a", "scopes": ["read"]}]`, false},
+		{"missing token", `[{"name": "ci", "scopes": ["read"]}]`, false},
+		{"duplicate name", `[{"name": "ci", "token": "a"}, {"name": "ci", "token": "b"}]`, false},
+		{"unknown scope", `[{"name": "ci", "token": "a", "scopes": ["write"]}]`, false},
+		{"not an array", `{"name": "ci", "token": "a"}`, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "tokens.json")
+			if err := os.WriteFile(path, []byte(test.json), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := readAPITokens(path); (err == nil) != test.valid {
+				t.Errorf("readAPITokens = %v, want valid %t", err, test.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// checkOutputFormat prints the results of the check command and returns the
+// exit code.
+type checkOutputFormat struct {
+	print func(views []StatusView, a checkArgs) int
+	fail  func(err error) int
+}
+
+var checkOutputFormats = map[string]checkOutputFormat{
+	"table":  {printCheckTable, failCheck},
+	"json":   {printCheckJSON, failCheck},
+	"nagios": {printCheckNagios, failCheckNagios},
+}
+
+func failCheck(err error) int {
+	fmt.Fprintln(os.Stderr, "Error:", err)
+	return checkExitError
+}
+
+func checkExitCode(views []StatusView) int {
+	for _, view := range views {
+		if !view.Healthy {
+			return checkExitUnhealthy
+		}
+	}
+	return checkExitHealthy
+}
+
+func printCheckTable(views []StatusView, a checkArgs) int {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STATUS\tTARGET\tCODE\tTIME")
+	for _, view := range views {
+		status := "UP"
+		if !view.Healthy {
+			status = "DOWN"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%dms\n", status, view.Url, view.ResponseCode, view.ResponseTime)
+	}
+	w.Flush()
+	return checkExitCode(views)
+}
+
+func printCheckJSON(views []StatusView, a checkArgs) int {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if views == nil {
+		views = []StatusView{}
+	}
+	if err := encoder.Encode(views); err != nil {
+		return failCheck(err)
+	}
+	return checkExitCode(views)
+}
+
+// Exit codes of the Nagios plugin API.
+const (
+	nagiosOk       = 0
+	nagiosWarning  = 1
+	nagiosCritical = 2
+	nagiosUnknown  = 3
+)
+
+func failCheckNagios(err error) int {
+	fmt.Printf("STATUS-CHECKER UNKNOWN - %s\n", err)
+	return nagiosUnknown
+}
+
+// printCheckNagios prints a single status line followed by performance data
+// with the response time of every item. Unhealthy items and response times
+// above the critical threshold are CRITICAL, response times above the
+// warning threshold WARNING.
+func printCheckNagios(views []StatusView, a checkArgs) int {
+	var unhealthy, critical, warning []string
+	var perfdata []string
+	for _, view := range views {
+		switch {
+		case !view.Healthy:
+			unhealthy = append(unhealthy, view.Url)
+		case a.critical > 0 && view.ResponseTime > int64(a.critical):
+			critical = append(critical, fmt.Sprintf("%s %dms", view.Url, view.ResponseTime))
+		case a.warning > 0 && view.ResponseTime > int64(a.warning):
+			warning = append(warning, fmt.Sprintf("%s %dms", view.Url, view.ResponseTime))
+		}
+		// labels can't contain quotes or equals signs
+		label := strings.NewReplacer("'", "", "=", "").Replace(view.Url)
+		perfdata = append(perfdata, fmt.Sprintf("'%s'=%dms;%s;%s;0", label, view.ResponseTime, nagiosThreshold(a.warning), nagiosThreshold(a.critical)))
+	}
+
+	status, exitCode := "OK", nagiosOk
+	summary := fmt.Sprintf("%d of %d healthy", len(views)-len(unhealthy), len(views))
+	switch {
+	case len(unhealthy) > 0 || len(critical) > 0:
+		status, exitCode = "CRITICAL", nagiosCritical
+	case len(warning) > 0:
+		status, exitCode = "WARNING", nagiosWarning
+	}
+	if len(unhealthy) > 0 {
+		summary += ", unhealthy: " + strings.Join(unhealthy, ", ")
+	}
+	if len(critical)+len(warning) > 0 {
+		summary += ", slow: " + strings.Join(append(critical, warning...), ", ")
+	}
+
+	fmt.Printf("STATUS-CHECKER %s - %s | %s\n", status, summary, strings.Join(perfdata, " "))
+	return exitCode
+}
+
+func nagiosThreshold(milliseconds int) string {
+	if milliseconds <= 0 {
+		return ""
+	}
+	return strconv.Itoa(milliseconds)
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"slices"
+	"time"
+)
+
+// Build metadata, set at build time via
+// -ldflags "-X main.version=... -X main.commit=... -X main.buildDate=...".
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildDate = "unknown"
+)
+
+type versionInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"buildDate"`
+	GoVersion string `json:"goVersion"`
+}
+
+func currentVersionInfo() versionInfo {
+	return versionInfo{
+		Version:   version,
+		Commit:    commit,
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+	}
+}
+
+func handleVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(currentVersionInfo())
+}
+
+// Exit codes of the check command.
+const (
+	checkExitHealthy   = 0
+	checkExitUnhealthy = 1
+	checkExitError     = 2
+)
+
+// runCheck runs the checks once and exits with checkExitHealthy if all
+// checked items are healthy, checkExitUnhealthy if at least one isn't and
+// checkExitError if the checks couldn't be run at all. The nagios output
+// uses the exit codes of the Nagios plugin API instead.
+type checkArgs struct {
+	configPath    string
+	checkTimeout  int
+	maxPerHost    int
+	maxConcurrent int
+	all           bool
+	output        string
+	logLevel      string
+	logFormat     string
+
+	// response time thresholds in milliseconds of the nagios output
+	warning  int
+	critical int
+}
+
+func newCheckFlagSet(a *checkArgs) *flag.FlagSet {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s check [flags] [target|composite ...|--all]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	addConfigFlags(fs, &a.configPath)
+	addCheckFlags(fs, &a.checkTimeout, &a.maxPerHost, &a.maxConcurrent)
+	fs.BoolVar(&a.all, "all", false, "check all targets and composites (default if no target is given)")
+	fs.StringVar(&a.output, "output", "table", "output format: table, json or nagios (default table)")
+	fs.StringVar(&a.output, "o", "table", "output format: table, json or nagios (default table) (shorthand)")
+	fs.IntVar(&a.warning, "warning", 0, "response time in milliseconds above which the nagios output is WARNING (default 0, disabled)")
+	fs.IntVar(&a.critical, "critical", 0, "response time in milliseconds above which the nagios output is CRITICAL (default 0, disabled)")
+	fs.StringVar(&a.logLevel, "log-level", "error", "minimum level of logged messages: debug, info, warn or error (default error)")
+	fs.StringVar(&a.logFormat, "log-format", "text", "format of log lines: text or json (default text)")
+	return fs
+}
+
+func runCheck(arguments []string) int {
+	var a checkArgs
+	fs := newCheckFlagSet(&a)
+	parseFlags(fs, arguments)
+
+	if err := setupLogging(a.logLevel, a.logFormat, ""); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return checkExitError
+	}
+
+	format, ok := checkOutputFormats[a.output]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: unknown output format %q\n", a.output)
+		return checkExitError
+	}
+
+	if a.all && fs.NArg() > 0 {
+		return format.fail(fmt.Errorf("--all can't be combined with targets"))
+	}
+
+	parsed, err := readConfig(a.configPath)
+	if err != nil {
+		return format.fail(err)
+	}
+
+	selected, err := parsed.selectItems(fs.Args())
+	if err != nil {
+		return format.fail(err)
+	}
+	applyConfig(selected)
+
+	configureChecks(a.checkTimeout, a.maxPerHost, a.maxConcurrent)
+	updateStatusState(context.Background())
+
+	var views []StatusView
+	for _, view := range StatusStatesToView() {
+		if len(fs.Args()) > 0 && !slices.Contains(fs.Args(), view.Url) {
+			// only a member of a selected composite
+			continue
+		}
+		views = append(views, view)
+	}
+	// pings of the targets are still pending
+	ctx, cancel := context.WithTimeout(context.Background(), pingClient.Timeout)
+	defer cancel()
+	waitForNotifications(ctx)
+	return format.print(views, a)
+}
+
+func newValidateFlagSet(configPath *string) *flag.FlagSet {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	addConfigFlags(fs, configPath)
+	return fs
+}
+
+func runValidate(arguments []string) int {
+	var configPath string
+	parseFlags(newValidateFlagSet(&configPath), arguments)
+
+	parsed, err := readConfig(configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+
+	fmt.Printf("%s is valid: %d targets, %d composites\n", configPath, len(parsed.Targets), len(parsed.Composites))
+	return 0
+}
+
+func newMigrateConfigFlagSet(configPath *string, outputPath *string, from *string) *flag.FlagSet {
+	fs := flag.NewFlagSet("migrate-config", flag.ExitOnError)
+	addConfigFlags(fs, configPath)
+	fs.StringVar(from, "from", "status-checker", "format of the config: status-checker or uptime-kuma for an Uptime Kuma backup (default status-checker)")
+	fs.StringVar(outputPath, "output", "", "path to write the migrated config to (default stdout)")
+	fs.StringVar(outputPath, "o", "", "path to write the migrated config to (default stdout) (shorthand)")
+	return fs
+}
+
+func runMigrateConfig(arguments []string) int {
+	var (
+		configPath string
+		outputPath string
+		from       string
+	)
+	parseFlags(newMigrateConfigFlagSet(&configPath, &outputPath, &from), arguments)
+
+	var parsed Config
+	var err error
+	switch from {
+	case "status-checker":
+		parsed, err = readConfig(configPath)
+	case "uptime-kuma":
+		parsed, err = readUptimeKumaBackup(configPath)
+	default:
+		err = fmt.Errorf("unknown format %q, use status-checker or uptime-kuma", from)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+
+	migrated, err := json.MarshalIndent(parsed, "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	migrated = append(migrated, '\n')
+
+	if outputPath == "" {
+		os.Stdout.Write(migrated)
+		return 0
+	}
+
+	if err := os.WriteFile(outputPath, migrated, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	return 0
+}
+
+// readUptimeKumaBackup converts the backup and prints what couldn't be
+// converted.
+func readUptimeKumaBackup(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	converted, warnings, err := convertUptimeKuma(data)
+	for _, warning := range warnings {
+		fmt.Fprintln(os.Stderr, "Warning:", warning)
+	}
+	return converted, err
+}
+
+func newVersionFlagSet() *flag.FlagSet {
+	return flag.NewFlagSet("version", flag.ExitOnError)
+}
+
+func runVersion(arguments []string) int {
+	parseFlags(newVersionFlagSet(), arguments)
+
+	info := currentVersionInfo()
+	fmt.Printf("status-checker %s (commit %s, built %s, %s)\n", info.Version, info.Commit, info.BuildDate, info.GoVersion)
+	return 0
+}
+
+type healthcheckArgs struct {
+	listen   string
+	url      string
+	timeout  int
+	https    bool
+	insecure bool
+}
+
+func newHealthcheckFlagSet(a *healthcheckArgs) *flag.FlagSet {
+	fs := flag.NewFlagSet("healthcheck", flag.ExitOnError)
+	fs.StringVar(&a.listen, "listen", ":8081", "address the local instance serves on (default :8081)")
+	fs.StringVar(&a.listen, "l", ":8081", "address the local instance serves on (default :8081) (shorthand)")
+	fs.StringVar(&a.url, "url", "", "url of the health endpoint, overrides --listen (default http://localhost:8081/healthz)")
+	fs.IntVar(&a.timeout, "timeout", 5, "timeout in seconds (default 5)")
+	fs.BoolVar(&a.https, "tls", false, "use HTTPS for --listen, for instances started with --tls-cert (default false)")
+	fs.BoolVar(&a.insecure, "insecure", false, "don't verify the certificate, e.g. a self-signed one (default false)")
+	return fs
+}
+
+// runHealthcheck queries /healthz of a running instance and exits with 0 if
+// it is healthy and 1 otherwise, as expected by a container HEALTHCHECK.
+func runHealthcheck(arguments []string) int {
+	var a healthcheckArgs
+	parseFlags(newHealthcheckFlagSet(&a), arguments)
+
+	url := a.url
+	if url == "" {
+		url = healthzUrl(a.listen, a.https)
+	}
+
+	client := &http.Client{Timeout: time.Duration(a.timeout) * time.Second}
+	if a.insecure {
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	}
+	resp, err := client.Get(url)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	defer resp.Body.Close()
+
+	var health healthzResponse
+	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+		health.Status = resp.Status
+	}
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintln(os.Stderr, health.Status)
+		for _, problem := range health.Problems {
+			fmt.Fprintln(os.Stderr, "  "+problem)
+		}
+		return 1
+	}
+	fmt.Println(health.Status)
+	return 0
+}
+
+// healthzUrl returns the url of /healthz for a listen address, wildcard
+// addresses are reached via localhost.
+func healthzUrl(listen string, https bool) string {
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		host, port = listen, "80"
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "localhost"
+	}
+	scheme := "http://"
+	if https {
+		scheme = "https://"
+	}
+	return scheme + net.JoinHostPort(host, port) + "/healthz"
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// completeTargetsCommand lists the targets and composites of the config, the
+// completion scripts call it to complete target names.
+const completeTargetsCommand = "__complete-targets"
+
+// targetCommands take target or composite names as arguments.
+var targetCommands = []string{"check"}
+
+func newCompletionFlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("completion", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s completion <bash|zsh|fish>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+func runCompletion(arguments []string) int {
+	fs := newCompletionFlagSet()
+	parseFlags(fs, arguments)
+
+	generators := map[string]func() string{
+		"bash": bashCompletion,
+		"zsh":  zshCompletion,
+		"fish": fishCompletion,
+	}
+	if fs.NArg() != 1 || generators[fs.Arg(0)] == nil {
+		fs.Usage()
+		return 2
+	}
+
+	fmt.Print(generators[fs.Arg(0)]())
+	return 0
+}
+
+func runCompleteTargets(arguments []string) int {
+	var configPath string
+	parseFlags(newValidateFlagSet(&configPath), arguments)
+
+	parsed, err := readConfig(configPath)
+	if err != nil {
+		return 1
+	}
+	for _, target := range parsed.Targets {
+		fmt.Println(target.Url)
+	}
+	for _, composite := range parsed.Composites {
+		fmt.Println(composite.Name)
+	}
+	return 0
+}
+
+func visibleCommands() []command {
+	var visible []command
+	for _, cmd := range commands {
+		if !cmd.hidden {
+			visible = append(visible, cmd)
+		}
+	}
+	return visible
+}
+
+func commandNames() string {
+	var names []string
+	for _, cmd := range visibleCommands() {
+		names = append(names, cmd.name)
+	}
+	return strings.Join(names, " ")
+}
+
+// flagNames returns the flags of a command the way they are usually typed,
+// --name for long flags and -n for shorthands.
+func flagNames(cmd command) []string {
+	var names []string
+	cmd.flags().VisitAll(func(f *flag.Flag) {
+		if len(f.Name) == 1 {
+			names = append(names, "-"+f.Name)
+		} else {
+			names = append(names, "--"+f.Name)
+		}
+	})
+	return names
+}
+
+func bashCompletion() string {
+	var b strings.Builder
+	b.WriteString(`# bash completion for status-checker, load with
+#   source <(status-checker completion bash)
+_status_checker() {
+    local cur cmd config i
+    cur="${COMP_WORDS[COMP_CWORD]}"
+    if declare -F _get_comp_words_by_ref >/dev/null; then
+        _get_comp_words_by_ref -n : cur
+    fi
+
+    if [[ $COMP_CWORD -eq 1 && "$cur" != -* ]]; then
+        COMPREPLY=($(compgen -W "` + commandNames() + `" -- "$cur"))
+        return
+    fi
+
+    cmd="${COMP_WORDS[1]}"
+    [[ "$cmd" == -* ]] && cmd=serve
+
+    for ((i = 1; i < COMP_CWORD; i++)); do
+        case "${COMP_WORDS[i]}" in
+            -c|-config|--config) config="${COMP_WORDS[i+1]}" ;;
+        esac
+    done
+
+    if [[ "$cur" == -* ]]; then
+        case "$cmd" in
+`)
+	for _, cmd := range visibleCommands() {
+		fmt.Fprintf(&b, "            %s) COMPREPLY=($(compgen -W \"%s\" -- \"$cur\")) ;;\n", cmd.name, strings.Join(flagNames(cmd), " "))
+	}
+	b.WriteString(`        esac
+        return
+    fi
+
+    case "$cmd" in
+        ` + strings.Join(targetCommands, "|") + `)
+            COMPREPLY=($(compgen -W "$(status-checker ` + completeTargetsCommand + ` ${config:+-c "$config"} 2>/dev/null)" -- "$cur"))
+            if declare -F __ltrim_colon_completions >/dev/null; then
+                __ltrim_colon_completions "$cur"
+            fi
+            ;;
+    esac
+}
+complete -o default -F _status_checker status-checker
+`)
+	return b.String()
+}
+
+func zshCompletion() string {
+	var b strings.Builder
+	b.WriteString(`#compdef status-checker
+# zsh completion for status-checker, load with
+#   source <(status-checker completion zsh)
+_status_checker() {
+    local -a commands
+    commands=(
+`)
+	for _, cmd := range visibleCommands() {
+		fmt.Fprintf(&b, "        '%s:%s'\n", cmd.name, zshEscape(cmd.description))
+	}
+	b.WriteString(`    )
+
+    if (( CURRENT == 2 )) && [[ $PREFIX != -* ]]; then
+        _describe 'command' commands
+        return
+    fi
+
+    local cmd=$words[2]
+    [[ $cmd == -* ]] && cmd=serve
+
+    if [[ $PREFIX == -* ]]; then
+        case $cmd in
+`)
+	for _, cmd := range visibleCommands() {
+		fmt.Fprintf(&b, "            %s) compadd -- %s ;;\n", cmd.name, strings.Join(flagNames(cmd), " "))
+	}
+	b.WriteString(`        esac
+        return
+    fi
+
+    case $cmd in
+        ` + strings.Join(targetCommands, "|") + `)
+            local config idx=${words[(I)(-c|-config|--config)]}
+            (( idx )) && config=$words[idx+1]
+            compadd -- ${(f)"$(status-checker ` + completeTargetsCommand + ` ${config:+-c $config} 2>/dev/null)"}
+            ;;
+        *)
+            _files
+            ;;
+    esac
+}
+compdef _status_checker status-checker
+`)
+	return b.String()
+}
+
+func zshEscape(s string) string {
+	return strings.NewReplacer("'", "'\\''", ":", "\\:").Replace(s)
+}
+
+func fishCompletion() string {
+	var b strings.Builder
+	b.WriteString(`# fish completion for status-checker, load with
+#   status-checker completion fish | source
+complete -c status-checker -f
+`)
+	for _, cmd := range visibleCommands() {
+		fmt.Fprintf(&b, "complete -c status-checker -n '__fish_use_subcommand' -a %s -d '%s'\n", cmd.name, fishEscape(cmd.description))
+	}
+	for _, cmd := range visibleCommands() {
+		condition := "__fish_seen_subcommand_from " + cmd.name
+		if cmd.name == "serve" {
+			// serve is the default command, so its flags work without it
+			condition = "__fish_use_subcommand; or " + condition
+		}
+		cmd.flags().VisitAll(func(f *flag.Flag) {
+			option := "-l " + f.Name
+			if len(f.Name) == 1 {
+				option = "-s " + f.Name
+			}
+			fmt.Fprintf(&b, "complete -c status-checker -n '%s' %s -r -d '%s'\n", condition, option, fishEscape(f.Usage))
+		})
+	}
+	for _, name := range targetCommands {
+		fmt.Fprintf(&b, "complete -c status-checker -n '__fish_seen_subcommand_from %s' -a '(status-checker %s 2>/dev/null)'\n", name, completeTargetsCommand)
+	}
+	return b.String()
+}
+
+func fishEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s)
+}
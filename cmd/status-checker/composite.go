@@ -0,0 +1,52 @@
+package main
+
+import (
+	"time"
+)
+
+// updateCompositeStates recomputes the state of all composites from the
+// current state of their members. Composites are evaluated in config order so
+// a composite may use earlier composites as members. The caller has to hold
+// stateMu.
+func updateCompositeStates() {
+	for _, composite := range config.Composites {
+		healthyMembers := 0
+		var responseTime time.Duration
+		for _, member := range composite.Members {
+			state := statusState[member]
+			if state.Healthy {
+				healthyMembers++
+			}
+			// the composite is only as fast as its slowest member
+			responseTime = max(responseTime, state.ResponseTime)
+		}
+
+		required := composite.MinHealthy
+		if required <= 0 {
+			required = len(composite.Members)
+		}
+
+		previous := statusState[composite.Name]
+		state := StatusState{
+			Healthy:       healthyMembers >= required,
+			LastHealthy:   previous.LastHealthy,
+			LastUnhealthy: previous.LastUnhealthy,
+			ResponseTime:  responseTime,
+		}
+		if state.Healthy {
+			state.LastHealthy = time.Now()
+		} else {
+			state.LastUnhealthy = time.Now()
+		}
+		statusState[composite.Name] = state
+	}
+}
+
+// compositeMembers returns the members of the composite with the given name or
+// nil if there is no such composite. The caller has to hold stateMu.
+func compositeMembers(name string) []string {
+	if composite := configItems[name].composite; composite != nil {
+		return composite.Members
+	}
+	return nil
+}
@@ -0,0 +1,578 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+	_ "time/tzdata" // the timezone database may be missing in containers
+)
+
+// Config is the structure of the config file. For backwards compatibility the
+// config file may also be a plain JSON array of target URLs.
+type Config struct {
+	Targets    []Target    `json:"targets"`
+	Composites []Composite `json:"composites,omitempty"`
+	Webhooks   []Webhook   `json:"webhooks,omitempty"`
+
+	// UserAgent and Headers are sent with every check unless overridden by
+	// the target. Headers can be used to identify the checker to a WAF.
+	UserAgent string            `json:"userAgent,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+
+	// Http3 is the HTTP/3 mode of the https targets that don't set their
+	// own, auto or always, HTTP/3 isn't used if not set.
+	Http3 string `json:"http3,omitempty"`
+
+	// LatencyBuckets are the upper bounds in seconds of the response time
+	// histograms, defaultLatencyBuckets if not set.
+	LatencyBuckets []float64 `json:"latencyBuckets,omitempty"`
+
+	Page PageConfig `json:"page,omitzero"`
+
+	// Timezone is the IANA name of the timezone of the timestamps in the
+	// status payload, UTC if not set.
+	Timezone string `json:"timezone,omitempty"`
+
+	// MajorOutageShare is the share of the weight of all items that has to
+	// be unhealthy for a major outage, defaultMajorOutageShare if not set.
+	MajorOutageShare float64 `json:"majorOutageShare,omitempty"`
+
+	// ProbeModules are the modules of /probe, the built-in http_2xx can be
+	// overridden.
+	ProbeModules map[string]ProbeModule `json:"probeModules,omitempty"`
+
+	// PingUrl is requested after every check round so a dead man's switch
+	// notices if the checker stops.
+	PingUrl string `json:"pingUrl,omitempty"`
+
+	Statuspage *Statuspage `json:"statuspage,omitempty"`
+	SnmpTraps  []SnmpTrap  `json:"snmpTraps,omitempty"`
+	EventBuses []EventBus  `json:"eventBuses,omitempty"`
+	Zabbix     *Zabbix     `json:"zabbix,omitempty"`
+	Syslog     *Syslog     `json:"syslog,omitempty"`
+
+	Namespaces []Namespace `json:"namespaces,omitempty"`
+
+	LatencyAnomaly *LatencyAnomaly `json:"latencyAnomaly,omitempty"`
+}
+
+// Target is a single URL that is checked periodically. In the config file a
+// target may be given either as an object or as a plain URL string.
+type Target struct {
+	Url string `json:"url"`
+
+	// Name, Description and Group are shown on the status page instead of
+	// the bare URL.
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	Group       string `json:"group,omitempty"`
+
+	// Public false keeps the target off the status page and everything
+	// derived from it, it is still checked and notified about.
+	Public *bool `json:"public,omitempty"`
+
+	// Weight is the share of the target in the overall status, 1 if not
+	// set. If a Critical target is down it is a major outage.
+	Weight   *float64 `json:"weight,omitempty"`
+	Critical bool     `json:"critical,omitempty"`
+
+	// PingUrl is requested after every check, with /fail appended if the
+	// check failed, e.g. a check URL of healthchecks.io.
+	PingUrl string `json:"pingUrl,omitempty"`
+
+	// Passive targets are not checked, their results are reported to
+	// /api/results/{target} and Url only has to be unique. A passive target
+	// turns unhealthy if no result arrived for ResultTimeout seconds.
+	Passive       bool `json:"passive,omitempty"`
+	ResultTimeout int  `json:"resultTimeout,omitempty"`
+
+	// Provider makes the target reflect a third party status feed at Url.
+	Provider *ProviderStatus `json:"provider,omitempty"`
+
+	// Simulate replaces the checks of the target with synthetic results.
+	Simulate *Simulation `json:"simulate,omitempty"`
+
+	// Slo alerts the webhooks when the error budget of the target is burned
+	// too fast.
+	Slo *SLO `json:"slo,omitempty"`
+
+	// Namespace is the name of the namespace the target belongs to, empty
+	// for the main status page.
+	Namespace string `json:"namespace,omitempty"`
+
+	// Metadata is passed through to the status page as is, e.g. links,
+	// owners or icons for the frontend.
+	Metadata map[string]any `json:"metadata,omitempty"`
+
+	UserAgent string            `json:"userAgent,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+
+	// Http3 auto checks the target over HTTP/3 once it offered it with
+	// Alt-Svc, always only over HTTP/3. HTTP/3 isn't proxied.
+	Http3 string `json:"http3,omitempty"`
+
+	// managed targets were added through the management API and are
+	// checked with the apiTargetPolicy applied
+	managed bool
+	// headers are the requestHeaders of the target, set from the config
+	// under stateMu before it is checked as the config may be reloaded
+	// during the check
+	headers http.Header
+}
+
+// Composite is a service-level item whose health is computed from the health
+// of its members. Members reference targets by URL or earlier composites by
+// name. If MinHealthy is not set, all members have to be healthy.
+type Composite struct {
+	Name       string   `json:"name"`
+	Members    []string `json:"members"`
+	MinHealthy int      `json:"minHealthy,omitempty"`
+
+	Description string `json:"description,omitempty"`
+	Group       string `json:"group,omitempty"`
+	Public      *bool  `json:"public,omitempty"`
+
+	Weight   *float64 `json:"weight,omitempty"`
+	Critical bool     `json:"critical,omitempty"`
+
+	// Namespace is the namespace of the composite, its members have to be
+	// in the same one.
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// readConfig reads, parses and validates the config file.
+func readConfig(configPath string) (Config, error) {
+	var parsed Config
+
+	configBytes, err := os.ReadFile(configPath)
+	if err != nil {
+		return parsed, err
+	}
+
+	if err := json.Unmarshal(configBytes, &parsed); err != nil {
+		return parsed, fmt.Errorf("parsing config: %w", err)
+	}
+
+	if err := parsed.validate(); err != nil {
+		return parsed, fmt.Errorf("validating config: %w", err)
+	}
+
+	return parsed, nil
+}
+
+func (c *Config) UnmarshalJSON(data []byte) error {
+	var targets []Target
+	if err := json.Unmarshal(data, &targets); err == nil {
+		c.Targets = targets
+		return nil
+	}
+
+	type plainConfig Config
+	return json.Unmarshal(data, (*plainConfig)(c))
+}
+
+func (t *Target) UnmarshalJSON(data []byte) error {
+	var url string
+	if err := json.Unmarshal(data, &url); err == nil {
+		t.Url = url
+		return nil
+	}
+
+	type plainTarget Target
+	return json.Unmarshal(data, (*plainTarget)(t))
+}
+
+// requestHeaders returns the headers to send when checking the target. Target
+// headers take precedence over the global ones.
+func (c Config) requestHeaders(target Target) http.Header {
+	header := make(http.Header)
+	for name, value := range c.Headers {
+		header.Set(name, value)
+	}
+	for name, value := range target.Headers {
+		header.Set(name, value)
+	}
+
+	userAgent := "status-checker/" + version
+	if c.UserAgent != "" {
+		userAgent = c.UserAgent
+	}
+	if target.UserAgent != "" {
+		userAgent = target.UserAgent
+	}
+	header.Set("User-Agent", userAgent)
+
+	return header
+}
+
+// http3Mode returns the HTTP/3 mode to check the target with, the one of the
+// config for https targets that don't set one.
+func (c Config) http3Mode(target Target) string {
+	if target.Http3 != "" {
+		return target.Http3
+	}
+	if strings.HasPrefix(strings.ToLower(target.Url), "https://") {
+		return c.Http3
+	}
+	return ""
+}
+
+func (c Config) location() (*time.Location, error) {
+	if c.Timezone == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(c.Timezone)
+}
+
+// configItem is the target or the composite of an item of config.
+type configItem struct {
+	target    *Target
+	composite *Composite
+}
+
+// configItems indexes the targets of config by URL and the composites by
+// name, so the lookups for every item of a round don't search the config.
+// It is guarded by stateMu too and only changed by setConfig.
+var configItems = make(map[string]configItem)
+
+// setConfig makes c the current config, the caller has to hold stateMu.
+func setConfig(c Config) {
+	config = c
+	configItems = make(map[string]configItem, len(c.Targets)+len(c.Composites))
+	for i := range c.Composites {
+		configItems[c.Composites[i].Name] = configItem{composite: &c.Composites[i]}
+	}
+	// a target takes precedence over a composite of the same name
+	for i := range c.Targets {
+		configItems[c.Targets[i].Url] = configItem{target: &c.Targets[i]}
+	}
+}
+
+// configTarget returns the target with the url, the caller has to hold
+// stateMu.
+func configTarget(url string) (Target, bool) {
+	if target := configItems[url].target; target != nil {
+		return *target, true
+	}
+	return Target{}, false
+}
+
+// describeItem returns the name, description and group of a target or
+// composite for the status page. Composites are named by config. The caller
+// has to hold stateMu.
+func describeItem(item string) (name string, description string, group string) {
+	switch i := configItems[item]; {
+	case i.target != nil:
+		return i.target.Name, i.target.Description, i.target.Group
+	case i.composite != nil:
+		return i.composite.Name, i.composite.Description, i.composite.Group
+	}
+	return "", "", ""
+}
+
+// itemMetadata returns the metadata of a target, the caller has to hold
+// stateMu.
+func itemMetadata(item string) map[string]any {
+	if target := configItems[item].target; target != nil {
+		return target.Metadata
+	}
+	return nil
+}
+
+// isPublic reports whether the target or composite is shown on the main
+// status page, the caller has to hold stateMu.
+func isPublic(item string) bool {
+	return isPublicIn(item, "")
+}
+
+// isPublicIn reports whether the target or composite is shown on the status
+// page of namespace, the caller has to hold stateMu. Items that aren't in the
+// config, like the watchdog or removed targets, aren't public.
+func isPublicIn(item string, namespace string) bool {
+	switch i := configItems[item]; {
+	case i.target != nil:
+		return i.target.Namespace == namespace && (i.target.Public == nil || *i.target.Public)
+	case i.composite != nil:
+		return i.composite.Namespace == namespace && (i.composite.Public == nil || *i.composite.Public)
+	}
+	return false
+}
+
+// publicViews removes the items that aren't public on the main status page
+// and the members of composites that aren't.
+func publicViews(views []StatusView) []StatusView {
+	return publicViewsIn(views, "")
+}
+
+// publicViewsIn is publicViews for the status page of namespace.
+func publicViewsIn(views []StatusView, namespace string) []StatusView {
+	stateMu.RLock()
+	defer stateMu.RUnlock()
+
+	public := make([]StatusView, 0, len(views))
+	for _, view := range views {
+		if !isPublicIn(view.Url, namespace) {
+			continue
+		}
+		public = append(public, publicMembersIn(view, namespace))
+	}
+	return public
+}
+
+// publicMembersIn removes the members of a composite that aren't public on
+// the status page of namespace, the caller has to hold stateMu.
+func publicMembersIn(view StatusView, namespace string) StatusView {
+	if view.Members != nil {
+		view.Members = slices.DeleteFunc(slices.Clone(view.Members), func(member string) bool { return !isPublicIn(member, namespace) })
+	}
+	return view
+}
+
+// selectItems returns a config that only contains the given targets and
+// composites and everything needed to compute them. Without names the config
+// is returned unchanged.
+func (c Config) selectItems(names []string) (Config, error) {
+	if len(names) == 0 {
+		return c, nil
+	}
+
+	needed := make(map[string]bool)
+	var require func(name string) error
+	require = func(name string) error {
+		if needed[name] {
+			return nil
+		}
+		for _, target := range c.Targets {
+			if target.Url == name {
+				needed[name] = true
+				return nil
+			}
+		}
+		for _, composite := range c.Composites {
+			if composite.Name == name {
+				needed[name] = true
+				for _, member := range composite.Members {
+					if err := require(member); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+		}
+		return fmt.Errorf("unknown target or composite %q", name)
+	}
+
+	for _, name := range names {
+		if err := require(name); err != nil {
+			return c, err
+		}
+	}
+
+	selected := c
+	selected.Targets = nil
+	selected.Composites = nil
+	for _, target := range c.Targets {
+		if needed[target.Url] {
+			selected.Targets = append(selected.Targets, target)
+		}
+	}
+	for _, composite := range c.Composites {
+		if needed[composite.Name] {
+			selected.Composites = append(selected.Composites, composite)
+		}
+	}
+	return selected, nil
+}
+
+// validate checks the config for inconsistencies that would make checks or
+// composites misbehave.
+func (c Config) validate() error {
+	if c.Http3 != "" && !slices.Contains(http3Modes, c.Http3) {
+		return fmt.Errorf("unknown http3 mode %q, use %s", c.Http3, strings.Join(http3Modes, " or "))
+	}
+	namespaces := make(map[string]bool)
+	for _, namespace := range c.Namespaces {
+		if err := namespace.validate(); err != nil {
+			return err
+		}
+		if namespaces[namespace.Name] {
+			return fmt.Errorf("duplicate namespace %q", namespace.Name)
+		}
+		namespaces[namespace.Name] = true
+	}
+
+	known := make(map[string]bool)
+	// namespaceOf are the namespaces of the known items
+	namespaceOf := make(map[string]string)
+	for _, target := range c.Targets {
+		if target.Url == "" {
+			return fmt.Errorf("target without url")
+		}
+		if known[target.Url] {
+			return fmt.Errorf("duplicate target %q", target.Url)
+		}
+		known[target.Url] = true
+		if target.Namespace != "" && !namespaces[target.Namespace] {
+			return fmt.Errorf("target %q is in unknown namespace %q", target.Url, target.Namespace)
+		}
+		namespaceOf[target.Url] = target.Namespace
+		if target.ResultTimeout < 0 {
+			return fmt.Errorf("target %q has a negative resultTimeout", target.Url)
+		}
+		if target.ResultTimeout > 0 && !target.Passive {
+			return fmt.Errorf("target %q has a resultTimeout but is not passive", target.Url)
+		}
+		if target.Provider != nil {
+			if target.Passive {
+				return fmt.Errorf("passive target %q can't have a provider", target.Url)
+			}
+			if err := target.Provider.validate(); err != nil {
+				return fmt.Errorf("target %q: %w", target.Url, err)
+			}
+		}
+		if target.Simulate != nil {
+			if target.Passive {
+				return fmt.Errorf("passive target %q can't be simulated", target.Url)
+			}
+			if err := target.Simulate.validate(); err != nil {
+				return fmt.Errorf("target %q: %w", target.Url, err)
+			}
+		}
+		if target.Slo != nil {
+			if err := target.Slo.validate(); err != nil {
+				return fmt.Errorf("target %q: %w", target.Url, err)
+			}
+		}
+		if target.Http3 != "" && !slices.Contains(http3Modes, target.Http3) {
+			return fmt.Errorf("target %q has the unknown http3 mode %q, use %s", target.Url, target.Http3, strings.Join(http3Modes, " or "))
+		}
+		if target.Http3 == http3Always && !strings.HasPrefix(strings.ToLower(target.Url), "https://") {
+			return fmt.Errorf("target %q can only always use HTTP/3 with an https url", target.Url)
+		}
+	}
+
+	for _, composite := range c.Composites {
+		if composite.Name == "" {
+			return fmt.Errorf("composite without name")
+		}
+		if known[composite.Name] {
+			return fmt.Errorf("composite %q clashes with an existing target or composite", composite.Name)
+		}
+		if len(composite.Members) == 0 {
+			return fmt.Errorf("composite %q has no members", composite.Name)
+		}
+		if composite.Namespace != "" && !namespaces[composite.Namespace] {
+			return fmt.Errorf("composite %q is in unknown namespace %q", composite.Name, composite.Namespace)
+		}
+		for _, member := range composite.Members {
+			if !known[member] {
+				return fmt.Errorf("composite %q references unknown member %q", composite.Name, member)
+			}
+			if namespaceOf[member] != composite.Namespace {
+				return fmt.Errorf("member %q of composite %q is in another namespace", member, composite.Name)
+			}
+		}
+		if composite.MinHealthy > len(composite.Members) {
+			return fmt.Errorf("composite %q requires %d healthy members but only has %d", composite.Name, composite.MinHealthy, len(composite.Members))
+		}
+		known[composite.Name] = true
+		namespaceOf[composite.Name] = composite.Namespace
+	}
+
+	for _, webhook := range c.Webhooks {
+		if webhook.Url == "" {
+			return fmt.Errorf("webhook without url")
+		}
+	}
+
+	if c.Statuspage != nil {
+		if err := c.Statuspage.validate(); err != nil {
+			return err
+		}
+		for item := range c.Statuspage.Components {
+			if !known[item] {
+				return fmt.Errorf("statuspage component of unknown target or composite %q", item)
+			}
+		}
+	}
+
+	for _, trap := range c.SnmpTraps {
+		if err := trap.validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.Zabbix != nil {
+		if err := c.Zabbix.validate(); err != nil {
+			return err
+		}
+		for item := range c.Zabbix.Hosts {
+			if !known[item] {
+				return fmt.Errorf("zabbix host of unknown target or composite %q", item)
+			}
+		}
+	}
+
+	if c.Syslog != nil {
+		if err := c.Syslog.validate(); err != nil {
+			return err
+		}
+	}
+
+	for _, bus := range c.EventBuses {
+		if err := bus.validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.LatencyAnomaly != nil {
+		if err := c.LatencyAnomaly.validate(); err != nil {
+			return err
+		}
+	}
+
+	for i, bound := range c.LatencyBuckets {
+		if bound <= 0 || (i > 0 && bound <= c.LatencyBuckets[i-1]) {
+			return fmt.Errorf("latencyBuckets have to be positive and increasing")
+		}
+	}
+
+	if err := c.Page.validate(); err != nil {
+		return err
+	}
+
+	for _, target := range c.Targets {
+		if target.Weight != nil && *target.Weight < 0 {
+			return fmt.Errorf("target %q has a negative weight", target.Url)
+		}
+	}
+	for _, composite := range c.Composites {
+		if composite.Weight != nil && *composite.Weight < 0 {
+			return fmt.Errorf("composite %q has a negative weight", composite.Name)
+		}
+	}
+	if c.MajorOutageShare < 0 || c.MajorOutageShare > 1 {
+		return fmt.Errorf("majorOutageShare has to be between 0 and 1")
+	}
+
+	for name, module := range c.ProbeModules {
+		if module.Timeout < 0 {
+			return fmt.Errorf("probe module %q has a negative timeout", name)
+		}
+		for _, code := range module.ValidStatusCodes {
+			if code < 100 || code > 599 {
+				return fmt.Errorf("probe module %q has the invalid status code %d", name, code)
+			}
+		}
+	}
+
+	if _, err := c.location(); err != nil {
+		return fmt.Errorf("invalid timezone: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,44 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+func processRunning(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// daemonize starts the checker again in a new session with the given serve
+// arguments and output written to logPath, then exits the current process.
+func daemonize(arguments []string, logPath string) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+
+	cmd := exec.Command(executable, append([]string{"serve"}, withoutDaemonFlag(arguments)...)...)
+	cmd.Env = append(os.Environ(), daemonizedEnv+"=1")
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Started daemon with pid %d, logging to %s\n", cmd.Process.Pid, logPath)
+	os.Exit(0)
+	return nil
+}
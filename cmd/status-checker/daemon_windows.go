@@ -0,0 +1,22 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func processRunning(pid int) bool {
+	// on Windows FindProcess fails if there is no such process
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	process.Release()
+	return true
+}
+
+func daemonize(arguments []string, logPath string) error {
+	return fmt.Errorf("daemon mode isn't supported on Windows, use the service command instead")
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// envPrefix is prepended to the flag name to get its environment variable,
+// e.g. STATUS_CHECKER_CONFIG for --config of serve. The flags of the other
+// commands have the command in their name too, e.g. STATUS_CHECKER_CHECK_OUTPUT
+// for --output of check, as the same flag means something else per command.
+const envPrefix = "STATUS_CHECKER_"
+
+func envName(command, flagName string) string {
+	name := flagName
+	if command != "serve" {
+		name = command + "_" + flagName
+	}
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// serveEnvFlags are the flags of other commands that mean the same as the
+// serve flag, they fall back to its environment variable. This keeps e.g. the
+// container HEALTHCHECK working with STATUS_CHECKER_LISTEN.
+var serveEnvFlags = map[string][]string{
+	"healthcheck": {"listen"},
+}
+
+// parseFlags sets flags from their environment variables and then parses the
+// arguments, so flags on the command line take precedence. Shorthand flags
+// have no environment variable of their own.
+func parseFlags(fs *flag.FlagSet, arguments []string) {
+	fs.VisitAll(func(f *flag.Flag) {
+		if len(f.Name) == 1 {
+			return
+		}
+		name := envName(fs.Name(), f.Name)
+		value, ok := os.LookupEnv(name)
+		if !ok && slices.Contains(serveEnvFlags[fs.Name()], f.Name) {
+			name = envName("serve", f.Name)
+			value, ok = os.LookupEnv(name)
+		}
+		if !ok {
+			return
+		}
+		if err := fs.Set(f.Name, value); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid value %q for %s: %s\n", value, name, err)
+			os.Exit(2)
+		}
+	})
+
+	fs.Parse(arguments)
+}
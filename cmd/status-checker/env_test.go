@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestEnvName(t *testing.T) {
+	tests := []struct {
+		command string
+		flag    string
+		name    string
+	}{
+		{"serve", "config", "STATUS_CHECKER_CONFIG"},
+		{"serve", "log-format", "STATUS_CHECKER_LOG_FORMAT"},
+		{"check", "output", "STATUS_CHECKER_CHECK_OUTPUT"},
+		{"migrate-config", "output", "STATUS_CHECKER_MIGRATE_CONFIG_OUTPUT"},
+		{"healthcheck", "timeout", "STATUS_CHECKER_HEALTHCHECK_TIMEOUT"},
+	}
+	for _, test := range tests {
+		if name := envName(test.command, test.flag); name != test.name {
+			t.Errorf("envName(%q, %q) = %q, want %q", test.command, test.flag, name, test.name)
+		}
+	}
+}
+
+func TestParseFlagsEnv(t *testing.T) {
+	// the variables of serve don't leak into the flags of other commands
+	t.Setenv("STATUS_CHECKER_TIMEOUT", "60")
+	t.Setenv("STATUS_CHECKER_OUTPUT", "json")
+	t.Setenv("STATUS_CHECKER_MIGRATE_CONFIG_OUTPUT", "migrated.json")
+
+	var healthcheck healthcheckArgs
+	parseFlags(newHealthcheckFlagSet(&healthcheck), nil)
+	if healthcheck.timeout != 5 {
+		t.Errorf("healthcheck timeout = %d, want the default", healthcheck.timeout)
+	}
+	var configPath, outputPath, from string
+	parseFlags(newMigrateConfigFlagSet(&configPath, &outputPath, &from), nil)
+	if outputPath != "migrated.json" {
+		t.Errorf("migrate-config output = %q, want the one of its variable", outputPath)
+	}
+
+	// the healthcheck finds the instance of STATUS_CHECKER_LISTEN, its own
+	// variable and the command line take precedence
+	t.Setenv("STATUS_CHECKER_LISTEN", ":9000")
+	for _, test := range []struct {
+		env       string
+		arguments []string
+		listen    string
+	}{
+		{"", nil, ":9000"},
+		{":9001", nil, ":9001"},
+		{":9001", []string{"--listen", ":9002"}, ":9002"},
+	} {
+		if test.env != "" {
+			t.Setenv("STATUS_CHECKER_HEALTHCHECK_LISTEN", test.env)
+		}
+		var a healthcheckArgs
+		parseFlags(newHealthcheckFlagSet(&a), test.arguments)
+		if a.listen != test.listen {
+			t.Errorf("healthcheck listen with %q and %v = %q, want %q", test.env, test.arguments, a.listen, test.listen)
+		}
+	}
+}
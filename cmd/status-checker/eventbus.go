@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultEventBusSubject = "status-checker.state-changes"
+	eventBusTimeout        = 10 * time.Second
+)
+
+// EventBus publishes every state change as the JSON body of the webhooks to
+// a NATS subject or a Redis pub/sub channel. Url is nats:// or tls:// for
+// NATS and redis:// or rediss:// for Redis, credentials are given as
+// user:password@ or as token@ for NATS token auth.
+type EventBus struct {
+	Url string `json:"url"`
+	// Subject is the NATS subject or Redis channel,
+	// defaultEventBusSubject if not set.
+	Subject string `json:"subject,omitempty"`
+}
+
+func (b EventBus) validate() error {
+	parsed, err := url.Parse(b.Url)
+	if err != nil {
+		return fmt.Errorf("invalid event bus url: %w", err)
+	}
+	switch parsed.Scheme {
+	case "nats", "tls", "redis", "rediss":
+	default:
+		return fmt.Errorf("invalid event bus url %s, use nats://, tls://, redis:// or rediss://", parsed.Redacted())
+	}
+	if parsed.Hostname() == "" {
+		return fmt.Errorf("event bus url %s without host", parsed.Redacted())
+	}
+	if strings.ContainsAny(b.Subject, " \t\r\n") {
+		return fmt.Errorf("event bus subject %q can't contain whitespace", b.Subject)
+	}
+	return nil
+}
+
+type eventBusNotifier struct {
+	bus EventBus
+}
+
+// notify connects for every change as they are rare, a broken connection
+// can't lose the next one.
+func (n eventBusNotifier) notify(change stateChange) error {
+	body, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+	parsed, err := url.Parse(n.bus.Url)
+	if err != nil {
+		return err
+	}
+	subject := n.bus.Subject
+	if subject == "" {
+		subject = defaultEventBusSubject
+	}
+
+	dialer := &net.Dialer{Timeout: eventBusTimeout}
+	var conn net.Conn
+	switch parsed.Scheme {
+	case "rediss":
+		conn, err = tls.DialWithDialer(dialer, "tcp", hostWithDefaultPort(parsed.Host, "6379"), &tls.Config{ServerName: parsed.Hostname()})
+	case "redis":
+		conn, err = dialer.Dial("tcp", hostWithDefaultPort(parsed.Host, "6379"))
+	default:
+		conn, err = dialer.Dial("tcp", hostWithDefaultPort(parsed.Host, "4222"))
+	}
+	if err != nil {
+		return err
+	}
+	defer func() { conn.Close() }()
+	conn.SetDeadline(time.Now().Add(eventBusTimeout))
+
+	if parsed.Scheme == "redis" || parsed.Scheme == "rediss" {
+		return publishRedis(conn, parsed.User, subject, body)
+	}
+	conn, err = publishNats(conn, parsed, subject, body)
+	return err
+}
+
+// publishNats sends the message with the NATS client protocol. The PING
+// after it is answered once the server processed everything before it, so
+// errors aren't missed. The returned connection replaces conn if it was
+// upgraded to TLS.
+func publishNats(conn net.Conn, parsed *url.URL, subject string, body []byte) (net.Conn, error) {
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return conn, fmt.Errorf("reading nats info: %w", err)
+	}
+	infoJson, ok := strings.CutPrefix(strings.TrimSpace(line), "INFO ")
+	if !ok {
+		return conn, fmt.Errorf("expected nats info, got %q", strings.TrimSpace(line))
+	}
+	var info struct {
+		TlsRequired bool `json:"tls_required"`
+	}
+	if err := json.Unmarshal([]byte(infoJson), &info); err != nil {
+		return conn, fmt.Errorf("parsing nats info: %w", err)
+	}
+
+	if parsed.Scheme == "tls" || info.TlsRequired {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: parsed.Hostname()})
+		if err := tlsConn.Handshake(); err != nil {
+			return conn, err
+		}
+		conn = tlsConn
+		reader = bufio.NewReader(conn)
+	}
+
+	options := map[string]any{"verbose": false, "pedantic": false, "name": "status-checker", "lang": "go", "version": version}
+	if parsed.User != nil {
+		if password, ok := parsed.User.Password(); ok {
+			options["user"], options["pass"] = parsed.User.Username(), password
+		} else {
+			options["auth_token"] = parsed.User.Username()
+		}
+	}
+	connect, err := json.Marshal(options)
+	if err != nil {
+		return conn, err
+	}
+
+	var message strings.Builder
+	fmt.Fprintf(&message, "CONNECT %s\r\n", connect)
+	fmt.Fprintf(&message, "PUB %s %d\r\n%s\r\n", subject, len(body), body)
+	message.WriteString("PING\r\n")
+	if _, err := conn.Write([]byte(message.String())); err != nil {
+		return conn, err
+	}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return conn, fmt.Errorf("waiting for nats pong: %w", err)
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PONG":
+			return conn, nil
+		case strings.HasPrefix(line, "-ERR"):
+			return conn, fmt.Errorf("nats: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+}
+
+// redisCommand encodes a command as RESP array of bulk strings.
+func redisCommand(args ...string) string {
+	var command strings.Builder
+	fmt.Fprintf(&command, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&command, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return command.String()
+}
+
+// publishRedis authenticates if the url has credentials and publishes the
+// message, the reply to PUBLISH is the number of receiving subscribers.
+func publishRedis(conn net.Conn, user *url.Userinfo, channel string, body []byte) error {
+	var commands strings.Builder
+	replies := 1
+	if user != nil {
+		password, ok := user.Password()
+		if ok && user.Username() != "" {
+			commands.WriteString(redisCommand("AUTH", user.Username(), password))
+		} else if ok {
+			commands.WriteString(redisCommand("AUTH", password))
+		} else {
+			commands.WriteString(redisCommand("AUTH", user.Username()))
+		}
+		replies++
+	}
+	commands.WriteString(redisCommand("PUBLISH", channel, string(body)))
+	if _, err := conn.Write([]byte(commands.String())); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(conn)
+	for range replies {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("reading redis reply: %w", err)
+		}
+		line = strings.TrimSpace(line)
+		if reply, ok := strings.CutPrefix(line, "-"); ok {
+			return fmt.Errorf("redis: %s", reply)
+		}
+		if count, ok := strings.CutPrefix(line, ":"); ok {
+			if _, err := strconv.Atoi(count); err != nil {
+				return fmt.Errorf("unexpected redis reply %q", line)
+			}
+		}
+	}
+	return nil
+}
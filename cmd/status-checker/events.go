@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Types of the written events.
+const (
+	eventCheck       = "check"
+	eventStateChange = "state_change"
+)
+
+// event is a single NDJSON line of the event stream. Check events carry the
+// result of every check, state change events are written when a target or
+// composite switches between healthy and unhealthy.
+type event struct {
+	Type         string    `json:"type"`
+	Time         time.Time `json:"time"`
+	Target       string    `json:"target"`
+	Healthy      bool      `json:"healthy"`
+	ResponseCode int       `json:"responseCode"`
+	ResponseTime *int64    `json:"responseTime,omitempty"`
+	Error        string    `json:"error,omitempty"`
+}
+
+type eventWriter struct {
+	mu      sync.Mutex
+	output  io.WriteCloser
+	encoder *json.Encoder
+}
+
+// events is nil if no event output is configured.
+var events *eventWriter
+
+// setupEvents writes the events to path, - being stdout.
+func setupEvents(path string) error {
+	if path == "" {
+		return nil
+	}
+
+	output := os.Stdout
+	if path != "-" {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		output = file
+	}
+	events = &eventWriter{output: output, encoder: json.NewEncoder(output)}
+	return nil
+}
+
+func (w *eventWriter) write(e event) {
+	if w == nil {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.encoder.Encode(e); err != nil {
+		slog.Warn("Error writing event", "error", err)
+	}
+}
+
+func (w *eventWriter) writeCheck(update statusUpdate) {
+	if w == nil {
+		return
+	}
+
+	responseTime := update.state.ResponseTime.Milliseconds()
+	e := event{
+		Type:         eventCheck,
+		Time:         time.Now(),
+		Target:       update.item,
+		Healthy:      update.state.Healthy,
+		ResponseCode: update.state.ResponseCode,
+		ResponseTime: &responseTime,
+	}
+	if update.err != nil {
+		e.Error = update.err.Error()
+	}
+	w.write(e)
+}
+
+func (w *eventWriter) writeStateChange(change stateChange) {
+	w.write(event{
+		Type:         eventStateChange,
+		Time:         change.Time,
+		Target:       change.Target,
+		Healthy:      change.Healthy,
+		ResponseCode: change.ResponseCode,
+	})
+}
+
+func (w *eventWriter) close() {
+	if w != nil && w.output != os.Stdout {
+		w.output.Close()
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultLatencyBuckets are the upper bounds in seconds of the latency
+// histograms if the config doesn't set latencyBuckets.
+var defaultLatencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// latencyHistogram counts the response times of a target. counts has one
+// entry more than bounds for the responses slower than the last bound.
+type latencyHistogram struct {
+	Bounds []float64 `json:"bounds"`
+	Counts []uint64  `json:"counts"`
+	Sum    float64   `json:"sum"`
+	Count  uint64    `json:"count"`
+}
+
+var (
+	latencyMu         sync.Mutex
+	latencyHistograms = make(map[string]*latencyHistogram)
+)
+
+func (c Config) latencyBuckets() []float64 {
+	if len(c.LatencyBuckets) > 0 {
+		return c.LatencyBuckets
+	}
+	return defaultLatencyBuckets
+}
+
+// observeLatency adds a response time to the histogram of item, a new
+// histogram has the buckets of the config.
+func observeLatency(item string, latency time.Duration, buckets []float64) {
+	latencyMu.Lock()
+	defer latencyMu.Unlock()
+
+	h, ok := latencyHistograms[item]
+	if !ok {
+		h = &latencyHistogram{Bounds: buckets, Counts: make([]uint64, len(buckets)+1)}
+		latencyHistograms[item] = h
+	}
+
+	seconds := latency.Seconds()
+	h.Counts[sort.SearchFloat64s(h.Bounds, seconds)]++
+	h.Sum += seconds
+	h.Count++
+}
+
+// latencySnapshot returns a copy of the histogram of item, which is safe to
+// use while checks keep running.
+func latencySnapshot(item string) (latencyHistogram, bool) {
+	latencyMu.Lock()
+	defer latencyMu.Unlock()
+
+	h, ok := latencyHistograms[item]
+	if !ok {
+		return latencyHistogram{}, false
+	}
+	snapshot := *h
+	snapshot.Counts = append([]uint64(nil), h.Counts...)
+	return snapshot, true
+}
+
+func latencyMetric(visible func(item string) bool) metric {
+	m := metric{name: "response_time_histogram_seconds", help: "response times of the checks of a target", kind: metricHistogram}
+
+	latencyMu.Lock()
+	items := make([]string, 0, len(latencyHistograms))
+	for item := range latencyHistograms {
+		items = append(items, item)
+	}
+	latencyMu.Unlock()
+	if visible != nil {
+		stateMu.RLock()
+		items = slices.DeleteFunc(items, func(item string) bool { return !visible(item) })
+		stateMu.RUnlock()
+	}
+	sort.Strings(items)
+
+	for _, item := range items {
+		h, _ := latencySnapshot(item)
+		m.histograms = append(m.histograms, histogramSample{labels: []metricLabel{{"target", item}}, histogram: h})
+	}
+	return m
+}
+
+// targetDetail is the response of /api/targets/{target}.
+type targetDetail struct {
+	StatusView
+	Latency *latencyHistogram `json:"latency,omitempty"`
+	Slo     *sloStatus        `json:"slo,omitempty"`
+}
+
+func handleTargetDetail(w http.ResponseWriter, r *http.Request) {
+	item := r.PathValue("target")
+	namespace := r.PathValue("namespace")
+	stateMu.RLock()
+	state, ok := statusState[item]
+	// private items are only known to the management API
+	ok = ok && isPublicIn(item, namespace)
+	var view StatusView
+	var slo *SLO
+	if ok {
+		view = publicMembersIn(state.toStatusView(item), namespace)
+		if target, isTarget := configTarget(item); isTarget {
+			slo = target.Slo
+		}
+	}
+	stateMu.RUnlock()
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown target or composite %q", item), http.StatusNotFound)
+		return
+	}
+
+	detail := targetDetail{StatusView: view}
+	if h, ok := latencySnapshot(item); ok {
+		detail.Latency = &h
+	}
+	if slo != nil {
+		detail.Slo = sloSnapshot(item, *slo, time.Now())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(detail)
+}
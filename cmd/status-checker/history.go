@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultHistorySize keeps an hour of samples at the default interval.
+	defaultHistorySize = 360
+	// historyFlushInterval is how often the recent history is persisted,
+	// it is only needed to survive restarts.
+	historyFlushInterval = 5 * time.Minute
+)
+
+// historySample is the result of one check of a target.
+type historySample struct {
+	Time         time.Time `json:"time"`
+	Healthy      bool      `json:"healthy"`
+	ResponseCode int       `json:"responseCode"`
+	ResponseTime int64     `json:"responseTime"` // milliseconds
+}
+
+// sampleRing keeps the latest samples of a target in a fixed size buffer.
+type sampleRing struct {
+	samples []historySample
+	start   int // index of the oldest sample once the buffer is full
+}
+
+func (r *sampleRing) add(sample historySample, size int) {
+	if len(r.samples) < size {
+		r.samples = append(r.samples, sample)
+		return
+	}
+	r.samples[r.start] = sample
+	r.start = (r.start + 1) % len(r.samples)
+}
+
+// ordered returns a copy of the samples from the oldest to the latest.
+func (r *sampleRing) ordered() []historySample {
+	ordered := make([]historySample, 0, len(r.samples))
+	ordered = append(ordered, r.samples[r.start:]...)
+	return append(ordered, r.samples[:r.start]...)
+}
+
+var (
+	historyMu   sync.Mutex
+	historySize = defaultHistorySize
+	history     = make(map[string]*sampleRing)
+	// lastHistoryFlush is only used by the check loop.
+	lastHistoryFlush = time.Now()
+)
+
+func recordSample(item string, state StatusState, now time.Time) {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	if historySize <= 0 {
+		return
+	}
+
+	ring, ok := history[item]
+	if !ok {
+		ring = &sampleRing{samples: make([]historySample, 0, min(historySize, 64))}
+		history[item] = ring
+	}
+	ring.add(historySample{
+		Time:         now,
+		Healthy:      state.Healthy,
+		ResponseCode: state.ResponseCode,
+		ResponseTime: state.ResponseTime.Milliseconds(),
+	}, historySize)
+}
+
+// recentSamples returns the samples of item since the given time.
+func recentSamples(item string, since time.Time) []historySample {
+	historyMu.Lock()
+	ring, ok := history[item]
+	var samples []historySample
+	if ok {
+		samples = ring.ordered()
+	}
+	historyMu.Unlock()
+
+	first, _ := slices.BinarySearchFunc(samples, since, func(s historySample, t time.Time) int {
+		return s.Time.Compare(t)
+	})
+	return samples[first:]
+}
+
+// saveHistory writes the recent samples to the data path.
+func saveHistory(dataPath string) error {
+	historyMu.Lock()
+	ordered := make(map[string][]historySample, len(history))
+	for item, ring := range history {
+		ordered[item] = ring.ordered()
+	}
+	historyMu.Unlock()
+
+	data, err := json.Marshal(ordered)
+	if err != nil {
+		return err
+	}
+	tmp := dataPath + "history.json.tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dataPath+"history.json")
+}
+
+// loadHistory reads the samples saved by saveHistory, a missing file is not
+// an error. Samples beyond the history size are dropped.
+func loadHistory(dataPath string) error {
+	data, err := os.ReadFile(dataPath + "history.json")
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var saved map[string][]historySample
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	for item, samples := range saved {
+		ring := &sampleRing{}
+		for _, sample := range samples {
+			ring.add(sample, historySize)
+		}
+		if len(ring.samples) > 0 {
+			history[item] = ring
+		}
+	}
+	return nil
+}
+
+// responseTimePercentiles are computed from the recent samples with a
+// response, in milliseconds.
+type responseTimePercentiles struct {
+	P50 int64 `json:"p50"`
+	P90 int64 `json:"p90"`
+	P95 int64 `json:"p95"`
+	P99 int64 `json:"p99"`
+}
+
+func percentiles(samples []historySample) *responseTimePercentiles {
+	var times []int64
+	for _, sample := range samples {
+		if sample.ResponseCode != 0 {
+			times = append(times, sample.ResponseTime)
+		}
+	}
+	if len(times) == 0 {
+		return nil
+	}
+	slices.Sort(times)
+	// nearest rank
+	rank := func(p float64) int64 {
+		return times[int(math.Ceil(p*float64(len(times))))-1]
+	}
+	return &responseTimePercentiles{P50: rank(0.5), P90: rank(0.9), P95: rank(0.95), P99: rank(0.99)}
+}
+
+// historyResponse is the response of /api/history/{target}.
+type historyResponse struct {
+	Samples     []historySample          `json:"samples"`
+	Percentiles *responseTimePercentiles `json:"percentiles,omitempty"`
+}
+
+// handleHistory returns the recent samples of a target, optionally only
+// those since the RFC 3339 time in the since query parameter.
+func handleHistory(w http.ResponseWriter, r *http.Request) {
+	item := r.PathValue("target")
+	stateMu.RLock()
+	_, ok := statusState[item]
+	ok = ok && isPublicIn(item, r.PathValue("namespace"))
+	stateMu.RUnlock()
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown target or composite %q", item), http.StatusNotFound)
+		return
+	}
+
+	var since time.Time
+	if value := r.URL.Query().Get("since"); value != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339, value); err != nil {
+			http.Error(w, "since has to be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+	}
+	samples := recentSamples(item, since)
+	if samples == nil {
+		samples = []historySample{}
+	}
+	writeJSON(w, http.StatusOK, historyResponse{Samples: samples, Percentiles: percentiles(samples)})
+}
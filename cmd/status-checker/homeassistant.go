@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"regexp"
+)
+
+// homeAssistantIdPattern matches the characters not allowed in the node and
+// object ids of discovery topics.
+var homeAssistantIdPattern = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// homeAssistantObjectId derives a readable id from the item, the hash keeps
+// items unique that only differ in replaced characters.
+func homeAssistantObjectId(item string) string {
+	h := fnv.New32a()
+	h.Write([]byte(item))
+	return fmt.Sprintf("%s_%08x", homeAssistantIdPattern.ReplaceAllString(item, "_"), h.Sum32())
+}
+
+// homeAssistantDiscovery returns the retained discovery config of an item as
+// binary_sensor with the connectivity device class, which is on while the
+// item is healthy. It reads the state topic and is unavailable while the
+// checker is offline.
+func (p *mqttPublisher) homeAssistantDiscovery(view StatusView) (topic string, payload []byte, err error) {
+	node := homeAssistantIdPattern.ReplaceAllString(p.clientId, "_")
+	object := homeAssistantObjectId(view.Url)
+	name := view.Name
+	if name == "" {
+		name = view.Url
+	}
+	stateTopic := p.prefix + "targets/" + mqttTopicEscape(view.Url)
+
+	payload, err = json.Marshal(map[string]any{
+		"name":                  name,
+		"unique_id":             node + "_" + object,
+		"object_id":             object,
+		"device_class":          "connectivity",
+		"state_topic":           stateTopic,
+		"value_template":        "{{ 'ON' if value_json.healthy else 'OFF' }}",
+		"json_attributes_topic": stateTopic,
+		"availability_topic":    p.prefix + "status",
+		"payload_available":     "online",
+		"payload_not_available": "offline",
+		"device": map[string]any{
+			"identifiers":  []string{node},
+			"name":         "status-checker " + p.clientId,
+			"manufacturer": "status-checker",
+			"sw_version":   version,
+		},
+	})
+	return p.discoveryPrefix + "/binary_sensor/" + node + "/" + object + "/config", payload, err
+}
+
+// discoveryMessages returns the discovery configs of new or changed items,
+// or of all after a reconnect, and empty retained messages removing the entities of
+// items that are gone. The caller has to hold p.mu.
+func (p *mqttPublisher) discoveryMessages(views []StatusView) (map[string][]byte, error) {
+	messages := make(map[string][]byte)
+	current := make(map[string]string, len(views))
+	for _, view := range views {
+		topic, payload, err := p.homeAssistantDiscovery(view)
+		if err != nil {
+			return nil, err
+		}
+		current[topic] = string(payload)
+		if p.discovered[topic] != string(payload) || p.rediscover {
+			messages[topic] = payload
+		}
+	}
+	for topic := range p.discovered {
+		if _, ok := current[topic]; !ok {
+			messages[topic] = []byte{}
+		}
+	}
+	p.discovered = current
+	p.rediscover = false
+	return messages, nil
+}
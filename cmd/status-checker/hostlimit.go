@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/url"
+	"sync"
+)
+
+// hostLimiter caps the number of concurrent checks against the same host so
+// targets sharing a host aren't hit with a burst of requests every round.
+type hostLimiter struct {
+	mu     sync.Mutex
+	max    int
+	tokens map[string]chan struct{}
+}
+
+var checkHostLimiter = &hostLimiter{tokens: make(map[string]chan struct{})}
+
+func (l *hostLimiter) configure(max int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.max = max
+}
+
+func (l *hostLimiter) hostTokens(item string) chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.max <= 0 {
+		return nil
+	}
+
+	host := item
+	if parsed, err := url.Parse(item); err == nil && parsed.Host != "" {
+		host = parsed.Host
+	}
+
+	tokens, ok := l.tokens[host]
+	if !ok {
+		tokens = make(chan struct{}, l.max)
+		l.tokens[host] = tokens
+	}
+	return tokens
+}
+
+// acquire blocks until a check against the host of item may start. The
+// returned function has to be called once the check is done.
+func (l *hostLimiter) acquire(item string) func() {
+	tokens := l.hostTokens(item)
+	if tokens == nil {
+		return func() {}
+	}
+
+	tokens <- struct{}{}
+	return func() { <-tokens }
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// HTTP/3 modes of targets. Auto switches to HTTP/3 once the target offered it
+// with Alt-Svc and falls back to TCP if it fails, always only uses HTTP/3.
+const (
+	http3Auto   = "auto"
+	http3Always = "always"
+)
+
+var http3Modes = []string{http3Auto, http3Always}
+
+// altSvcBrokenFor is how long an origin is checked over TCP after HTTP/3
+// failed, so a broken alternative doesn't slow down every check.
+const altSvcBrokenFor = 5 * time.Minute
+
+// altSvcDefaultMaxAge is the lifetime of an alternative without ma.
+const altSvcDefaultMaxAge = 24 * time.Hour
+
+// altSvc is an HTTP/3 alternative of an origin.
+type altSvc struct {
+	// authority is the host and port to connect to, the host is empty for
+	// the host of the origin
+	authority string
+	expires   time.Time
+	// broken is set until when the alternative isn't used after it failed
+	broken time.Time
+}
+
+// altSvcCache holds the HTTP/3 alternatives the origins of targets offered,
+// by the host and port of the origin.
+type altSvcCache struct {
+	mu      sync.Mutex
+	origins map[string]altSvc
+}
+
+var altServices = &altSvcCache{origins: make(map[string]altSvc)}
+
+// update records the alternative offered in header, a response without one
+// keeps the alternative until it expires. Alternatives are not used again
+// while they are broken.
+func (c *altSvcCache) update(origin string, header http.Header, now time.Time) {
+	authority, maxAge, ok, cleared := http3AltSvc(header)
+	if !ok && !cleared {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cleared {
+		delete(c.origins, origin)
+		return
+	}
+	previous := c.origins[origin]
+	c.origins[origin] = altSvc{authority: authority, expires: now.Add(maxAge), broken: previous.broken}
+}
+
+// alternative returns the address to connect to for HTTP/3 if the origin
+// offered it.
+func (c *altSvcCache) alternative(origin string, now time.Time) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	alt, ok := c.origins[origin]
+	if !ok || !now.Before(alt.expires) || now.Before(alt.broken) {
+		return "", false
+	}
+	host, port, err := net.SplitHostPort(alt.authority)
+	if err != nil {
+		return "", false
+	}
+	if host == "" {
+		host, _, _ = net.SplitHostPort(origin)
+	}
+	return net.JoinHostPort(host, port), true
+}
+
+// markBroken stops using the alternative of the origin for altSvcBrokenFor.
+func (c *altSvcCache) markBroken(origin string, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if alt, ok := c.origins[origin]; ok {
+		alt.broken = now.Add(altSvcBrokenFor)
+		c.origins[origin] = alt
+	}
+}
+
+// http3AltSvc returns the first HTTP/3 alternative of an Alt-Svc header, e.g.
+// h3=":443"; ma=86400, and whether the header clears the alternatives.
+func http3AltSvc(header http.Header) (authority string, maxAge time.Duration, ok bool, cleared bool) {
+	for _, value := range header.Values("Alt-Svc") {
+		if strings.TrimSpace(value) == "clear" {
+			return "", 0, false, true
+		}
+		for _, service := range strings.Split(value, ",") {
+			params := strings.Split(service, ";")
+			protocol, quoted, _ := strings.Cut(strings.TrimSpace(params[0]), "=")
+			if protocol != "h3" {
+				continue
+			}
+			authority, err := strconv.Unquote(quoted)
+			if err != nil {
+				continue
+			}
+			maxAge := altSvcDefaultMaxAge
+			for _, param := range params[1:] {
+				if seconds, ok := strings.CutPrefix(strings.TrimSpace(param), "ma="); ok {
+					if n, err := strconv.ParseUint(seconds, 10, 32); err == nil {
+						maxAge = time.Duration(n) * time.Second
+					}
+				}
+			}
+			return authority, maxAge, true, false
+		}
+	}
+	return "", 0, false, false
+}
+
+// advertisesHttp3 reports whether an Alt-Svc header offers HTTP/3.
+func advertisesHttp3(header http.Header) bool {
+	_, _, ok, _ := http3AltSvc(header)
+	return ok
+}
+
+// originAuthority returns host and port of the origin of u, with the default
+// port of the scheme if it has none.
+func originAuthority(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = "443"
+		if u.Scheme == "http" {
+			port = "80"
+		}
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// quicTransport sends the packets of all HTTP/3 checks from one UDP socket.
+var quicTransport = sync.OnceValues(func() (*quic.Transport, error) {
+	conn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return nil, err
+	}
+	return &quic.Transport{Conn: conn}, nil
+})
+
+// http3CheckTransport is the HTTP/3 transport of the targets of the config,
+// managedHttp3CheckTransport the one of targets added through the API.
+var (
+	http3CheckTransport        = &http3.Transport{Dial: dialQuic(false)}
+	managedHttp3CheckTransport = &http3.Transport{Dial: dialQuic(true)}
+)
+
+// dialQuic connects to the HTTP/3 alternative of the origin at addr, or to
+// addr itself if it offered none. With policy apiTargetPolicy is applied to
+// the address, like policyDialer does for TCP.
+func dialQuic(policy bool) func(context.Context, string, *tls.Config, *quic.Config) (*quic.Conn, error) {
+	return func(ctx context.Context, addr string, tlsConfig *tls.Config, quicConfig *quic.Config) (*quic.Conn, error) {
+		transport, err := quicTransport()
+		if err != nil {
+			return nil, err
+		}
+		if alternative, ok := altServices.alternative(addr, time.Now()); ok {
+			addr = alternative
+		}
+		host, portString, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		port, err := strconv.ParseUint(portString, 10, 16)
+		if err != nil {
+			return nil, err
+		}
+		addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		if err != nil {
+			return nil, err
+		}
+		err = errors.New("no address")
+		for _, ip := range addrs {
+			if policy {
+				if err = apiTargetPolicy.checkAddr(ip); err != nil {
+					continue
+				}
+			}
+			return transport.Dial(ctx, net.UDPAddrFromAddrPort(netip.AddrPortFrom(ip.Unmap(), uint16(port))), tlsConfig, quicConfig)
+		}
+		return nil, err
+	}
+}
+
+// http3RoundTripper sends the requests of a target over HTTP/3 as its mode
+// says and over TCP otherwise. There is no HTTP/3 without TLS, http URLs
+// always use TCP.
+type http3RoundTripper struct {
+	tcp    http.RoundTripper
+	h3     http.RoundTripper
+	always bool
+}
+
+func (t *http3RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != "https" {
+		return t.tcp.RoundTrip(req)
+	}
+	origin := originAuthority(req.URL)
+	if _, offered := altServices.alternative(origin, time.Now()); t.always || offered {
+		resp, err := t.h3.RoundTrip(req)
+		if err == nil || t.always || req.Context().Err() != nil {
+			if err == nil {
+				altServices.update(origin, resp.Header, time.Now())
+			}
+			return resp, err
+		}
+		checkLog.Debug("HTTP/3 failed, using TCP", "origin", origin, "error", err)
+		altServices.markBroken(origin, time.Now())
+	}
+	resp, err := t.tcp.RoundTrip(req)
+	if err == nil {
+		altServices.update(origin, resp.Header, time.Now())
+	}
+	return resp, err
+}
+
+// http3CheckClient returns a client like base which uses HTTP/3 in the mode.
+func http3CheckClient(base *http.Client, h3 http.RoundTripper, mode string) *http.Client {
+	tcp := base.Transport
+	if tcp == nil {
+		tcp = http.DefaultTransport
+	}
+	return &http.Client{
+		Transport:     &http3RoundTripper{tcp: tcp, h3: h3, always: mode == http3Always},
+		CheckRedirect: base.CheckRedirect,
+		Timeout:       base.Timeout,
+	}
+}
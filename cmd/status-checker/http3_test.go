@@ -0,0 +1,223 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+func TestHttp3AltSvc(t *testing.T) {
+	tests := []struct {
+		header    []string
+		authority string
+		maxAge    time.Duration
+		ok        bool
+		cleared   bool
+	}{
+		{nil, "", 0, false, false},
+		{[]string{`h2=":443"`}, "", 0, false, false},
+		{[]string{`h3=":443"`}, ":443", altSvcDefaultMaxAge, true, false},
+		{[]string{`h3=":443"; ma=86400`}, ":443", 24 * time.Hour, true, false},
+		{[]string{`h3-29=":443"; ma=60, h3="alt.example.com:8443"; ma=60; persist=1`}, "alt.example.com:8443", time.Minute, true, false},
+		{[]string{`h2=":443"`, `h3=":4433"`}, ":4433", altSvcDefaultMaxAge, true, false},
+		{[]string{`h3=:443`}, "", 0, false, false},
+		{[]string{`clear`}, "", 0, false, true},
+	}
+	for _, test := range tests {
+		header := http.Header{"Alt-Svc": test.header}
+		authority, maxAge, ok, cleared := http3AltSvc(header)
+		if authority != test.authority || maxAge != test.maxAge || ok != test.ok || cleared != test.cleared {
+			t.Errorf("http3AltSvc(%q) = %q, %s, %t, %t, want %q, %s, %t, %t", test.header, authority, maxAge, ok, cleared, test.authority, test.maxAge, test.ok, test.cleared)
+		}
+	}
+}
+
+func TestAltSvcCache(t *testing.T) {
+	cache := &altSvcCache{origins: make(map[string]altSvc)}
+	now := time.Date(2026, 1, 2, 12, 0, 0, 0, time.UTC)
+	const origin = "status.example.com:443"
+
+	cache.update(origin, http.Header{"Alt-Svc": {`h3=":8443"; ma=60`}}, now)
+	if alternative, ok := cache.alternative(origin, now); !ok || alternative != "status.example.com:8443" {
+		t.Errorf("alternative = %q, %t, want the port of the origin's host", alternative, ok)
+	}
+	if _, ok := cache.alternative(origin, now.Add(time.Minute)); ok {
+		t.Errorf("alternative used after its max age")
+	}
+	// responses without Alt-Svc keep the alternative
+	cache.update(origin, http.Header{}, now)
+	if _, ok := cache.alternative(origin, now); !ok {
+		t.Errorf("alternative forgotten without Alt-Svc")
+	}
+
+	cache.markBroken(origin, now)
+	cache.update(origin, http.Header{"Alt-Svc": {`h3="h3.example.com:443"`}}, now)
+	if _, ok := cache.alternative(origin, now.Add(altSvcBrokenFor-time.Second)); ok {
+		t.Errorf("broken alternative used")
+	}
+	if alternative, ok := cache.alternative(origin, now.Add(altSvcBrokenFor)); !ok || alternative != "h3.example.com:443" {
+		t.Errorf("alternative once no longer broken = %q, %t, want the offered one", alternative, ok)
+	}
+
+	cache.update(origin, http.Header{"Alt-Svc": {"clear"}}, now)
+	if _, ok := cache.alternative(origin, now); ok {
+		t.Errorf("alternative used after it was cleared")
+	}
+}
+
+// startHttp3Server serves handler over HTTP/3 on a local UDP port with the
+// certificate of server.
+func startHttp3Server(t *testing.T, server *httptest.Server, handler http.Handler) int {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h3 := &http3.Server{Handler: handler, TLSConfig: http3.ConfigureTLSConfig(&tls.Config{Certificates: server.TLS.Certificates})}
+	go h3.Serve(conn)
+	t.Cleanup(func() { h3.Close() })
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func TestHttp3RoundTripper(t *testing.T) {
+	var quicPort int
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Alt-Svc", fmt.Sprintf(`h3=":%d"; ma=60`, quicPort))
+	}))
+	defer server.Close()
+	quicPort = startHttp3Server(t, server, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	h3 := &http3.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: roots},
+		QUICConfig:      &quic.Config{HandshakeIdleTimeout: 500 * time.Millisecond},
+		Dial:            dialQuic(false),
+	}
+	defer h3.Close()
+	base := server.Client()
+
+	protocol := func(client *http.Client, url string) (string, error) {
+		resp, err := client.Get(url)
+		if err != nil {
+			return "", err
+		}
+		resp.Body.Close()
+		return resp.Proto, nil
+	}
+
+	// auto switches to HTTP/3 once it was offered
+	auto := http3CheckClient(base, h3, http3Auto)
+	for i, want := range []string{"HTTP/1.1", "HTTP/3.0", "HTTP/3.0"} {
+		if proto, err := protocol(auto, server.URL); err != nil || proto != want {
+			t.Errorf("auto request %d = %s, %v, want %s", i+1, proto, err, want)
+		}
+	}
+
+	// always doesn't need an offer, the HTTP/3 server doesn't listen on TCP
+	always := http3CheckClient(base, h3, http3Always)
+	if proto, err := protocol(always, fmt.Sprintf("https://127.0.0.1:%d/", quicPort)); err != nil || proto != "HTTP/3.0" {
+		t.Errorf("always = %s, %v, want HTTP/3.0", proto, err)
+	}
+	tcpOnly := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer tcpOnly.Close()
+	if _, err := protocol(always, tcpOnly.URL); err == nil {
+		t.Errorf("always succeeded without an HTTP/3 server")
+	}
+
+	// without TLS there is no HTTP/3
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer plain.Close()
+	if proto, err := protocol(always, plain.URL); err != nil || proto != "HTTP/1.1" {
+		t.Errorf("always for an http url = %s, %v, want HTTP/1.1", proto, err)
+	}
+}
+
+func TestHttp3RoundTripperFallback(t *testing.T) {
+	// the offered port doesn't serve HTTP/3
+	closed, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedPort := closed.LocalAddr().(*net.UDPAddr).Port
+	closed.Close()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Alt-Svc", fmt.Sprintf(`h3=":%d"`, closedPort))
+	}))
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	h3 := &http3.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: roots},
+		QUICConfig:      &quic.Config{HandshakeIdleTimeout: 200 * time.Millisecond},
+		Dial:            dialQuic(false),
+	}
+	defer h3.Close()
+	auto := http3CheckClient(server.Client(), h3, http3Auto)
+
+	for i := range 3 {
+		start := time.Now()
+		resp, err := auto.Get(server.URL)
+		if err != nil {
+			t.Fatalf("request %d: %v", i+1, err)
+		}
+		resp.Body.Close()
+		if resp.Proto != "HTTP/1.1" {
+			t.Errorf("request %d = %s, want the fallback to HTTP/1.1", i+1, resp.Proto)
+		}
+		// only the second request tries the broken alternative
+		if i == 2 && time.Since(start) > 100*time.Millisecond {
+			t.Errorf("broken alternative tried again")
+		}
+	}
+}
+
+func TestDialQuicPolicy(t *testing.T) {
+	policy, err := newTargetPolicy(defaultAPITargetSchemes, "", "", "", defaultAPITargetDenyCIDRs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setTargetPolicy(t, policy)
+	client := http3CheckClient(managedCheckClient, managedHttp3CheckTransport, http3Always)
+	if _, err := client.Get("https://127.0.0.1:4433/"); err == nil || !strings.Contains(err.Error(), "address 127.0.0.1 is not allowed") {
+		t.Errorf("HTTP/3 request to a denied address = %v, want it denied", err)
+	}
+}
+
+func TestHttp3Mode(t *testing.T) {
+	c := Config{Http3: http3Auto}
+	tests := []struct {
+		target Target
+		mode   string
+	}{
+		{Target{Url: "https://a.example.com/"}, http3Auto},
+		{Target{Url: "HTTPS://a.example.com/"}, http3Auto},
+		{Target{Url: "http://a.example.com/"}, ""},
+		{Target{Url: "https://a.example.com/", Http3: http3Always}, http3Always},
+	}
+	for _, test := range tests {
+		if mode := c.http3Mode(test.target); mode != test.mode {
+			t.Errorf("http3Mode(%+v) = %q, want %q", test.target, mode, test.mode)
+		}
+	}
+
+	for _, invalid := range []Config{
+		{Http3: "on"},
+		{Targets: []Target{{Url: "https://a.example.com/", Http3: "yes"}}},
+		{Targets: []Target{{Url: "http://a.example.com/", Http3: http3Always}}},
+	} {
+		if err := invalid.validate(); err == nil {
+			t.Errorf("validate(%+v) succeeded", invalid)
+		}
+	}
+}
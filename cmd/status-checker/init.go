@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// stringList is a flag that can be given multiple times.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// exampleTargets are used if no targets are given to init.
+var exampleTargets = []string{"https://example.com", "https://example.org"}
+
+const systemdUnitTemplate = `[Unit]
+Description=Status Checker
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Type=notify
+ExecStart=%s serve -c %s -d %s -s %s
+WatchdogSec=60
+Restart=on-failure
+
+[Install]
+WantedBy=multi-user.target
+`
+
+const composeTemplate = `services:
+  status-checker:
+    restart: unless-stopped
+    build:
+      context: .
+      dockerfile: Dockerfile
+    ports:
+      - "8081:8081"
+    volumes:
+      - %s:/app/config.json
+      - ./data:/app/data
+`
+
+type initArgs struct {
+	outputPath  string
+	targets     stringList
+	force       bool
+	systemdPath string
+	composePath string
+}
+
+func newInitFlagSet(a *initArgs) *flag.FlagSet {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	fs.StringVar(&a.outputPath, "output", "./config.json", "path to write the config to (default ./config.json)")
+	fs.StringVar(&a.outputPath, "o", "./config.json", "path to write the config to (default ./config.json) (shorthand)")
+	fs.Var(&a.targets, "target", "url of a target to check, can be given multiple times (default asks or uses examples)")
+	fs.BoolVar(&a.force, "force", false, "overwrite existing files (default false)")
+	fs.StringVar(&a.systemdPath, "systemd-unit", "", "also write a systemd unit to this path (default none)")
+	fs.StringVar(&a.composePath, "compose", "", "also write a docker compose file to this path (default none)")
+	return fs
+}
+
+func runInit(arguments []string) int {
+	var a initArgs
+	parseFlags(newInitFlagSet(&a), arguments)
+
+	// fail before asking for targets that couldn't be written anyway
+	if _, err := os.Stat(a.outputPath); err == nil && !a.force {
+		fmt.Fprintf(os.Stderr, "Error: %s already exists, use --force to overwrite it\n", a.outputPath)
+		return 1
+	}
+
+	if len(a.targets) == 0 && isTerminal(os.Stdin) {
+		a.targets = promptTargets()
+	}
+	if len(a.targets) == 0 {
+		a.targets = exampleTargets
+	}
+
+	generated := Config{}
+	for _, url := range a.targets {
+		generated.Targets = append(generated.Targets, Target{Url: url})
+	}
+	if err := generated.validate(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+
+	configBytes, err := json.MarshalIndent(generated, "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	if err := writeNewFile(a.outputPath, append(configBytes, '\n'), a.force); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	fmt.Printf("Wrote config with %d targets to %s\n", len(generated.Targets), a.outputPath)
+
+	if a.systemdPath != "" {
+		if err := writeSystemdUnit(a.systemdPath, a.outputPath, a.force); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return 1
+		}
+		fmt.Printf("Wrote systemd unit to %s\n", a.systemdPath)
+	}
+
+	if a.composePath != "" {
+		compose := fmt.Sprintf(composeTemplate, a.outputPath)
+		if err := writeNewFile(a.composePath, []byte(compose), a.force); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return 1
+		}
+		fmt.Printf("Wrote docker compose file to %s\n", a.composePath)
+	}
+
+	return 0
+}
+
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func promptTargets() []string {
+	var targets []string
+	scanner := bufio.NewScanner(os.Stdin)
+	fmt.Println("Enter the urls to check, an empty line finishes.")
+	for {
+		fmt.Print("Target url: ")
+		if !scanner.Scan() {
+			break
+		}
+		url := strings.TrimSpace(scanner.Text())
+		if url == "" {
+			break
+		}
+		targets = append(targets, url)
+	}
+	return targets
+}
+
+func writeSystemdUnit(path string, configPath string, force bool) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	configPath, err = filepath.Abs(configPath)
+	if err != nil {
+		return err
+	}
+
+	// keep data and static files next to the config and binary
+	dataPath := filepath.Join(filepath.Dir(configPath), "data")
+	staticPath := filepath.Join(filepath.Dir(executable), "static")
+
+	unit := fmt.Sprintf(systemdUnitTemplate, executable, configPath, dataPath, staticPath)
+	return writeNewFile(path, []byte(unit), force)
+}
+
+// writeNewFile refuses to overwrite existing files unless force is set.
+func writeNewFile(path string, content []byte, force bool) error {
+	if _, err := os.Stat(path); err == nil && !force {
+		return fmt.Errorf("%s already exists, use --force to overwrite it", path)
+	}
+	return os.WriteFile(path, content, 0644)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+)
+
+// uptimeKumaBackup is the part of an Uptime Kuma backup file that is
+// imported.
+type uptimeKumaBackup struct {
+	NotificationList []struct {
+		Id     int    `json:"id"`
+		Name   string `json:"name"`
+		Config string `json:"config"` // JSON
+		Active bool   `json:"active"`
+	} `json:"notificationList"`
+	MonitorList []struct {
+		Id                  int             `json:"id"`
+		Name                string          `json:"name"`
+		Type                string          `json:"type"`
+		Url                 string          `json:"url"`
+		Method              string          `json:"method"`
+		Hostname            string          `json:"hostname"`
+		Port                int             `json:"port"`
+		Keyword             string          `json:"keyword"`
+		Interval            int             `json:"interval"`
+		Headers             *string         `json:"headers"` // JSON
+		AcceptedStatusCodes []string        `json:"accepted_statuscodes"`
+		NotificationIdList  map[string]bool `json:"notificationIDList"`
+		Active              json.RawMessage `json:"active"` // bool or 0/1
+	} `json:"monitorList"`
+}
+
+// convertUptimeKuma converts the monitors and notifications of an Uptime Kuma
+// backup. Everything that can't be expressed in the config is reported in
+// the warnings.
+func convertUptimeKuma(data []byte) (Config, []string, error) {
+	var backup uptimeKumaBackup
+	if err := json.Unmarshal(data, &backup); err != nil {
+		return Config{}, nil, fmt.Errorf("parsing uptime kuma backup: %w", err)
+	}
+	if backup.MonitorList == nil {
+		return Config{}, nil, fmt.Errorf("parsing uptime kuma backup: no monitorList")
+	}
+
+	var converted Config
+	var warnings []string
+	warn := func(format string, args ...any) {
+		warnings = append(warnings, fmt.Sprintf(format, args...))
+	}
+
+	webhooks := make(map[int]bool)
+	for _, notification := range backup.NotificationList {
+		var settings struct {
+			Type       string `json:"type"`
+			WebhookURL string `json:"webhookURL"`
+		}
+		if err := json.Unmarshal([]byte(notification.Config), &settings); err != nil {
+			warn("notification %q: skipped, invalid config: %v", notification.Name, err)
+			continue
+		}
+		if settings.Type != "webhook" || settings.WebhookURL == "" {
+			warn("notification %q: skipped, %s notifications are not supported, only webhooks", notification.Name, settings.Type)
+			continue
+		}
+		if !notification.Active {
+			warn("notification %q: skipped as it is not active", notification.Name)
+			continue
+		}
+		webhooks[notification.Id] = true
+		converted.Webhooks = append(converted.Webhooks, Webhook{Url: settings.WebhookURL})
+	}
+
+	intervals := make(map[int]bool)
+	for _, monitor := range backup.MonitorList {
+		name := monitor.Name
+		switch monitor.Type {
+		case "http", "keyword":
+		case "port":
+			warn("monitor %q: skipped, TCP checks of %s:%d are not supported", name, monitor.Hostname, monitor.Port)
+			continue
+		default:
+			warn("monitor %q: skipped, %s monitors are not supported", name, monitor.Type)
+			continue
+		}
+		if string(monitor.Active) == "false" || string(monitor.Active) == "0" {
+			warn("monitor %q: skipped as it is paused", name)
+			continue
+		}
+
+		target := Target{Url: monitor.Url, Name: name}
+		if monitor.Headers != nil && *monitor.Headers != "" {
+			if err := json.Unmarshal([]byte(*monitor.Headers), &target.Headers); err != nil {
+				warn("monitor %q: headers ignored, they are not a JSON object: %v", name, err)
+			}
+		}
+		if monitor.Type == "keyword" {
+			warn("monitor %q: imported as plain HTTP check, the keyword %q isn't checked", name, monitor.Keyword)
+		}
+		if monitor.Method != "" && monitor.Method != "GET" {
+			warn("monitor %q: imported as GET request instead of %s", name, monitor.Method)
+		}
+		if len(monitor.AcceptedStatusCodes) > 0 && !slices.Equal(monitor.AcceptedStatusCodes, []string{"200-299"}) {
+			warn("monitor %q: only 2xx status codes are healthy instead of %v", name, monitor.AcceptedStatusCodes)
+		}
+		var missing []int
+		for id, enabled := range monitor.NotificationIdList {
+			if n, err := strconv.Atoi(id); enabled && err == nil && !webhooks[n] {
+				missing = append(missing, n)
+			}
+		}
+		sort.Ints(missing)
+		for _, n := range missing {
+			warn("monitor %q: notification %d isn't imported", name, n)
+		}
+		if monitor.Interval > 0 {
+			intervals[monitor.Interval] = true
+		}
+		converted.Targets = append(converted.Targets, target)
+	}
+
+	if len(converted.Webhooks) > 0 {
+		warn("webhooks are notified about all targets, not only the monitors they were assigned to")
+	}
+	if len(intervals) > 1 {
+		sorted := make([]int, 0, len(intervals))
+		for interval := range intervals {
+			sorted = append(sorted, interval)
+		}
+		sort.Ints(sorted)
+		warn("monitors use the intervals %v seconds, all targets are checked every --timeout seconds, e.g. --timeout %d", sorted, sorted[0])
+	} else {
+		for interval := range intervals {
+			warn("monitors are checked every %d seconds, run serve with --timeout %d", interval, interval)
+		}
+	}
+
+	return converted, warnings, converted.validate()
+}
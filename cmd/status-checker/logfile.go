@@ -0,0 +1,142 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotationTimeFormat is appended to the name of rotated log files.
+const rotationTimeFormat = "20060102-150405"
+
+// rotatingFile is a log file that is rotated once it exceeds maxSize bytes or
+// is older than rotateEvery. Rotated files are removed if there are more than
+// maxBackups of them or they are older than maxAge. Zero values disable the
+// respective limit.
+type rotatingFile struct {
+	mu          sync.Mutex
+	path        string
+	maxSize     int64
+	rotateEvery time.Duration
+	maxBackups  int
+	maxAge      time.Duration
+
+	file     *os.File
+	size     int64
+	openedAt time.Time
+}
+
+func openRotatingFile(path string, maxSize int64, rotateEvery time.Duration, maxBackups int, maxAge time.Duration) (*rotatingFile, error) {
+	f := &rotatingFile{
+		path:        path,
+		maxSize:     maxSize,
+		rotateEvery: rotateEvery,
+		maxBackups:  maxBackups,
+		maxAge:      maxAge,
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *rotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.path), os.ModePerm); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	f.file = file
+	f.size = info.Size()
+	f.openedAt = time.Now()
+	return nil
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	sizeExceeded := f.maxSize > 0 && f.size+int64(len(p)) > f.maxSize && f.size > 0
+	tooOld := f.rotateEvery > 0 && time.Since(f.openedAt) > f.rotateEvery
+	if sizeExceeded || tooOld {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
+
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+
+	rotatedPath := f.path + "." + time.Now().Format(rotationTimeFormat)
+	if err := os.Rename(f.path, rotatedPath); err != nil {
+		return err
+	}
+
+	if err := f.open(); err != nil {
+		return err
+	}
+
+	f.removeOldBackups()
+	return nil
+}
+
+// removeOldBackups deletes rotated files beyond the retention limits. Errors
+// are ignored as they must not stop logging.
+func (f *rotatingFile) removeOldBackups() {
+	backups, err := filepath.Glob(f.path + ".*")
+	if err != nil {
+		return
+	}
+
+	type backup struct {
+		path      string
+		rotatedAt time.Time
+	}
+	var rotated []backup
+	for _, path := range backups {
+		suffix := strings.TrimPrefix(path, f.path+".")
+		rotatedAt, err := time.ParseInLocation(rotationTimeFormat, suffix, time.Local)
+		if err != nil {
+			continue
+		}
+		rotated = append(rotated, backup{path, rotatedAt})
+	}
+
+	// newest first
+	sort.Slice(rotated, func(i, j int) bool {
+		return rotated[i].rotatedAt.After(rotated[j].rotatedAt)
+	})
+
+	for i, b := range rotated {
+		tooMany := f.maxBackups > 0 && i >= f.maxBackups
+		tooOld := f.maxAge > 0 && time.Since(b.rotatedAt) > f.maxAge
+		if tooMany || tooOld {
+			os.Remove(b.path)
+		}
+	}
+}
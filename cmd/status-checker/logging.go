@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// logOutput is where logs are written to, the Windows service replaces it
+// with the event log.
+var logOutput io.Writer = os.Stderr
+
+// levelTrace is below debug and only used for the result of every single
+// check, levelOff silences a component.
+const (
+	levelTrace = slog.LevelDebug - 4
+	levelOff   = slog.LevelError + 4
+)
+
+// Log components, their level can be set on their own with --log-components.
+const (
+	componentCheck     = "check"     // result of every single check
+	componentState     = "state"     // state transitions and notifications
+	componentWebsocket = "websocket" // websocket clients
+)
+
+var (
+	checkLog     = componentLogger(componentCheck)
+	stateLog     = componentLogger(componentState)
+	websocketLog = componentLogger(componentWebsocket)
+)
+
+func componentLogger(component string) *slog.Logger {
+	return slog.Default().With("component", component)
+}
+
+func parseLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(level) {
+	case "trace":
+		return levelTrace, nil
+	case "off":
+		return levelOff, nil
+	}
+	var parsed slog.Level
+	if err := parsed.UnmarshalText([]byte(level)); err != nil {
+		return 0, fmt.Errorf("invalid log level %q, use trace, debug, info, warn, error or off", level)
+	}
+	return parsed, nil
+}
+
+// parseComponentLevels parses a comma separated list of component=level.
+func parseComponentLevels(components string) (map[string]slog.Level, error) {
+	levels := make(map[string]slog.Level)
+	for _, entry := range strings.Split(components, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		component, level, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid log component %q, use component=level", entry)
+		}
+		switch component {
+		case componentCheck, componentState, componentWebsocket:
+		default:
+			return nil, fmt.Errorf("unknown log component %q, use %s, %s or %s", component, componentCheck, componentState, componentWebsocket)
+		}
+		parsed, err := parseLevel(level)
+		if err != nil {
+			return nil, err
+		}
+		levels[component] = parsed
+	}
+	return levels, nil
+}
+
+// setupLogging configures the default slog logger, which the log package
+// writes to as well. The format is either text (key=value pairs) or json (one
+// object per line). components overrides the level of single components, see
+// parseComponentLevels.
+func setupLogging(level string, format string, components string) error {
+	logLevel, err := parseLevel(level)
+	if err != nil {
+		return err
+	}
+	levels, err := parseComponentLevels(components)
+	if err != nil {
+		return err
+	}
+
+	options := &slog.HandlerOptions{Level: levelTrace, ReplaceAttr: replaceLevelName}
+	var handler slog.Handler
+	switch format {
+	case "text":
+		handler = slog.NewTextHandler(logOutput, options)
+	case "json":
+		handler = slog.NewJSONHandler(logOutput, options)
+	default:
+		return fmt.Errorf("invalid log format %q, use text or json", format)
+	}
+
+	slog.SetDefault(slog.New(&componentHandler{handler: handler, level: logLevel, levels: levels}))
+	checkLog = componentLogger(componentCheck)
+	stateLog = componentLogger(componentState)
+	websocketLog = componentLogger(componentWebsocket)
+	return nil
+}
+
+func replaceLevelName(groups []string, attr slog.Attr) slog.Attr {
+	if attr.Key == slog.LevelKey && len(groups) == 0 && attr.Value.Any() == levelTrace {
+		attr.Value = slog.StringValue("TRACE")
+	}
+	return attr
+}
+
+// componentHandler filters records by the level of their component, which
+// is taken from the component attribute added with Logger.With.
+type componentHandler struct {
+	handler slog.Handler
+	level   slog.Level
+	levels  map[string]slog.Level
+}
+
+func (h *componentHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *componentHandler) Handle(ctx context.Context, record slog.Record) error {
+	return h.handler.Handle(ctx, record)
+}
+
+func (h *componentHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	level := h.level
+	for _, attr := range attrs {
+		if componentLevel, ok := h.levels[attr.Value.String()]; ok && attr.Key == "component" {
+			level = componentLevel
+		}
+	}
+	return &componentHandler{handler: h.handler.WithAttrs(attrs), level: level, levels: h.levels}
+}
+
+func (h *componentHandler) WithGroup(name string) slog.Handler {
+	return &componentHandler{handler: h.handler.WithGroup(name), level: h.level, levels: h.levels}
+}
+
+func healthState(healthy bool) string {
+	if healthy {
+		return "healthy"
+	}
+	return "unhealthy"
+}
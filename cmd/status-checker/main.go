@@ -1,16 +1,21 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
-	"syscall"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -22,157 +27,290 @@ type StatusState struct {
 	LastUnhealthy time.Time
 	ResponseCode  int
 	ResponseTime  time.Duration
+	// Problems are the affected components of a provider target.
+	Problems []string
+	// Protocol is the protocol of the last response, e.g. HTTP/3.0, and
+	// Http3Advertised whether it offered HTTP/3 with an Alt-Svc header.
+	Protocol        string
+	Http3Advertised bool
 }
 
 type StatusView struct {
 	Url           string `json:"url"`
+	Name          string `json:"name,omitempty"`
+	Description   string `json:"description,omitempty"`
+	Group         string `json:"group,omitempty"`
 	Healthy       bool   `json:"healthy"`
 	LastHealth    int64  `json:"lastHealthy"`
 	LastUnhealthy int64  `json:"lastUnhealthy"`
-	ResponseCode  int    `json:"responseCode"`
-	ResponseTime  int64  `json:"responseTime"`
+
+	// LastHealthyTime and LastUnhealthyTime are LastHealth and LastUnhealthy
+	// as RFC 3339 in the configured timezone, empty if never seen.
+	LastHealthyTime   string `json:"lastHealthyTime,omitempty"`
+	LastUnhealthyTime string `json:"lastUnhealthyTime,omitempty"`
+
+	ResponseCode    int    `json:"responseCode"`
+	ResponseTime    int64  `json:"responseTime"`
+	Protocol        string `json:"protocol,omitempty"`
+	Http3Advertised bool   `json:"http3Advertised,omitempty"`
+	// Degraded is set while a healthy target has a latency anomaly.
+	Degraded bool     `json:"degraded,omitempty"`
+	Members  []string `json:"members,omitempty"`
+	Problems []string `json:"problems,omitempty"`
+
+	Metadata map[string]any `json:"metadata,omitempty"`
 }
 
-var config []string
+var config Config
+
+// displayLocation is the timezone of config, it is guarded by stateMu too.
+var displayLocation = time.UTC
 var statusState map[string]StatusState = make(map[string]StatusState)
 
-func parseConfig(configPath string) {
-	configBytes, err := os.ReadFile(configPath)
-	if err != nil {
-		fmt.Println("Error:", err)
-		return
-	}
+// stateMu guards config and statusState, which the check loop and the
+// management API change while handlers read them.
+var stateMu sync.RWMutex
 
-	err = json.Unmarshal(configBytes, &config)
+func parseConfig(configPath string) {
+	parsed, err := readConfig(configPath)
 	if err != nil {
-		fmt.Println("Error parsing config:", err)
+		slog.Error("Error reading config", "path", configPath, "error", err)
 		return
 	}
+	applyConfig(parsed)
 
-	fmt.Printf("Parsed Config: %+v\n", config)
-
-	for _, item := range config {
-		statusState[item] = StatusState{Healthy: true}
-	}
+	slog.Info("Parsed config", "targets", len(config.Targets), "composites", len(config.Composites), "webhooks", len(config.Webhooks))
 }
 
-type args struct {
-	configPath string
-	staticPath string
-	dataPath   string
-	timeout    int
-}
-
-func parseArgs() args {
-	var (
-		configPath string
-		staticPath string
-		dataPath   string
-		timeout    int
-	)
-
-	flag.StringVar(&configPath, "config", "./config.json", "path to the config file (default ./config.json)")
-	flag.StringVar(&configPath, "c", "./config.json", "path to the config file (default ./config.json) (shorthand)")
-	flag.StringVar(&staticPath, "static", "./static", "path to the static files (default ./static)")
-	flag.StringVar(&staticPath, "s", "./static", "path to the static files (default ./static) (shorthand)")
-	flag.IntVar(&timeout, "timeout", 10, "timeout in seconds (default 10)")
-	flag.IntVar(&timeout, "t", 10, "timeout in seconds (default 10) (shorthand)")
-	flag.StringVar(&dataPath, "data", "./data", "path to the data files (default ./data)")
-	flag.StringVar(&dataPath, "d", "./data", "path to the data files (default ./data) (shorthand)")
-
-	// Parse the flags
-	flag.Parse()
+// applyConfig makes parsed the current config, all items start out healthy.
+func applyConfig(parsed Config) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	setConfig(parsed)
+	displayLocation, _ = parsed.location()
 
-	if flag.NArg() > 0 {
-		fmt.Println("Positional arguments found")
-		os.Exit(2)
+	for _, target := range config.Targets {
+		statusState[target.Url] = StatusState{Healthy: true}
 	}
-
-	if dataPath[len(dataPath)-1] != '/' {
-		dataPath += "/"
+	for _, composite := range config.Composites {
+		statusState[composite.Name] = StatusState{Healthy: true}
 	}
+}
 
-	fmt.Printf("Config Path: %s\n", configPath)
-	fmt.Printf("Static Path: %s\n", staticPath)
-	fmt.Printf("Data Path: %s\n", dataPath)
-	fmt.Printf("Timeout: %d\n", timeout)
+// checkClient is used for all checks, its timeout is set from the
+// check-timeout flag.
+var checkClient = &http.Client{Timeout: 10 * time.Second}
 
-	return args{
-		configPath: configPath,
-		staticPath: staticPath,
-		timeout:    timeout,
-		dataPath:   dataPath,
+func checkConfigItem(ctx context.Context, target Target) statusUpdate {
+	if target.Simulate != nil || simulateAll {
+		return simulateCheck(ctx, target, time.Now())
 	}
-}
-
-func checkConfigItem(item string) statusUpdate {
+	if target.Provider != nil {
+		return checkProvider(ctx, target)
+	}
+	item := target.Url
 	timeStart := time.Now()
-	resp, err := http.Get(item)
+	trace := newCheckTrace(item, timeStart)
+	resp, err := doCheckRequest(ctx, target, trace)
+	trace.end(resp, err)
+	if err != nil && ctx.Err() != nil {
+		// cancelled on shutdown, which says nothing about the target
+		return statusUpdate{item: item, cancelled: true}
+	}
 	if err != nil {
-		log.Print("Error checking item: ", item, " Error: ", err.Error())
+		checkLog.Warn("Check failed", "target", item, "duration", time.Since(timeStart), "error", err)
 		stat := 0
-		if !strings.Contains(err.Error(), "connect:") && !strings.Contains(err.Error(), "dial tcp:") && !strings.Contains(err.Error(), "timeout") {
+		if resp != nil {
+			// only happens if following a redirect failed
 			stat = resp.StatusCode
+			resp.Body.Close()
 		}
 
-		return statusUpdate{item, StatusState{
+		return statusUpdate{item: item, err: err, state: StatusState{
 			Healthy:       false,
 			ResponseTime:  time.Since(timeStart),
 			ResponseCode:  stat, // Set to 0 as there is no response code
-			LastHealthy:   statusState[item].LastHealthy,
 			LastUnhealthy: time.Now()}}
 	}
 
+	resp.Body.Close()
 	healthy := resp.StatusCode >= 200 && resp.StatusCode < 300
+	checkLog.Log(ctx, levelTrace, "Check complete", "target", item, "duration", time.Since(timeStart), "responseCode", resp.StatusCode)
+
+	return statusUpdate{item: item, state: StatusState{
+		Healthy:         healthy,
+		ResponseTime:    time.Since(timeStart),
+		ResponseCode:    resp.StatusCode,
+		Protocol:        resp.Proto,
+		Http3Advertised: advertisesHttp3(resp.Header),
+		LastHealthy:     time.Now()}}
+}
+
+// mergeStatusState keeps the time the item was last healthy or unhealthy from
+// the previous state as a single check only sets one of them.
+func mergeStatusState(previous StatusState, current StatusState) StatusState {
+	if current.LastHealthy.IsZero() {
+		current.LastHealthy = previous.LastHealthy
+	}
+	if current.LastUnhealthy.IsZero() {
+		current.LastUnhealthy = previous.LastUnhealthy
+	}
+	return current
+}
 
-	return statusUpdate{item, StatusState{
-		Healthy:       healthy,
-		ResponseTime:  time.Since(timeStart),
-		ResponseCode:  resp.StatusCode,
-		LastHealthy:   time.Now(),
-		LastUnhealthy: statusState[item].LastUnhealthy}}
+func doCheckRequest(ctx context.Context, target Target, trace *checkTrace) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.Url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = target.headers.Clone()
+	return checkClientFor(target).Do(trace.attach(req))
 }
 
 type statusUpdate struct {
-	item  string
-	state StatusState
+	item      string
+	state     StatusState
+	err       error
+	cancelled bool
+}
+
+// defaultMaxConcurrentChecks bounds the checks of a round so large configs
+// don't open thousands of connections at once.
+const defaultMaxConcurrentChecks = 100
+
+// maxConcurrentChecks is the number of check workers, 0 for one per target.
+var maxConcurrentChecks = defaultMaxConcurrentChecks
+
+// checkTarget checks a target within the limit of its host and tracks the
+// check in the self metrics and the watchdog.
+func checkTarget(ctx context.Context, target Target) statusUpdate {
+	selfMetrics.checksQueued.Add(1)
+	release := checkHostLimiter.acquire(target.Url)
+	selfMetrics.checksQueued.Add(-1)
+	defer release()
+	checkWatchdog.checkStarted(target.Url)
+	defer checkWatchdog.checkFinished(target.Url)
+	selfMetrics.checksRunning.Add(1)
+	result := checkConfigItem(ctx, target)
+	selfMetrics.checksRunning.Add(-1)
+	selfMetrics.checks.Add(1)
+	if target.PingUrl != "" && !result.cancelled {
+		sendPing(target.PingUrl, result.state.Healthy, target.managed)
+	}
+	return result
 }
 
-func updateStatusState() {
-	updateChannel := make(chan statusUpdate)
+// updateStatusState checks all targets with a bounded number of workers and
+// applies the results of the round at once, so readers of the state aren't
+// blocked once per target.
+func updateStatusState(ctx context.Context) {
+	stateMu.RLock()
+	targets := slices.Clone(config.Targets)
+	for i := range targets {
+		targets[i].headers = config.requestHeaders(targets[i])
+		targets[i].Http3 = config.http3Mode(targets[i])
+	}
+	anomaly := config.LatencyAnomaly
+	buckets := config.latencyBuckets()
+	stateMu.RUnlock()
+	slos := make(map[string]bool)
+	for _, target := range targets {
+		slos[target.Url] = target.Slo != nil
+	}
+
+	checked := slices.DeleteFunc(slices.Clone(targets), func(t Target) bool { return t.Passive })
+	workers := maxConcurrentChecks
+	if workers <= 0 || workers > len(checked) {
+		workers = len(checked)
+	}
+	queue := make(chan Target)
+	results := make(chan statusUpdate, workers)
+	for range workers {
+		go func() {
+			for target := range queue {
+				results <- checkTarget(ctx, target)
+			}
+		}()
+	}
+	go func() {
+		for _, target := range checked {
+			queue <- target
+		}
+		close(queue)
+	}()
 
-	for _, item := range config {
-		go func(item string) {
-			result := checkConfigItem(item)
-			updateChannel <- result
-		}(item)
+	updates := make([]statusUpdate, 0, len(targets))
+	for range checked {
+		if update := <-results; !update.cancelled {
+			updates = append(updates, update)
+		}
 	}
-	numberOfStatusUpdatesReceived := 0
-	for update := range updateChannel {
-		statusState[update.item] = update.state
-		numberOfStatusUpdatesReceived++
-		if numberOfStatusUpdatesReceived == len(config) {
-			close(updateChannel)
+	updates = append(updates, reportedUpdates(targets, time.Now())...)
+
+	applied := updates[:0]
+	stateMu.Lock()
+	for _, update := range updates {
+		previous, known := statusState[update.item]
+		// the target may have been removed while it was checked
+		if known {
+			update.state = mergeStatusState(previous, update.state)
+			statusState[update.item] = update.state
+			applied = append(applied, update)
 		}
 	}
+	updateCompositeStates()
+	composites := make(map[string]bool, len(config.Composites))
+	for _, composite := range config.Composites {
+		composites[composite.Name] = statusState[composite.Name].Healthy
+	}
+	stateMu.Unlock()
+
+	now := time.Now()
+	for _, update := range applied {
+		observeLatency(update.item, update.state.ResponseTime, buckets)
+		recordSample(update.item, update.state, now)
+		observeAnomaly(update.item, update.state, anomaly)
+		if slos[update.item] {
+			recordBurn(update.item, update.state.Healthy, now)
+		}
+		recordUptime(update.item, update.state.Healthy, now)
+		events.writeCheck(update)
+	}
+	for name, healthy := range composites {
+		recordUptime(name, healthy, now)
+	}
 }
 
 func saveStatusState(views []StatusView, dataPath string) error {
 	// saves the current state to a json file
 	file, err := os.Create(dataPath + "status_state.json")
 	if err != nil {
-		log.Printf("Error creating file: %s", err)
+		slog.Error("Error creating file", "error", err)
 		return err
 	}
-	defer file.Close()
 
 	encoder := json.NewEncoder(file)
 	encoder.SetIndent("", "  ")
 	if err := encoder.Encode(views); err != nil {
-		log.Printf("Error encoding JSON to file: %s", err)
+		file.Close()
+		slog.Error("Error encoding JSON to file", "error", err)
 		return err
 	}
-	return nil
+	// writes may only fail when closing, e.g. if the disk is full
+	return file.Close()
+}
+
+// significantState encodes the views without the fields that change with
+// every check, it only differs if an item changed.
+func significantState(views []StatusView) ([]byte, error) {
+	stripped := make([]StatusView, len(views))
+	for i, view := range views {
+		view.ResponseTime = 0
+		view.LastHealth, view.LastUnhealthy = 0, 0
+		view.LastHealthyTime, view.LastUnhealthyTime = "", ""
+		stripped[i] = view
+	}
+	return json.Marshal(stripped)
 }
 
 func loadStatusState(dataPath string) ([]StatusView, error) {
@@ -190,20 +328,176 @@ func loadStatusState(dataPath string) ([]StatusView, error) {
 	}
 
 	// Convert the loaded status views back to the map format
+	stateMu.Lock()
+	defer stateMu.Unlock()
 	for _, statusView := range statusViews {
 		statusState[statusView.Url] = StatusState{
-			Healthy:       statusView.Healthy,
-			LastHealthy:   time.Unix(statusView.LastHealth, 0),
-			LastUnhealthy: time.Unix(statusView.LastUnhealthy, 0),
-			ResponseCode:  statusView.ResponseCode,
-			ResponseTime:  time.Duration(statusView.ResponseTime) * time.Millisecond,
+			Healthy:         statusView.Healthy,
+			LastHealthy:     time.Unix(statusView.LastHealth, 0),
+			LastUnhealthy:   time.Unix(statusView.LastUnhealthy, 0),
+			ResponseCode:    statusView.ResponseCode,
+			ResponseTime:    time.Duration(statusView.ResponseTime) * time.Millisecond,
+			Protocol:        statusView.Protocol,
+			Http3Advertised: statusView.Http3Advertised,
 		}
 	}
 
 	return statusViews, nil
 }
 
+// statusPayload is the public status sent over /v2/ws and /v2/status-json,
+// /ws and /status-json only send its items as in their original format.
+// Stream and Seq are the cursor of the round, a websocket client reconnecting
+// with ?delta=1&stream=<stream>&since=<seq> gets the deltas it missed instead
+// of the full payload if they are still kept.
+type statusPayload struct {
+	Stream        string         `json:"stream"`
+	Seq           uint64         `json:"seq"`
+	Summary       summary        `json:"summary"`
+	Items         []StatusView   `json:"items"`
+	Announcements []Announcement `json:"announcements"`
+	Maintenance   []Maintenance  `json:"maintenance"`
+}
+
+// statusDelta is sent to websocket clients connected with ?delta=1 after
+// every round instead of the full payload, which they get once on connect.
+// Items hold the url and the fields that changed since the previous round
+// of the changed items, fields that are gone are null. Removed are the items
+// that are gone.
+type statusDelta struct {
+	Delta         bool                         `json:"delta"`
+	Stream        string                       `json:"stream"`
+	Seq           uint64                       `json:"seq"`
+	Summary       summary                      `json:"summary"`
+	Items         []map[string]json.RawMessage `json:"items"`
+	Removed       []string                     `json:"removed"`
+	Announcements []Announcement               `json:"announcements"`
+	Maintenance   []Maintenance                `json:"maintenance"`
+}
+
+// wsStream identifies the rounds of this process, the seq of a round starts
+// at one again after a restart.
+var wsStream = randomHex(8)
+
+// broadcastSeq is the seq of the latest round, it is only used by the check
+// loop.
+var broadcastSeq uint64
+
+// lastBroadcast are the encoded fields of the items of the previous round by
+// namespace, it is only used by the check loop.
+var lastBroadcast = make(map[string]map[string]map[string]json.RawMessage)
+
+// broadcastDelta returns the changes of the payload of namespace since the
+// previous call.
+func broadcastDelta(payload statusPayload, namespace string) (statusDelta, error) {
+	delta := statusDelta{
+		Delta:         true,
+		Stream:        payload.Stream,
+		Seq:           payload.Seq,
+		Summary:       payload.Summary,
+		Items:         []map[string]json.RawMessage{},
+		Removed:       []string{},
+		Announcements: payload.Announcements,
+		Maintenance:   payload.Maintenance,
+	}
+	current := make(map[string]map[string]json.RawMessage, len(payload.Items))
+	for _, view := range payload.Items {
+		encoded, err := json.Marshal(view)
+		if err != nil {
+			return delta, err
+		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(encoded, &fields); err != nil {
+			return delta, err
+		}
+		current[view.Url] = fields
+
+		previous := lastBroadcast[namespace][view.Url]
+		changed := make(map[string]json.RawMessage)
+		for name, value := range fields {
+			if !bytes.Equal(previous[name], value) {
+				changed[name] = value
+			}
+		}
+		for name := range previous {
+			if _, ok := fields[name]; !ok {
+				changed[name] = json.RawMessage("null")
+			}
+		}
+		if len(changed) > 0 {
+			changed["url"] = fields["url"]
+			delta.Items = append(delta.Items, changed)
+		}
+	}
+	for item := range lastBroadcast[namespace] {
+		if _, ok := current[item]; !ok {
+			delta.Removed = append(delta.Removed, item)
+		}
+	}
+	sort.Strings(delta.Removed)
+	lastBroadcast[namespace] = current
+	return delta, nil
+}
+
+// currentStatusPayload returns the payload of the status page of namespace,
+// announcements are only shown on the main page.
+func currentStatusPayload(views []StatusView, namespace string) statusPayload {
+	now := time.Now()
+	public := publicViewsIn(views, namespace)
+	announcements := []Announcement{}
+	if namespace == "" {
+		announcements = activeAnnouncements(now)
+	}
+	return statusPayload{
+		Stream:        wsStream,
+		Summary:       computeSummary(public, now),
+		Items:         public,
+		Announcements: announcements,
+		Maintenance:   publicMaintenance(now, namespace),
+	}
+}
+
+// encodedPayload is a status payload encoded as a whole and, for /ws and
+// /status-json, only its items. The payload is kept for binary websocket
+// clients.
+type encodedPayload struct {
+	payload statusPayload
+	full    []byte
+	items   []byte
+}
+
+func encodePayload(payload statusPayload) (encodedPayload, error) {
+	full, err := json.Marshal(payload)
+	if err != nil {
+		return encodedPayload{}, err
+	}
+	items, err := json.Marshal(payload.Items)
+	if err != nil {
+		return encodedPayload{}, err
+	}
+	return encodedPayload{payload: payload, full: full, items: items}, nil
+}
+
+// cachedStatus are the encoded payloads of the latest check round by
+// namespace, served by /status-json and sent to new websocket clients
+// without encoding them again. It is nil until the first round is complete.
+var cachedStatus atomic.Pointer[map[string]encodedPayload]
+
+// encodedStatus returns the cached payload of namespace, or encodes the
+// current one before the first round.
+func encodedStatus(namespace string) (encodedPayload, error) {
+	if cached := cachedStatus.Load(); cached != nil {
+		if encoded, ok := (*cached)[namespace]; ok {
+			return encoded, nil
+		}
+	}
+	return encodePayload(currentStatusPayload(StatusStatesToView(), namespace))
+}
+
 func StatusStatesToView() []StatusView {
+	stateMu.RLock()
+	defer stateMu.RUnlock()
+
 	var statusViews []StatusView
 	for item, state := range statusState {
 		statusViews = append(statusViews, state.toStatusView(item))
@@ -215,46 +509,103 @@ func StatusStatesToView() []StatusView {
 }
 
 func (s StatusState) toStatusView(item string) StatusView {
+	name, description, group := describeItem(item)
 	return StatusView{
 		Url:           item,
+		Name:          name,
+		Description:   description,
+		Group:         group,
 		Healthy:       s.Healthy,
 		LastHealth:    s.LastHealthy.Unix(),
 		LastUnhealthy: s.LastUnhealthy.Unix(),
-		ResponseCode:  s.ResponseCode,
-		ResponseTime:  s.ResponseTime.Milliseconds(),
+
+		LastHealthyTime:   formatTimestamp(s.LastHealthy),
+		LastUnhealthyTime: formatTimestamp(s.LastUnhealthy),
+
+		ResponseCode:    s.ResponseCode,
+		ResponseTime:    s.ResponseTime.Milliseconds(),
+		Protocol:        s.Protocol,
+		Http3Advertised: s.Http3Advertised,
+		Degraded:        isDegraded(item),
+		Members:         compositeMembers(item),
+		Problems:        s.Problems,
+		Metadata:        itemMetadata(item),
+	}
+}
+
+// formatTimestamp formats t as RFC 3339 in displayLocation, the caller has to
+// hold stateMu.
+func formatTimestamp(t time.Time) string {
+	// loaded from the state file a zero time is unix 0
+	if t.Unix() <= 0 {
+		return ""
 	}
+	return t.In(displayLocation).Format(time.RFC3339)
 }
 
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
+	// JSON is used without a subprotocol too
+	Subprotocols: []string{"msgpack", "json"},
+	// the page is public and may be embedded anywhere unless page access is
+	// set, see pageOriginCheck
 	CheckOrigin: func(r *http.Request) bool {
-		return true // Allow all origins (for development)
+		return true
 	},
 }
 
-var wsConnections = make(map[*websocket.Conn]interface{})
-
-func handleConnections(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		log.Fatal(err)
+// pageOriginCheck returns the origin check of websockets for a protected page.
+// Browsers send the basic auth credentials and the cookie of the page token
+// with websockets of other sites too, so only the pages of the host of the
+// request or of publicUrl may connect. Requests without an Origin header
+// aren't sent by browsers and pass.
+func pageOriginCheck(publicUrl string) func(r *http.Request) bool {
+	var publicHost string
+	if u, err := url.Parse(publicUrl); err == nil {
+		publicHost = u.Host
 	}
-	wsConnections[conn] = nil
-
-	defer func() {
-		if err := conn.Close(); err != nil {
-			log.Printf("Error closing connection: %s", err)
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
 		}
-		delete(wsConnections, conn)
-	}()
+		u, err := url.Parse(origin)
+		if err != nil || u.Host == "" {
+			return false
+		}
+		return strings.EqualFold(u.Host, r.Host) || (publicHost != "" && strings.EqualFold(u.Host, publicHost))
+	}
+}
+
+// handleConnections serves the websocket of /v2/ws, or the one of /ws that
+// only sends the items if legacy is set.
+func handleConnections(legacy bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		serveWebsocket(w, r, legacy)
+	}
+}
 
-	statusView := StatusStatesToView()
-	err = conn.WriteJSON(statusView)
+func serveWebsocket(w http.ResponseWriter, r *http.Request, legacy bool) {
+	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("Error writing to websocket: %s", err)
-		delete(wsConnections, conn)
+		websocketLog.Warn("Error upgrading websocket connection", "remote", r.RemoteAddr, "error", err)
+		return
+	}
+	client := &wsClient{
+		conn:   conn,
+		legacy: legacy,
+		delta:  !legacy && r.URL.Query().Get("delta") == "1",
+		binary: conn.Subprotocol() == "msgpack",
+		stream: r.URL.Query().Get("stream"),
+		// empty on /ws and /v2/ws for the main page
+		namespace: r.PathValue("namespace"),
+		send:      make(chan []byte, wsSendBuffer+wsReplayRounds),
 	}
+	// an invalid cursor gets the full payload like a new client
+	client.since, _ = strconv.ParseUint(r.URL.Query().Get("since"), 10, 64)
+	hub.register <- client
+	go client.write()
 
 	for {
 		_, _, err := conn.ReadMessage()
@@ -262,65 +613,122 @@ func handleConnections(w http.ResponseWriter, r *http.Request) {
 			break
 		}
 	}
-
+	hub.unregister <- client
+	conn.Close()
 }
 
-func main() {
-
-	args := parseArgs()
-	parseConfig(args.configPath)
-	fmt.Println(config)
-
-	http.Handle("/", http.FileServer(http.Dir(args.staticPath)))
+// broadcastStatus caches the payloads of a round and sends them to the
+// websocket clients, they are encoded once for /status-json and all clients
+// of a namespace.
+func broadcastStatus(views []StatusView) {
+	broadcastSeq++
+	names := namespaceNames()
+	encoded := make(map[string]encodedPayload, len(names))
+	broadcasts := make(map[string]*wsBroadcast, len(names))
+	for _, namespace := range names {
+		payload := currentStatusPayload(views, namespace)
+		payload.Seq = broadcastSeq
+		full, err := encodePayload(payload)
+		if err != nil {
+			websocketLog.Error("Error encoding the status", "namespace", namespace, "error", err)
+			continue
+		}
+		encoded[namespace] = full
+		b := &wsBroadcast{seq: broadcastSeq, encoded: full}
+		delta, err := broadcastDelta(payload, namespace)
+		if err == nil {
+			b.deltaPayload = delta
+			b.delta, err = json.Marshal(delta)
+		}
+		if err != nil {
+			websocketLog.Error("Error computing the status delta, sending the full status", "namespace", namespace, "error", err)
+			b.delta = nil
+		}
+		broadcasts[namespace] = b
+	}
+	for namespace := range lastBroadcast {
+		if !slices.Contains(names, namespace) {
+			delete(lastBroadcast, namespace)
+		}
+	}
+	cachedStatus.Store(&encoded)
+	hub.broadcast <- broadcasts
+}
 
-	http.HandleFunc("/status-json", func(w http.ResponseWriter, r *http.Request) {
-		statusViews := StatusStatesToView()
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(statusViews)
-	})
+type command struct {
+	name        string
+	description string
+	run         func(arguments []string) int
+	// flags returns the flags of the command, used for shell completion
+	flags func() *flag.FlagSet
+	// hidden commands are not listed in the usage
+	hidden bool
+}
 
-	http.HandleFunc("/ws", handleConnections)
+var commands []command
+
+func init() {
+	// initialized here as the completion command refers to the list
+	commands = []command{
+		{name: "serve", description: "run the checker and serve the status page (default)", run: runServe,
+			flags: func() *flag.FlagSet { return newServeFlagSet(&args{}) }},
+		{name: "init", description: "create a starter config", run: runInit,
+			flags: func() *flag.FlagSet { return newInitFlagSet(&initArgs{}) }},
+		{name: "check", description: "run all checks once and print the results", run: runCheck,
+			flags: func() *flag.FlagSet { return newCheckFlagSet(&checkArgs{}) }},
+		{name: "validate", description: "validate the config file", run: runValidate,
+			flags: func() *flag.FlagSet { return newValidateFlagSet(new(string)) }},
+		{name: "migrate-config", description: "convert a config file or an Uptime Kuma backup to the current format", run: runMigrateConfig,
+			flags: func() *flag.FlagSet { return newMigrateConfigFlagSet(new(string), new(string), new(string)) }},
+		{name: "healthcheck", description: "exit with 0 if the local instance is healthy, for container health checks", run: runHealthcheck,
+			flags: func() *flag.FlagSet { return newHealthcheckFlagSet(&healthcheckArgs{}) }},
+		{name: "update", description: "replace the binary with the latest release", run: runUpdate,
+			flags: func() *flag.FlagSet { return newUpdateFlagSet(&updateArgs{}) }},
+		{name: "version", description: "print the version", run: runVersion,
+			flags: newVersionFlagSet},
+		{name: "service", description: "install, uninstall, start or stop the Windows service", run: runService,
+			flags: func() *flag.FlagSet { return newServiceFlagSet(new(string)) }},
+		{name: "completion", description: "print a bash, zsh or fish completion script", run: runCompletion,
+			flags: newCompletionFlagSet},
+		{name: completeTargetsCommand, run: runCompleteTargets, hidden: true,
+			flags: func() *flag.FlagSet { return newValidateFlagSet(new(string)) }},
+	}
+}
 
-	go func() {
-		fmt.Println("Starting server at :8081")
-		if err := http.ListenAndServe(":8081", nil); err != nil {
-			fmt.Println("Error starting server:", err)
+func printUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [command] [flags]\n\nCommands:\n", os.Args[0])
+	for _, cmd := range commands {
+		if !cmd.hidden {
+			fmt.Fprintf(os.Stderr, "  %-16s %s\n", cmd.name, cmd.description)
 		}
-	}()
+	}
+	fmt.Fprintf(os.Stderr, "\nRun '%s <command> -h' for the flags of a command.\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "Every flag can also be set with an environment variable, e.g. %s for --config of serve and %s for --output of check.\n", envName("serve", "config"), envName("check", "output"))
+}
 
-	_, err := loadStatusState(args.dataPath)
-	if err != nil {
-		log.Printf("Error loading status state: %s", err)
+func main() {
+	// without a command the flags are passed to serve, which keeps existing
+	// invocations like "status-checker -c config.json" working
+	name := "serve"
+	arguments := os.Args[1:]
+	if len(arguments) > 0 && !strings.HasPrefix(arguments[0], "-") {
+		name, arguments = arguments[0], arguments[1:]
+	} else if len(arguments) > 0 && (arguments[0] == "--version" || arguments[0] == "-version") {
+		name, arguments = "version", arguments[1:]
 	}
 
-	for {
-		updateStatusState()
-		log.Print("Currently connected clients: ", len(wsConnections))
-		statusView := StatusStatesToView()
-		err := saveStatusState(statusView, args.dataPath)
-		if err != nil {
-			if errors.Is(err, syscall.ENOENT) {
-				log.Printf("File not found while saving status state: %s", err)
-				log.Printf("Creating directory: %s", args.dataPath)
-				err := os.MkdirAll(args.dataPath, os.ModePerm)
-				if err != nil {
-					log.Printf("Error creating directory: %s", err)
-				} else {
-					log.Printf("Retrying to save status state")
-					err = saveStatusState(statusView, args.dataPath)
-				}
-			} else {
-				log.Printf("Error saving status state: %s", err)
-			}
-		}
-		for conn := range wsConnections {
-			err := conn.WriteJSON(statusView)
-			if err != nil {
-				log.Printf("Error writing to websocket: %s", err)
-				delete(wsConnections, conn)
-			}
+	if name == "help" {
+		printUsage()
+		os.Exit(0)
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == name {
+			os.Exit(cmd.run(arguments))
 		}
-		time.Sleep(time.Duration(args.timeout) * time.Second)
 	}
 
+	fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", name)
+	printUsage()
+	os.Exit(2)
 }
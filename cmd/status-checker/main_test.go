@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// applyTestConfig applies c with a fresh state and restores the previous
+// config once the test is done.
+func applyTestConfig(tb testing.TB, c Config) {
+	tb.Helper()
+	previous := config
+	stateMu.Lock()
+	statusState = make(map[string]StatusState)
+	stateMu.Unlock()
+	applyConfig(c)
+	tb.Cleanup(func() {
+		stateMu.Lock()
+		statusState = make(map[string]StatusState)
+		stateMu.Unlock()
+		applyConfig(previous)
+	})
+}
+
+// benchmarkTargets is the size of the config of the benchmarks, large enough
+// that lookups which search the config for every item dominate a round.
+const benchmarkTargets = 5000
+
+// applyBenchmarkConfig applies a config of benchmarkTargets targets, every
+// tenth one private, and a composite for every hundred of them.
+func applyBenchmarkConfig(b *testing.B) {
+	b.Helper()
+	private := false
+	parsed := Config{}
+	for i := range benchmarkTargets {
+		target := Target{Url: fmt.Sprintf("https://service-%d.example.com/", i), Name: fmt.Sprintf("Service %d", i), Group: fmt.Sprintf("Group %d", i%20)}
+		if i%10 == 0 {
+			target.Public = &private
+		}
+		parsed.Targets = append(parsed.Targets, target)
+	}
+	for i := 0; i < benchmarkTargets; i += 100 {
+		composite := Composite{Name: fmt.Sprintf("Region %d", i/100)}
+		for _, target := range parsed.Targets[i : i+100] {
+			composite.Members = append(composite.Members, target.Url)
+		}
+		parsed.Composites = append(parsed.Composites, composite)
+	}
+
+	applyTestConfig(b, parsed)
+}
+
+func BenchmarkStatusStatesToView(b *testing.B) {
+	applyBenchmarkConfig(b)
+	for b.Loop() {
+		StatusStatesToView()
+	}
+}
+
+func BenchmarkPublicViews(b *testing.B) {
+	applyBenchmarkConfig(b)
+	views := StatusStatesToView()
+	for b.Loop() {
+		publicViews(views)
+	}
+}
+
+func BenchmarkComputeSummary(b *testing.B) {
+	applyBenchmarkConfig(b)
+	views := publicViews(StatusStatesToView())
+	now := time.Now()
+	for b.Loop() {
+		computeSummary(views, now)
+	}
+}
+
+// BenchmarkStatusPayload is the work of a check round for the status page,
+// the views, the public payload and its encoding.
+func BenchmarkStatusPayload(b *testing.B) {
+	applyBenchmarkConfig(b)
+	for b.Loop() {
+		if _, err := encodePayload(currentStatusPayload(StatusStatesToView(), "")); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
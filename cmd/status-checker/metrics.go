@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// metricsPrefix is prepended to the name of every exported metric.
+const metricsPrefix = "status_checker_"
+
+type metricKind string
+
+const (
+	metricGauge     metricKind = "gauge"
+	metricCounter   metricKind = "counter"
+	metricHistogram metricKind = "histogram"
+)
+
+type metricLabel struct {
+	name  string
+	value string
+}
+
+type metricSample struct {
+	labels []metricLabel
+	value  float64
+}
+
+type histogramSample struct {
+	labels    []metricLabel
+	histogram latencyHistogram
+}
+
+// metric has samples or, for metricHistogram, histograms.
+type metric struct {
+	name       string
+	help       string
+	kind       metricKind
+	samples    []metricSample
+	histograms []histogramSample
+}
+
+func gaugeMetric(name string, help string, value float64) metric {
+	return metric{name: name, help: help, kind: metricGauge, samples: []metricSample{{value: value}}}
+}
+
+func counterMetric(name string, help string, value float64) metric {
+	return metric{name: name, help: help, kind: metricCounter, samples: []metricSample{{value: value}}}
+}
+
+// selfMetrics are the internal operational metrics of the checker.
+var selfMetrics struct {
+	rounds               atomic.Int64
+	lastRoundDuration    atomic.Int64 // nanoseconds
+	checks               atomic.Int64
+	checksQueued         atomic.Int64 // waiting for a slot of the host limiter
+	checksRunning        atomic.Int64
+	notifications        atomic.Int64
+	notificationFailures atomic.Int64
+}
+
+// collectMetrics returns the state of the visible targets and composites,
+// all of them if visible is nil, and the internal metrics of the checker.
+// visible is called with stateMu held.
+func collectMetrics(visible func(item string) bool) []metric {
+	up := metric{name: "up", help: "whether the target or composite is healthy", kind: metricGauge}
+	responseTime := metric{name: "response_time_seconds", help: "response time of the last check", kind: metricGauge}
+	responseCode := metric{name: "response_code", help: "http status code of the last check, 0 if there was no response", kind: metricGauge}
+	lastHealthy := metric{name: "last_healthy_timestamp_seconds", help: "time the target was last seen healthy", kind: metricGauge}
+	lastUnhealthy := metric{name: "last_unhealthy_timestamp_seconds", help: "time the target was last seen unhealthy", kind: metricGauge}
+
+	views := StatusStatesToView()
+	if visible != nil {
+		stateMu.RLock()
+		views = slices.DeleteFunc(views, func(view StatusView) bool { return !visible(view.Url) })
+		stateMu.RUnlock()
+	}
+	for _, view := range views {
+		labels := []metricLabel{{"target", view.Url}}
+		up.samples = append(up.samples, metricSample{labels, boolMetricValue(view.Healthy)})
+		responseTime.samples = append(responseTime.samples, metricSample{labels, float64(view.ResponseTime) / 1000})
+		responseCode.samples = append(responseCode.samples, metricSample{labels, float64(view.ResponseCode)})
+		// never seen healthy or unhealthy
+		if view.LastHealth > 0 {
+			lastHealthy.samples = append(lastHealthy.samples, metricSample{labels, float64(view.LastHealth)})
+		}
+		if view.LastUnhealthy > 0 {
+			lastUnhealthy.samples = append(lastUnhealthy.samples, metricSample{labels, float64(view.LastUnhealthy)})
+		}
+	}
+
+	info := currentVersionInfo()
+	buildInfo := gaugeMetric("build_info", "version of the running checker", 1)
+	buildInfo.samples[0].labels = []metricLabel{{"version", info.Version}, {"commit", info.Commit}, {"goversion", info.GoVersion}}
+
+	return []metric{
+		up, responseTime, responseCode, lastHealthy, lastUnhealthy, latencyMetric(visible),
+		buildInfo,
+		gaugeMetric("start_time_seconds", "time the checker was started", float64(startTime.Unix())),
+		counterMetric("check_rounds_total", "number of completed check rounds", float64(selfMetrics.rounds.Load())),
+		gaugeMetric("check_round_duration_seconds", "duration of the last check round", time.Duration(selfMetrics.lastRoundDuration.Load()).Seconds()),
+		counterMetric("checks_total", "number of completed checks", float64(selfMetrics.checks.Load())),
+		gaugeMetric("checks_queued", "checks waiting for the per host limit", float64(selfMetrics.checksQueued.Load())),
+		gaugeMetric("checks_running", "checks currently running", float64(selfMetrics.checksRunning.Load())),
+		counterMetric("notifications_total", "number of sent notifications", float64(selfMetrics.notifications.Load())),
+		counterMetric("notification_failures_total", "number of notifications that couldn't be sent", float64(selfMetrics.notificationFailures.Load())),
+		gaugeMetric("websocket_clients", "number of connected websocket clients", float64(hub.clients.Load())),
+		counterMetric("websocket_clients_dropped_total", "number of websocket clients disconnected for being too slow", float64(hub.dropped.Load())),
+		gaugeMetric("goroutines", "number of goroutines", float64(runtime.NumGoroutine())),
+	}
+}
+
+func boolMetricValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// handleMetrics serves the metrics of the public items of the main page to
+// the clients allowed to see the page. Clients with an API token get all
+// items, or with a token of a namespace its items besides the public ones.
+func handleMetrics(tokens []apiToken, page func(http.Handler) http.Handler) http.Handler {
+	public := page(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serveMetrics(w, isPublic)
+	}))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := matchingToken(tokens, r)
+		if !ok || !token.allows(scopeRead) {
+			public.ServeHTTP(w, r)
+			return
+		}
+		if token.Namespace == "" {
+			serveMetrics(w, nil)
+			return
+		}
+		serveMetrics(w, func(item string) bool {
+			return isPublic(item) || itemNamespace(item) == token.Namespace
+		})
+	})
+}
+
+// serveMetrics writes the metrics of the visible items, see collectMetrics.
+func serveMetrics(w http.ResponseWriter, visible func(item string) bool) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	writePrometheusMetrics(w, metricsPrefix, collectMetrics(visible))
+}
+
+// writePrometheusMetrics writes the metrics with the prefix prepended to
+// their names in the Prometheus text exposition format.
+func writePrometheusMetrics(w io.Writer, prefix string, metrics []metric) {
+	for _, m := range metrics {
+		name := prefix + m.name
+		fmt.Fprintf(w, "# HELP %s %s\n", name, m.help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", name, m.kind)
+		for _, sample := range m.samples {
+			fmt.Fprintf(w, "%s%s %s\n", name, prometheusLabels(sample.labels), prometheusValue(sample.value))
+		}
+		for _, h := range m.histograms {
+			// prometheus buckets are cumulative
+			var cumulative uint64
+			for i, count := range h.histogram.Counts {
+				cumulative += count
+				le := math.Inf(1)
+				if i < len(h.histogram.Bounds) {
+					le = h.histogram.Bounds[i]
+				}
+				labels := append([]metricLabel{{"le", prometheusValue(le)}}, h.labels...)
+				fmt.Fprintf(w, "%s_bucket%s %d\n", name, prometheusLabels(labels), cumulative)
+			}
+			fmt.Fprintf(w, "%s_sum%s %s\n", name, prometheusLabels(h.labels), prometheusValue(h.histogram.Sum))
+			fmt.Fprintf(w, "%s_count%s %d\n", name, prometheusLabels(h.labels), h.histogram.Count)
+		}
+	}
+}
+
+func prometheusLabels(labels []metricLabel) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	pairs := make([]string, 0, len(labels))
+	for _, label := range labels {
+		pairs = append(pairs, label.name+`="`+escaper.Replace(label.value)+`"`)
+	}
+	sort.Strings(pairs)
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func prometheusValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MQTT 3.1.1 control packet types, shifted into the upper nibble of the
+// first byte.
+const (
+	mqttConnect    = 1 << 4
+	mqttConnack    = 2 << 4
+	mqttPublish    = 3 << 4
+	mqttPingreq    = 12 << 4
+	mqttDisconnect = 14 << 4
+)
+
+const (
+	mqttKeepAlive    = 60 * time.Second
+	mqttWriteTimeout = 10 * time.Second
+)
+
+type mqttArgs struct {
+	url             string
+	topicPrefix     string
+	clientId        string
+	discoveryPrefix string
+}
+
+// mqttPublisher publishes retained messages after every check round:
+// <prefix>status is online or offline, also as last will if the checker
+// dies, <prefix>summary the summary of /api/summary and
+// <prefix>targets/<escaped item> the view of every target and composite.
+// Messages are sent with QoS 0, a failed connection is retried in the next
+// round. With a discovery prefix the items are announced to Home Assistant,
+// see homeAssistantDiscovery.
+type mqttPublisher struct {
+	address  string
+	tls      *tls.Config // nil for plain mqtt://
+	user     string
+	password string
+	clientId string
+	prefix   string
+
+	discoveryPrefix string
+	// discovered maps the discovery topics of the announced items to their
+	// config, rediscover is set on connect to announce them again.
+	discovered map[string]string
+	rediscover bool
+
+	mu   sync.Mutex
+	conn net.Conn // nil while disconnected
+	done chan struct{}
+	// busy is set while a round is published so a slow broker doesn't
+	// delay the check loop, rounds are skipped until it is done.
+	busy atomic.Bool
+}
+
+// mqtt is nil if no MQTT broker is configured.
+var mqtt *mqttPublisher
+
+func setupMqtt(args mqttArgs) error {
+	if args.url == "" {
+		return nil
+	}
+	parsed, err := url.Parse(args.url)
+	if err != nil {
+		return fmt.Errorf("invalid mqtt url: %w", err)
+	}
+	p := &mqttPublisher{prefix: args.topicPrefix, clientId: args.clientId, discoveryPrefix: strings.TrimSuffix(args.discoveryPrefix, "/")}
+	switch parsed.Scheme {
+	case "mqtt", "tcp":
+		p.address = hostWithDefaultPort(parsed.Host, "1883")
+	case "mqtts", "ssl", "tls":
+		p.address = hostWithDefaultPort(parsed.Host, "8883")
+		p.tls = &tls.Config{ServerName: parsed.Hostname()}
+	default:
+		return fmt.Errorf("invalid mqtt url scheme %q, use mqtt or mqtts", parsed.Scheme)
+	}
+	if parsed.Hostname() == "" {
+		return fmt.Errorf("mqtt url without host")
+	}
+	if strings.ContainsAny(p.prefix+p.discoveryPrefix, "+#") {
+		return fmt.Errorf("mqtt topic and discovery prefix can't contain the wildcards + and #")
+	}
+	if parsed.User != nil {
+		p.user = parsed.User.Username()
+		p.password, _ = parsed.User.Password()
+	}
+	if p.clientId == "" {
+		hostname, _ := os.Hostname()
+		p.clientId = "status-checker-" + hostname
+	}
+	mqtt = p
+	return nil
+}
+
+func hostWithDefaultPort(host string, port string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(strings.Trim(host, "[]"), port)
+}
+
+// mqttTopicEscape escapes the characters with a meaning in topic names,
+// the slashes of URLs would otherwise add topic levels.
+func mqttTopicEscape(item string) string {
+	return strings.NewReplacer("%", "%25", "/", "%2F", "+", "%2B", "#", "%23").Replace(item)
+}
+
+func appendMqttLength(packet []byte, n int) []byte {
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		packet = append(packet, b)
+		if n == 0 {
+			return packet
+		}
+	}
+}
+
+func appendMqttString(packet []byte, s []byte) []byte {
+	packet = binary.BigEndian.AppendUint16(packet, uint16(len(s)))
+	return append(packet, s...)
+}
+
+func mqttPacket(header byte, body []byte) []byte {
+	packet := appendMqttLength([]byte{header}, len(body))
+	return append(packet, body...)
+}
+
+func mqttPublishPacket(topic string, payload []byte) []byte {
+	const retain = 1
+	body := appendMqttString(nil, []byte(topic))
+	return mqttPacket(mqttPublish|retain, append(body, payload...))
+}
+
+func (p *mqttPublisher) connectPacket() []byte {
+	const (
+		cleanSession = 1 << 1
+		will         = 1 << 2
+		willRetain   = 1 << 5
+		password     = 1 << 6
+		user         = 1 << 7
+	)
+	flags := byte(cleanSession | will | willRetain)
+	if p.user != "" {
+		flags |= user
+	}
+	if p.password != "" {
+		flags |= password
+	}
+
+	body := appendMqttString(nil, []byte("MQTT"))
+	body = append(body, 4, flags) // protocol level 4 is MQTT 3.1.1
+	body = binary.BigEndian.AppendUint16(body, uint16(mqttKeepAlive/time.Second))
+	body = appendMqttString(body, []byte(p.clientId))
+	body = appendMqttString(body, []byte(p.prefix+"status"))
+	body = appendMqttString(body, []byte("offline"))
+	if p.user != "" {
+		body = appendMqttString(body, []byte(p.user))
+	}
+	if p.password != "" {
+		body = appendMqttString(body, []byte(p.password))
+	}
+	return mqttPacket(mqttConnect, body)
+}
+
+var mqttConnectErrors = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "client id rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+// connect opens the connection and announces the checker as online, the
+// caller has to hold p.mu.
+func (p *mqttPublisher) connect() error {
+	dialer := &net.Dialer{Timeout: mqttWriteTimeout}
+	var conn net.Conn
+	var err error
+	if p.tls != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", p.address, p.tls)
+	} else {
+		conn, err = dialer.Dial("tcp", p.address)
+	}
+	if err != nil {
+		return err
+	}
+
+	conn.SetDeadline(time.Now().Add(mqttWriteTimeout))
+	var connack [4]byte
+	if _, err := conn.Write(p.connectPacket()); err != nil {
+		conn.Close()
+		return err
+	}
+	if _, err := io.ReadFull(conn, connack[:]); err != nil {
+		conn.Close()
+		return fmt.Errorf("reading connack: %w", err)
+	}
+	if connack[0] != mqttConnack || connack[1] != 2 {
+		conn.Close()
+		return fmt.Errorf("unexpected packet %#x instead of connack", connack[0])
+	}
+	if code := connack[3]; code != 0 {
+		conn.Close()
+		return fmt.Errorf("connection refused: %s", mqttConnectErrors[code])
+	}
+	conn.SetDeadline(time.Time{})
+
+	p.conn = conn
+	p.done = make(chan struct{})
+	p.rediscover = true
+	go p.read(conn, p.done)
+	go p.ping(conn, p.done)
+	return p.write(mqttPublishPacket(p.prefix+"status", []byte("online")))
+}
+
+// read discards the ping responses of the broker and notices when the
+// connection is closed.
+func (p *mqttPublisher) read(conn net.Conn, done chan struct{}) {
+	reader := bufio.NewReader(conn)
+	for {
+		if _, err := reader.ReadByte(); err != nil {
+			break
+		}
+		length, shift := 0, 0
+		for {
+			b, err := reader.ReadByte()
+			if err != nil || shift > 21 {
+				length = -1
+				break
+			}
+			length |= int(b&0x7f) << shift
+			shift += 7
+			if b&0x80 == 0 {
+				break
+			}
+		}
+		if length < 0 {
+			break
+		}
+		if _, err := reader.Discard(length); err != nil {
+			break
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn == conn {
+		p.disconnect(done)
+	}
+}
+
+func (p *mqttPublisher) ping(conn net.Conn, done chan struct{}) {
+	ticker := time.NewTicker(mqttKeepAlive / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		p.mu.Lock()
+		if p.conn == conn {
+			if err := p.write([]byte{mqttPingreq, 0}); err != nil {
+				slog.Warn("Error pinging the MQTT broker", "error", err)
+				p.disconnect(done)
+			}
+		}
+		p.mu.Unlock()
+	}
+}
+
+// write sends a packet, the caller has to hold p.mu.
+func (p *mqttPublisher) write(packet []byte) error {
+	p.conn.SetWriteDeadline(time.Now().Add(mqttWriteTimeout))
+	_, err := p.conn.Write(packet)
+	return err
+}
+
+// disconnect closes the connection, the caller has to hold p.mu.
+func (p *mqttPublisher) disconnect(done chan struct{}) {
+	close(done)
+	p.conn.Close()
+	p.conn = nil
+}
+
+// publish sends the views and their summary in the background.
+func (p *mqttPublisher) publish(views []StatusView) {
+	if !p.busy.CompareAndSwap(false, true) {
+		slog.Warn("Skipping MQTT publish, the previous round is still being sent")
+		return
+	}
+
+	messages := make(map[string][]byte, len(views)+1)
+	summary, err := json.Marshal(computeSummary(publicViews(views), time.Now()))
+	if err != nil {
+		p.busy.Store(false)
+		slog.Error("Error encoding MQTT summary", "error", err)
+		return
+	}
+	messages[p.prefix+"summary"] = summary
+	for _, view := range views {
+		payload, err := json.Marshal(view)
+		if err != nil {
+			p.busy.Store(false)
+			slog.Error("Error encoding MQTT message", "target", view.Url, "error", err)
+			return
+		}
+		messages[p.prefix+"targets/"+mqttTopicEscape(view.Url)] = payload
+	}
+
+	go func() {
+		defer p.busy.Store(false)
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.conn == nil {
+			if err := p.connect(); err != nil {
+				slog.Warn("Error connecting to the MQTT broker", "address", p.address, "error", err)
+				return
+			}
+		}
+		if p.discoveryPrefix != "" {
+			discovery, err := p.discoveryMessages(views)
+			if err != nil {
+				slog.Error("Error encoding Home Assistant discovery", "error", err)
+				return
+			}
+			// announced first so the entities exist when their state arrives
+			if !p.writeMessages(discovery) {
+				return
+			}
+		}
+		p.writeMessages(messages)
+	}()
+}
+
+// writeMessages publishes the retained messages and disconnects on errors,
+// the caller has to hold p.mu.
+func (p *mqttPublisher) writeMessages(messages map[string][]byte) bool {
+	for topic, payload := range messages {
+		if err := p.write(mqttPublishPacket(topic, payload)); err != nil {
+			slog.Warn("Error publishing to the MQTT broker", "error", err)
+			p.disconnect(p.done)
+			return false
+		}
+	}
+	return true
+}
+
+// close announces the checker as offline and disconnects cleanly, the last
+// will is only sent by the broker if the connection is lost.
+func (p *mqttPublisher) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn == nil {
+		return
+	}
+	err := errors.Join(
+		p.write(mqttPublishPacket(p.prefix+"status", []byte("offline"))),
+		p.write([]byte{mqttDisconnect, 0}),
+	)
+	if err != nil {
+		slog.Warn("Error disconnecting from the MQTT broker", "error", err)
+	}
+	p.disconnect(p.done)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAppendMqttLength(t *testing.T) {
+	tests := []struct {
+		n    int
+		want []byte
+	}{
+		{0, []byte{0x00}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x80, 0x01}},
+		{16383, []byte{0xff, 0x7f}},
+		{16384, []byte{0x80, 0x80, 0x01}},
+		{2097151, []byte{0xff, 0xff, 0x7f}},
+		{2097152, []byte{0x80, 0x80, 0x80, 0x01}},
+		{268435455, []byte{0xff, 0xff, 0xff, 0x7f}},
+	}
+	for _, test := range tests {
+		if got := appendMqttLength(nil, test.n); !bytes.Equal(got, test.want) {
+			t.Errorf("appendMqttLength(%d) = % x, want % x", test.n, got, test.want)
+		}
+	}
+}
+
+func TestMqttPublishPacket(t *testing.T) {
+	tests := []struct {
+		name    string
+		topic   string
+		payload []byte
+		want    []byte
+	}{
+		{"empty payload", "a", nil, []byte{0x31, 0x03, 0x00, 0x01, 'a'}},
+		{"payload", "s/x", []byte("up"), []byte{0x31, 0x07, 0x00, 0x03, 's', '/', 'x', 'u', 'p'}},
+	}
+	for _, test := range tests {
+		if got := mqttPublishPacket(test.topic, test.payload); !bytes.Equal(got, test.want) {
+			t.Errorf("%s: mqttPublishPacket = % x, want % x", test.name, got, test.want)
+		}
+	}
+
+	// the remaining length takes two bytes from 128 bytes on
+	packet := mqttPublishPacket("t", bytes.Repeat([]byte{'x'}, 200))
+	if want := []byte{0x31, 0xcb, 0x01, 0x00, 0x01, 't'}; !bytes.HasPrefix(packet, want) || len(packet) != 206 {
+		t.Errorf("long mqttPublishPacket starts with % x and has %d bytes, want % x and 206", packet[:6], len(packet), want)
+	}
+}
+
+func TestMqttConnectPacket(t *testing.T) {
+	header := func(flags byte, length byte) []byte {
+		return []byte{0x10, length, 0x00, 0x04, 'M', 'Q', 'T', 'T', 0x04, flags, 0x00, 0x3c}
+	}
+	will := []byte{0x00, 0x08, 'p', '/', 's', 't', 'a', 't', 'u', 's', 0x00, 0x07, 'o', 'f', 'f', 'l', 'i', 'n', 'e'}
+
+	tests := []struct {
+		name      string
+		publisher *mqttPublisher
+		want      [][]byte
+	}{
+		{"anonymous", &mqttPublisher{clientId: "c", prefix: "p/"},
+			[][]byte{header(0x26, 32), {0x00, 0x01, 'c'}, will}},
+		{"user", &mqttPublisher{clientId: "c", prefix: "p/", user: "u"},
+			[][]byte{header(0xa6, 35), {0x00, 0x01, 'c'}, will, {0x00, 0x01, 'u'}}},
+		{"user and password", &mqttPublisher{clientId: "c", prefix: "p/", user: "u", password: "pw"},
+			[][]byte{header(0xe6, 39), {0x00, 0x01, 'c'}, will, {0x00, 0x01, 'u'}, {0x00, 0x02, 'p', 'w'}}},
+	}
+	for _, test := range tests {
+		if got, want := test.publisher.connectPacket(), bytes.Join(test.want, nil); !bytes.Equal(got, want) {
+			t.Errorf("%s: connectPacket = % x, want % x", test.name, got, want)
+		}
+	}
+}
+
+func TestMqttTopicEscape(t *testing.T) {
+	tests := []struct {
+		item string
+		want string
+	}{
+		{"Checkout", "Checkout"},
+		{"https://example.com/health", "https:%2F%2Fexample.com%2Fhealth"},
+		{"a+b#c", "a%2Bb%23c"},
+		{"100%/x", "100%25%2Fx"},
+	}
+	for _, test := range tests {
+		if got := mqttTopicEscape(test.item); got != test.want {
+			t.Errorf("mqttTopicEscape(%q) = %q, want %q", test.item, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// msgpackMarshal encodes v as MessagePack with the fields of its JSON
+// encoding, so binary websocket clients get the same payloads without them
+// being encoded as JSON first. Struct fields follow their json tags, values
+// with their own JSON encoding like time.Time and json.RawMessage are
+// converted from it with msgpackFromJSON.
+func msgpackMarshal(v any) ([]byte, error) {
+	return appendMsgpack(nil, reflect.ValueOf(v))
+}
+
+var jsonMarshalerType = reflect.TypeFor[json.Marshaler]()
+
+func appendMsgpack(packed []byte, v reflect.Value) ([]byte, error) {
+	if !v.IsValid() {
+		return append(packed, 0xc0), nil
+	}
+	if v.Type().Implements(jsonMarshalerType) && (v.Kind() != reflect.Pointer || !v.IsNil()) {
+		encoded, err := v.Interface().(json.Marshaler).MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		converted, err := msgpackFromJSON(encoded)
+		if err != nil {
+			return nil, err
+		}
+		return append(packed, converted...), nil
+	}
+
+	var err error
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return append(packed, 0xc0), nil
+		}
+		return appendMsgpack(packed, v.Elem())
+	case reflect.String:
+		return appendMsgpackString(packed, v.String()), nil
+	case reflect.Bool:
+		if v.Bool() {
+			return append(packed, 0xc3), nil
+		}
+		return append(packed, 0xc2), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return appendMsgpackInt(packed, v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if u := v.Uint(); u > math.MaxInt64 {
+			return binary.BigEndian.AppendUint64(append(packed, 0xcf), u), nil
+		}
+		return appendMsgpackInt(packed, int64(v.Uint())), nil
+	case reflect.Float32, reflect.Float64:
+		return appendMsgpackFloat(packed, v.Float()), nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return append(packed, 0xc0), nil
+		}
+		packed = appendMsgpackHeader(packed, v.Len(), 0x90, 0xdc)
+		for i := range v.Len() {
+			if packed, err = appendMsgpack(packed, v.Index(i)); err != nil {
+				return nil, err
+			}
+		}
+		return packed, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return append(packed, 0xc0), nil
+		}
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("can't encode %s as MessagePack, map keys have to be strings", v.Type())
+		}
+		// sorted like the keys of encoding/json
+		keys := v.MapKeys()
+		slices.SortFunc(keys, func(a, b reflect.Value) int { return strings.Compare(a.String(), b.String()) })
+		packed = appendMsgpackHeader(packed, len(keys), 0x80, 0xde)
+		for _, key := range keys {
+			packed = appendMsgpackString(packed, key.String())
+			if packed, err = appendMsgpack(packed, v.MapIndex(key)); err != nil {
+				return nil, err
+			}
+		}
+		return packed, nil
+	case reflect.Struct:
+		return appendMsgpackStruct(packed, v)
+	}
+	return nil, fmt.Errorf("can't encode %s as MessagePack", v.Type())
+}
+
+// appendMsgpackStruct encodes the exported fields of a struct as a map like
+// encoding/json, with the names and the omitempty and omitzero options of
+// their json tags.
+func appendMsgpackStruct(packed []byte, v reflect.Value) ([]byte, error) {
+	var fields []byte
+	n := 0
+	for i := range v.NumField() {
+		field := v.Type().Field(i)
+		if field.Anonymous {
+			return nil, fmt.Errorf("can't encode %s as MessagePack, embedded fields aren't supported", v.Type())
+		}
+		tag := field.Tag.Get("json")
+		if !field.IsExported() || tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = field.Name
+		}
+		value := v.Field(i)
+		if omitted(value, strings.Split(options, ",")) {
+			continue
+		}
+		fields = appendMsgpackString(fields, name)
+		var err error
+		if fields, err = appendMsgpack(fields, value); err != nil {
+			return nil, err
+		}
+		n++
+	}
+	packed = appendMsgpackHeader(packed, n, 0x80, 0xde)
+	return append(packed, fields...), nil
+}
+
+// omitted reports whether a field with the json tag options is left out.
+func omitted(v reflect.Value, options []string) bool {
+	if slices.Contains(options, "omitempty") {
+		switch v.Kind() {
+		case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+			if v.Len() == 0 {
+				return true
+			}
+		case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+			reflect.Float32, reflect.Float64, reflect.Interface, reflect.Pointer:
+			if v.IsZero() {
+				return true
+			}
+		}
+	}
+	if slices.Contains(options, "omitzero") {
+		if zero, ok := v.Interface().(interface{ IsZero() bool }); ok {
+			return zero.IsZero()
+		}
+		return v.IsZero()
+	}
+	return false
+}
+
+// msgpackFromJSON converts encoded JSON to MessagePack with the same
+// structure. Integers are encoded as integers, other numbers as float64.
+func msgpackFromJSON(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return appendMsgpackValue(nil, decoder)
+}
+
+func appendMsgpackValue(packed []byte, decoder *json.Decoder) ([]byte, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch value := token.(type) {
+	case json.Delim:
+		// the length comes first, so the elements are encoded separately
+		var elements []byte
+		n := 0
+		for decoder.More() {
+			if value == '{' {
+				key, err := decoder.Token()
+				if err != nil {
+					return nil, err
+				}
+				elements = appendMsgpackString(elements, key.(string))
+			}
+			if elements, err = appendMsgpackValue(elements, decoder); err != nil {
+				return nil, err
+			}
+			n++
+		}
+		if _, err := decoder.Token(); err != nil {
+			return nil, err
+		}
+		if value == '{' {
+			packed = appendMsgpackHeader(packed, n, 0x80, 0xde)
+		} else {
+			packed = appendMsgpackHeader(packed, n, 0x90, 0xdc)
+		}
+		return append(packed, elements...), nil
+	case string:
+		return appendMsgpackString(packed, value), nil
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			return appendMsgpackInt(packed, i), nil
+		}
+		f, err := value.Float64()
+		if err != nil {
+			return nil, err
+		}
+		return appendMsgpackFloat(packed, f), nil
+	case bool:
+		if value {
+			return append(packed, 0xc3), nil
+		}
+		return append(packed, 0xc2), nil
+	case nil:
+		return append(packed, 0xc0), nil
+	}
+	return nil, fmt.Errorf("unexpected JSON token %v", token)
+}
+
+// appendMsgpackHeader appends the header of a map or array, fix is the
+// format of up to 15 elements and wide the one with a 16 bit length, which
+// is followed by the one with a 32 bit length.
+func appendMsgpackHeader(packed []byte, n int, fix byte, wide byte) []byte {
+	switch {
+	case n < 16:
+		return append(packed, fix|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(packed, wide), uint16(n))
+	}
+	return binary.BigEndian.AppendUint32(append(packed, wide+1), uint32(n))
+}
+
+func appendMsgpackString(packed []byte, s string) []byte {
+	switch n := len(s); {
+	case n < 32:
+		packed = append(packed, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		packed = append(packed, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		packed = binary.BigEndian.AppendUint16(append(packed, 0xda), uint16(n))
+	default:
+		packed = binary.BigEndian.AppendUint32(append(packed, 0xdb), uint32(n))
+	}
+	return append(packed, s...)
+}
+
+func appendMsgpackFloat(packed []byte, f float64) []byte {
+	return binary.BigEndian.AppendUint64(append(packed, 0xcb), math.Float64bits(f))
+}
+
+// appendMsgpackInt uses the shortest format for i.
+func appendMsgpackInt(packed []byte, i int64) []byte {
+	switch {
+	case i >= 0 && i < 128, i < 0 && i >= -32:
+		return append(packed, byte(i))
+	case i >= 0 && i <= math.MaxUint8:
+		return append(packed, 0xcc, byte(i))
+	case i >= 0 && i <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(packed, 0xcd), uint16(i))
+	case i >= 0 && i <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(packed, 0xce), uint32(i))
+	case i >= 0:
+		return binary.BigEndian.AppendUint64(append(packed, 0xcf), uint64(i))
+	case i >= math.MinInt8:
+		return append(packed, 0xd0, byte(i))
+	case i >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(packed, 0xd1), uint16(i))
+	case i >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(packed, 0xd2), uint32(i))
+	}
+	return binary.BigEndian.AppendUint64(append(packed, 0xd3), uint64(i))
+}
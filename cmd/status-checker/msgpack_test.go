@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMsgpackFromJSON(t *testing.T) {
+	tests := []struct {
+		json string
+		want []byte
+	}{
+		{`null`, []byte{0xc0}},
+		{`true`, []byte{0xc3}},
+		{`false`, []byte{0xc2}},
+		{`0`, []byte{0x00}},
+		{`127`, []byte{0x7f}},
+		{`128`, []byte{0xcc, 0x80}},
+		{`65535`, []byte{0xcd, 0xff, 0xff}},
+		{`65536`, []byte{0xce, 0x00, 0x01, 0x00, 0x00}},
+		{`4294967296`, []byte{0xcf, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00}},
+		{`-1`, []byte{0xff}},
+		{`-32`, []byte{0xe0}},
+		{`-33`, []byte{0xd0, 0xdf}},
+		{`-129`, []byte{0xd1, 0xff, 0x7f}},
+		{`-32769`, []byte{0xd2, 0xff, 0xff, 0x7f, 0xff}},
+		{`1.5`, []byte{0xcb, 0x3f, 0xf8, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
+		{`""`, []byte{0xa0}},
+		{`"abc"`, []byte{0xa3, 'a', 'b', 'c'}},
+		{`[]`, []byte{0x90}},
+		{`[1,"a"]`, []byte{0x92, 0x01, 0xa1, 'a'}},
+		{`{}`, []byte{0x80}},
+		{`{"a":1,"b":[true]}`, []byte{0x82, 0xa1, 'a', 0x01, 0xa1, 'b', 0x91, 0xc3}},
+	}
+	for _, test := range tests {
+		got, err := msgpackFromJSON([]byte(test.json))
+		if err != nil {
+			t.Errorf("msgpackFromJSON(%s): %v", test.json, err)
+			continue
+		}
+		if !bytes.Equal(got, test.want) {
+			t.Errorf("msgpackFromJSON(%s) = % x, want % x", test.json, got, test.want)
+		}
+	}
+
+	for _, invalid := range []string{``, `[1,`, `{"a"}`, `tru`} {
+		if _, err := msgpackFromJSON([]byte(invalid)); err == nil {
+			t.Errorf("msgpackFromJSON(%q) succeeded", invalid)
+		}
+	}
+}
+
+func TestMsgpackLengths(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  any
+		header []byte
+	}{
+		{"fixstr", strings.Repeat("a", 31), []byte{0xbf}},
+		{"str8", strings.Repeat("a", 32), []byte{0xd9, 32}},
+		{"str16", strings.Repeat("a", 256), []byte{0xda, 0x01, 0x00}},
+		{"str32", strings.Repeat("a", 65536), []byte{0xdb, 0x00, 0x01, 0x00, 0x00}},
+		{"fixarray", make([]bool, 15), []byte{0x9f}},
+		{"array16", make([]bool, 16), []byte{0xdc, 0x00, 0x10}},
+		{"array32", make([]bool, 65536), []byte{0xdd, 0x00, 0x01, 0x00, 0x00}},
+	}
+	for _, test := range tests {
+		got, err := msgpackMarshal(test.value)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !bytes.HasPrefix(got, test.header) {
+			t.Errorf("%s starts with % x, want % x", test.name, got[:min(len(got), 5)], test.header)
+		}
+	}
+}
+
+func TestMsgpackMarshal(t *testing.T) {
+	type tagged struct {
+		Name     string    `json:"name"`
+		Empty    string    `json:"empty,omitempty"`
+		Zero     time.Time `json:"zero,omitzero"`
+		Skipped  int       `json:"-"`
+		Untagged bool
+		hidden   int
+	}
+
+	tests := []struct {
+		name  string
+		value any
+		want  []byte
+	}{
+		{"nil", nil, []byte{0xc0}},
+		{"uint64", uint64(1 << 63), []byte{0xcf, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
+		{"integral float", 2.0, []byte{0xcb, 0x40, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
+		{"nil slice", []string(nil), []byte{0xc0}},
+		{"empty slice", []string{}, []byte{0x90}},
+		{"nil pointer", (*SLO)(nil), []byte{0xc0}},
+		{"sorted map", map[string]int{"b": 2, "a": 1}, []byte{0x82, 0xa1, 'a', 0x01, 0xa1, 'b', 0x02}},
+		{"raw message", json.RawMessage(`{"a":null}`), []byte{0x81, 0xa1, 'a', 0xc0}},
+		{"time", time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC), append([]byte{0xb4}, "2026-01-02T03:04:05Z"...)},
+		{"struct", tagged{Name: "x", Skipped: 1, Untagged: true, hidden: 1}, []byte{0x82, 0xa4, 'n', 'a', 'm', 'e', 0xa1, 'x', 0xa8, 'U', 'n', 't', 'a', 'g', 'g', 'e', 'd', 0xc3}},
+	}
+	for _, test := range tests {
+		got, err := msgpackMarshal(test.value)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !bytes.Equal(got, test.want) {
+			t.Errorf("%s = % x, want % x", test.name, got, test.want)
+		}
+	}
+
+	for name, value := range map[string]any{
+		"int keys":    map[int]string{1: "a"},
+		"channel":     make(chan int),
+		"invalid raw": json.RawMessage(`{`),
+	} {
+		if _, err := msgpackMarshal(value); err == nil {
+			t.Errorf("%s: encoded without an error", name)
+		}
+	}
+}
+
+// TestMsgpackMatchesJSON checks that the payloads have the fields of their
+// JSON encoding. The numbers aren't integral, their format would differ as
+// the conversion from JSON can't tell integral floats and integers apart.
+func TestMsgpackMatchesJSON(t *testing.T) {
+	payload := statusPayload{
+		Stream:  "stream",
+		Seq:     42,
+		Summary: summary{Status: overallPartialOutage, Total: 2, Unhealthy: 1, TotalWeight: 1.5, UnhealthyWeight: 0.5, UnhealthyItems: []string{"https://b.example.com/"}, DegradedItems: []string{}},
+		Items: []StatusView{
+			{Url: "https://a.example.com/", Name: "A", Healthy: true, LastHealth: 1767322800, LastHealthyTime: "2026-01-02T03:00:00Z", ResponseCode: 200, ResponseTime: 12, Protocol: "HTTP/2.0", Http3Advertised: true, Metadata: map[string]any{"team": "ops", "ratio": 0.25, "tags": []any{"x", nil}, "owner": map[string]any{"on call": true}}},
+			{Url: "https://b.example.com/", Members: []string{"https://a.example.com/"}, Problems: []string{"api"}},
+		},
+		Announcements: []Announcement{{Id: "1", Title: "Upgrade", Severity: "info", Start: time.Date(2026, 1, 2, 3, 4, 5, 6, time.FixedZone("", 3600))}},
+		Maintenance:   []Maintenance{{Id: "2", Start: time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC), End: time.Date(2026, 1, 3, 0, 0, 0, 0, time.UTC)}},
+	}
+	delta := statusDelta{Delta: true, Stream: "stream", Seq: 43, Summary: payload.Summary, Items: []map[string]json.RawMessage{{"url": json.RawMessage(`"https://a.example.com/"`), "healthy": json.RawMessage(`false`)}}, Removed: []string{}}
+
+	for name, value := range map[string]any{"payload": payload, "items": payload.Items, "delta": delta} {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := msgpackFromJSON(encoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := msgpackMarshal(value)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s as MessagePack differs from its JSON\n got % x\nwant % x", name, got, want)
+		}
+	}
+}
+
+func TestEncodedPayloadMessage(t *testing.T) {
+	payload := statusPayload{Stream: wsStream, Seq: 1, Items: []StatusView{{Url: "https://a.example.com/", Healthy: true}}, Announcements: []Announcement{}, Maintenance: []Maintenance{}}
+	encoded, err := encodePayload(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packedFull, _ := msgpackMarshal(payload)
+	packedItems, _ := msgpackMarshal(payload.Items)
+
+	tests := []struct {
+		name   string
+		client wsClient
+		want   []byte
+	}{
+		{"json", wsClient{}, encoded.full},
+		{"legacy json", wsClient{legacy: true}, encoded.items},
+		{"msgpack", wsClient{binary: true}, packedFull},
+		{"legacy msgpack", wsClient{binary: true, legacy: true}, packedItems},
+	}
+	for _, test := range tests {
+		got, err := encoded.message(&test.client)
+		if err != nil || !bytes.Equal(got, test.want) {
+			t.Errorf("message for a %s client = %q, %v, want %q", test.name, got, err, test.want)
+		}
+	}
+}
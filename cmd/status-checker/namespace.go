@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+)
+
+// Namespace is an isolated project hosted by the instance. Its targets and
+// composites are only shown on its own status page at /ns/<name>/, their
+// state changes only go to its webhooks and API tokens of the namespace can
+// only manage its targets. Items without a namespace are on the main page
+// and go to the notifiers of the config.
+type Namespace struct {
+	Name     string     `json:"name"`
+	Page     PageConfig `json:"page,omitzero"`
+	Webhooks []Webhook  `json:"webhooks,omitempty"`
+}
+
+var namespaceNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+func (n Namespace) validate() error {
+	if !namespaceNamePattern.MatchString(n.Name) {
+		return fmt.Errorf("namespace name %q may only contain lowercase letters, digits and -", n.Name)
+	}
+	for _, webhook := range n.Webhooks {
+		if webhook.Url == "" {
+			return fmt.Errorf("webhook of namespace %q without url", n.Name)
+		}
+	}
+	if err := n.Page.validate(); err != nil {
+		return fmt.Errorf("namespace %q: %w", n.Name, err)
+	}
+	return nil
+}
+
+func (c Config) namespace(name string) (Namespace, bool) {
+	i := slices.IndexFunc(c.Namespaces, func(n Namespace) bool { return n.Name == name })
+	if i < 0 {
+		return Namespace{}, false
+	}
+	return c.Namespaces[i], true
+}
+
+// namespaceNames returns the main namespace "" and the configured ones.
+func namespaceNames() []string {
+	stateMu.RLock()
+	defer stateMu.RUnlock()
+	names := []string{""}
+	for _, namespace := range config.Namespaces {
+		names = append(names, namespace.Name)
+	}
+	return names
+}
+
+// itemNamespace returns the namespace of a target or composite, the caller
+// has to hold stateMu.
+func itemNamespace(item string) string {
+	switch i := configItems[item]; {
+	case i.target != nil:
+		return i.target.Namespace
+	case i.composite != nil:
+		return i.composite.Namespace
+	}
+	return ""
+}
+
+// pageConfig returns the page config of the main page or a namespace, the
+// caller has to hold stateMu.
+func (c Config) pageConfig(namespace string) PageConfig {
+	if namespace == "" {
+		return c.Page
+	}
+	n, _ := c.namespace(namespace)
+	return n.Page
+}
+
+// requireNamespace responds 404 to requests for namespaces that aren't
+// configured, the namespace is the path value of the /ns/{namespace}/ routes.
+func requireNamespace(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stateMu.RLock()
+		_, ok := config.namespace(r.PathValue("namespace"))
+		stateMu.RUnlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// namespaceKey is the context key of the namespace of the API token, which
+// is empty for tokens of the whole instance.
+type namespaceKey struct{}
+
+func tokenNamespace(r *http.Request) string {
+	namespace, _ := r.Context().Value(namespaceKey{}).(string)
+	return namespace
+}
+
+// targetsAllowed reports whether the token of the request may act on the
+// targets. No targets stands for all of them, which only tokens of the
+// whole instance may act on. The caller has to hold stateMu.
+func targetsAllowed(r *http.Request, targets []string) bool {
+	namespace := tokenNamespace(r)
+	if namespace == "" {
+		return true
+	}
+	if len(targets) == 0 {
+		return false
+	}
+	for _, target := range targets {
+		if _, ok := configTarget(target); !ok || itemNamespace(target) != namespace {
+			return false
+		}
+	}
+	return true
+}
+
+// instanceOnly rejects the tokens of namespaces, for routes affecting the
+// whole instance.
+func instanceOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if namespace := tokenNamespace(r); namespace != "" {
+			http.Error(w, fmt.Sprintf("tokens of namespace %q can't use this route", namespace), http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// allowTargets responds 403 and returns false if the token of the request
+// may not act on the targets, see targetsAllowed.
+func allowTargets(w http.ResponseWriter, r *http.Request, targets []string) bool {
+	stateMu.RLock()
+	ok := targetsAllowed(r, targets)
+	stateMu.RUnlock()
+	if !ok {
+		http.Error(w, fmt.Sprintf("tokens of namespace %q can only act on its targets", tokenNamespace(r)), http.StatusForbidden)
+	}
+	return ok
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+)
+
+// applyNamespaceConfig applies a config with a target on the main page and
+// the namespace acme with a public and a private target and a composite of
+// both.
+func applyNamespaceConfig(t *testing.T) {
+	t.Helper()
+	private := false
+	applyTestConfig(t, Config{
+		Namespaces: []Namespace{{Name: "acme"}},
+		Targets: []Target{
+			{Url: "https://main.example.com/"},
+			{Url: "https://shop.acme.example/", Namespace: "acme"},
+			{Url: "https://internal.acme.example/", Namespace: "acme", Public: &private},
+		},
+		Composites: []Composite{{Name: "Acme", Namespace: "acme", Members: []string{"https://shop.acme.example/", "https://internal.acme.example/"}}},
+	})
+}
+
+func TestNamespaceValidate(t *testing.T) {
+	tests := []struct {
+		namespace Namespace
+		valid     bool
+	}{
+		{Namespace{Name: "acme"}, true},
+		{Namespace{Name: "team-2"}, true},
+		{Namespace{Name: ""}, false},
+		{Namespace{Name: "-acme"}, false},
+		{Namespace{Name: "Acme"}, false},
+		{Namespace{Name: "acme/shop"}, false},
+		{Namespace{Name: "acme", Webhooks: []Webhook{{}}}, false},
+	}
+	for _, test := range tests {
+		if err := test.namespace.validate(); (err == nil) != test.valid {
+			t.Errorf("validate(%+v) = %v, want valid %t", test.namespace, err, test.valid)
+		}
+	}
+
+	for name, c := range map[string]Config{
+		"unknown namespace of a target":    {Targets: []Target{{Url: "https://a.example.com/", Namespace: "acme"}}},
+		"duplicate namespace":              {Namespaces: []Namespace{{Name: "acme"}, {Name: "acme"}}},
+		"member of another namespace":      {Namespaces: []Namespace{{Name: "acme"}}, Targets: []Target{{Url: "https://a.example.com/"}}, Composites: []Composite{{Name: "Acme", Namespace: "acme", Members: []string{"https://a.example.com/"}}}},
+		"unknown namespace of a composite": {Targets: []Target{{Url: "https://a.example.com/"}}, Composites: []Composite{{Name: "Acme", Namespace: "acme", Members: []string{"https://a.example.com/"}}}},
+	} {
+		if err := c.validate(); err == nil {
+			t.Errorf("%s: validate succeeded", name)
+		}
+	}
+}
+
+func TestCurrentStatusPayloadNamespaces(t *testing.T) {
+	applyNamespaceConfig(t)
+	views := StatusStatesToView()
+
+	tests := []struct {
+		namespace string
+		items     []string
+		members   []string
+	}{
+		{"", []string{"https://main.example.com/"}, nil},
+		{"acme", []string{"Acme", "https://shop.acme.example/"}, []string{"https://shop.acme.example/"}},
+	}
+	for _, test := range tests {
+		payload := currentStatusPayload(views, test.namespace)
+		var items, members []string
+		for _, item := range payload.Items {
+			items = append(items, item.Url)
+			members = append(members, item.Members...)
+		}
+		slices.Sort(items)
+		if !slices.Equal(items, test.items) || !slices.Equal(members, test.members) {
+			t.Errorf("items of namespace %q = %v with members %v, want %v with %v", test.namespace, items, members, test.items, test.members)
+		}
+		if payload.Summary.Total != len(test.items) {
+			t.Errorf("summary of namespace %q counts %d items, want %d", test.namespace, payload.Summary.Total, len(test.items))
+		}
+	}
+}
+
+func TestHandleTargetDetailNamespaces(t *testing.T) {
+	applyNamespaceConfig(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/targets/{target}", handleTargetDetail)
+	mux.Handle("GET /ns/{namespace}/api/targets/{target}", requireNamespace(http.HandlerFunc(handleTargetDetail)))
+
+	tests := []struct {
+		name    string
+		path    string
+		status  int
+		members []string
+	}{
+		{"main page", "/api/targets/" + url.PathEscape("https://main.example.com/"), http.StatusOK, nil},
+		{"namespace target on the main page", "/api/targets/" + url.PathEscape("https://shop.acme.example/"), http.StatusNotFound, nil},
+		{"namespace", "/ns/acme/api/targets/" + url.PathEscape("https://shop.acme.example/"), http.StatusOK, nil},
+		{"main target in a namespace", "/ns/acme/api/targets/" + url.PathEscape("https://main.example.com/"), http.StatusNotFound, nil},
+		{"private", "/ns/acme/api/targets/" + url.PathEscape("https://internal.acme.example/"), http.StatusNotFound, nil},
+		{"composite without private members", "/ns/acme/api/targets/Acme", http.StatusOK, []string{"https://shop.acme.example/"}},
+		{"unknown namespace", "/ns/other/api/targets/Acme", http.StatusNotFound, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+			if w.Code != test.status {
+				t.Fatalf("status = %d, want %d", w.Code, test.status)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var detail StatusView
+			if err := json.Unmarshal(w.Body.Bytes(), &detail); err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(detail.Members, test.members) {
+				t.Errorf("members = %v, want %v", detail.Members, test.members)
+			}
+		})
+	}
+}
+
+func TestTargetsAllowed(t *testing.T) {
+	applyNamespaceConfig(t)
+	tests := []struct {
+		namespace string
+		targets   []string
+		allowed   bool
+	}{
+		{"", nil, true},
+		{"", []string{"https://shop.acme.example/", "https://main.example.com/"}, true},
+		{"acme", nil, false},
+		{"acme", []string{"https://shop.acme.example/", "https://internal.acme.example/"}, true},
+		{"acme", []string{"https://shop.acme.example/", "https://main.example.com/"}, false},
+		{"acme", []string{"https://unknown.example.com/"}, false},
+		// composites are not targets
+		{"acme", []string{"Acme"}, false},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/api/silences", nil)
+		r = r.WithContext(context.WithValue(r.Context(), namespaceKey{}, test.namespace))
+		stateMu.RLock()
+		allowed := targetsAllowed(r, test.targets)
+		stateMu.RUnlock()
+		if allowed != test.allowed {
+			t.Errorf("targetsAllowed(%q, %v) = %t, want %t", test.namespace, test.targets, allowed, test.allowed)
+		}
+	}
+}
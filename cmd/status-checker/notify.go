@@ -0,0 +1,460 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// stateChange describes a target or composite switching between healthy and
+// unhealthy.
+type stateChange struct {
+	Target       string    `json:"target"`
+	Healthy      bool      `json:"healthy"`
+	ResponseCode int       `json:"responseCode"`
+	Time         time.Time `json:"time"`
+}
+
+type notifier interface {
+	notify(change stateChange) error
+}
+
+// alert is a condition of an item besides its health, e.g. a latency
+// anomaly. Firing is false once the condition ended.
+type alert struct {
+	Target  string    `json:"target"`
+	Alert   string    `json:"alert"`
+	Firing  bool      `json:"firing"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// Kinds of alerts.
+const (
+	alertLatencyAnomaly = "latencyAnomaly"
+	alertSloBurnRate    = "sloBurnRate"
+)
+
+// alertNotifier is implemented by the notifiers that can send alerts too.
+type alertNotifier interface {
+	notifyAlert(a alert) error
+}
+
+// Webhook is a URL that receives a JSON POST request for every state change
+// and alert, alerts have an alert field. If Secret is set, requests are
+// signed, see signWebhook.
+type Webhook struct {
+	Url    string `json:"url"`
+	Secret string `json:"secret,omitempty"`
+}
+
+// Headers of signed webhook requests.
+const (
+	webhookIdHeader        = "X-Webhook-Id"
+	webhookTimestampHeader = "X-Webhook-Timestamp"
+	webhookSignatureHeader = "X-Signature"
+)
+
+// signWebhook adds a unique id, the current unix time and the signature
+// sha256=<hex HMAC-SHA256 of "<id>.<timestamp>.<body>" with the secret> to
+// the request. Receivers verify the signature and reject requests whose
+// timestamp is outside their replay window, e.g. older than five minutes,
+// or whose id they have already seen.
+func signWebhook(req *http.Request, secret string, body []byte, now time.Time) {
+	id := randomHex(16)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(id + "." + timestamp + "."))
+	mac.Write(body)
+
+	req.Header.Set(webhookIdHeader, id)
+	req.Header.Set(webhookTimestampHeader, timestamp)
+	req.Header.Set(webhookSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+}
+
+type webhookNotifier struct {
+	webhook Webhook
+	client  *http.Client
+}
+
+func (n webhookNotifier) notify(change stateChange) error {
+	return n.post(change)
+}
+
+func (n webhookNotifier) notifyAlert(a alert) error {
+	return n.post(a)
+}
+
+func (n webhookNotifier) post(payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, n.webhook.Url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.webhook.Secret != "" {
+		signWebhook(req, n.webhook.Secret, body, time.Now())
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s responded with status %d", n.webhook.Url, resp.StatusCode)
+	}
+	return nil
+}
+
+// notifiers receive the state changes of items without a namespace,
+// namespaceNotifiers those of their namespace.
+var (
+	notifiers          []notifier
+	namespaceNotifiers map[string][]notifier
+)
+
+// pendingNotifications tracks notifications sent in the background so they
+// can be finished on shutdown.
+var pendingNotifications sync.WaitGroup
+
+// startTime is used to determine whether the startup grace period is over.
+var startTime = time.Now()
+
+// graceChange is an item that changed during the startup grace period, its
+// health before the first change and the latest change.
+type graceChange struct {
+	wasHealthy bool
+	latest     stateChange
+}
+
+var (
+	graceMu sync.Mutex
+	// graceChanges are the changes held back during the startup grace
+	// period by item, nil once the grace period is over and they were sent.
+	graceChanges = make(map[string]graceChange)
+)
+
+// deferStartupChanges holds the changes back during the startup grace period.
+// The first call after it returns the changes with the held back ones of the
+// items whose health differs from the one before the grace period, the others
+// recovered without anyone being notified.
+func deferStartupChanges(changes []stateChange, gracePeriod time.Duration) []stateChange {
+	graceMu.Lock()
+	defer graceMu.Unlock()
+	if graceChanges == nil {
+		return changes
+	}
+	if time.Since(startTime) < gracePeriod {
+		for _, change := range changes {
+			held, ok := graceChanges[change.Target]
+			if !ok {
+				held.wasHealthy = !change.Healthy
+			}
+			held.latest = change
+			graceChanges[change.Target] = held
+		}
+		if len(changes) > 0 {
+			stateLog.Info("Not sending notifications during startup grace period", "changes", len(changes), "remaining", gracePeriod-time.Since(startTime))
+		}
+		return nil
+	}
+
+	pending := make([]stateChange, 0, len(changes)+len(graceChanges))
+	for _, change := range changes {
+		if held, ok := graceChanges[change.Target]; ok {
+			held.latest = change
+			graceChanges[change.Target] = held
+		} else {
+			pending = append(pending, change)
+		}
+	}
+	held := 0
+	for _, change := range graceChanges {
+		if change.latest.Healthy != change.wasHealthy {
+			pending = append(pending, change.latest)
+			held++
+		}
+	}
+	if held > 0 {
+		stateLog.Info("Sending the state changes of the startup grace period", "changes", held)
+	}
+	graceChanges = nil
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].Target < pending[j].Target
+	})
+	return pending
+}
+
+// graceAlertKey identifies an alert of an item.
+type graceAlertKey struct {
+	target string
+	alert  string
+}
+
+// graceAlert is an alert that fired or ended during the startup grace period,
+// whether it was firing before and the latest one.
+type graceAlert struct {
+	wasFiring bool
+	latest    alert
+}
+
+// graceAlerts are the alerts held back during the startup grace period, nil
+// once the grace period is over and they were sent. Guarded by graceMu.
+var graceAlerts = make(map[graceAlertKey]graceAlert)
+
+// deferStartupAlerts holds the alerts back during the startup grace period
+// like deferStartupChanges does for state changes, an alert that fired and
+// ended again during it isn't sent.
+func deferStartupAlerts(alerts []alert, gracePeriod time.Duration) []alert {
+	graceMu.Lock()
+	defer graceMu.Unlock()
+	if graceAlerts == nil {
+		return alerts
+	}
+	if time.Since(startTime) < gracePeriod {
+		for _, a := range alerts {
+			key := graceAlertKey{a.Target, a.Alert}
+			held, ok := graceAlerts[key]
+			if !ok {
+				held.wasFiring = !a.Firing
+			}
+			held.latest = a
+			graceAlerts[key] = held
+		}
+		if len(alerts) > 0 {
+			stateLog.Info("Not sending alerts during startup grace period", "alerts", len(alerts), "remaining", gracePeriod-time.Since(startTime))
+		}
+		return nil
+	}
+
+	pending := make([]alert, 0, len(alerts)+len(graceAlerts))
+	for _, a := range alerts {
+		key := graceAlertKey{a.Target, a.Alert}
+		if held, ok := graceAlerts[key]; ok {
+			held.latest = a
+			graceAlerts[key] = held
+		} else {
+			pending = append(pending, a)
+		}
+	}
+	held := 0
+	for _, a := range graceAlerts {
+		if a.latest.Firing != a.wasFiring {
+			pending = append(pending, a.latest)
+			held++
+		}
+	}
+	if held > 0 {
+		stateLog.Info("Sending the alerts of the startup grace period", "alerts", held)
+	}
+	graceAlerts = nil
+	sort.Slice(pending, func(i, j int) bool {
+		if pending[i].Target != pending[j].Target {
+			return pending[i].Target < pending[j].Target
+		}
+		return pending[i].Alert < pending[j].Alert
+	})
+	return pending
+}
+
+func setupNotifiers() {
+	client := &http.Client{Timeout: 10 * time.Second}
+	for _, webhook := range config.Webhooks {
+		notifiers = append(notifiers, webhookNotifier{webhook: webhook, client: client})
+	}
+	if config.Statuspage != nil {
+		notifiers = append(notifiers, statuspageNotifier{statuspage: *config.Statuspage, client: client})
+	}
+	for _, trap := range config.SnmpTraps {
+		notifiers = append(notifiers, snmpTrapNotifier{trap: trap})
+	}
+	for _, bus := range config.EventBuses {
+		notifiers = append(notifiers, eventBusNotifier{bus: bus})
+	}
+	if config.Syslog != nil {
+		notifiers = append(notifiers, syslogNotifier{syslog: *config.Syslog})
+	}
+	namespaceNotifiers = make(map[string][]notifier)
+	for _, namespace := range config.Namespaces {
+		for _, webhook := range namespace.Webhooks {
+			namespaceNotifiers[namespace.Name] = append(namespaceNotifiers[namespace.Name], webhookNotifier{webhook: webhook, client: client})
+		}
+	}
+}
+
+// snapshotHealth returns the current health of all items so state changes can
+// be detected after the next check round.
+func snapshotHealth() map[string]bool {
+	stateMu.RLock()
+	defer stateMu.RUnlock()
+
+	health := make(map[string]bool, len(statusState))
+	for item, state := range statusState {
+		health[item] = state.Healthy
+	}
+	return health
+}
+
+// detectStateChanges compares the current state to a previous snapshot taken
+// with snapshotHealth.
+func detectStateChanges(previous map[string]bool) []stateChange {
+	stateMu.RLock()
+	defer stateMu.RUnlock()
+
+	var changes []stateChange
+	for item, state := range statusState {
+		wasHealthy, known := previous[item]
+		if !known || wasHealthy == state.Healthy {
+			continue
+		}
+		changes = append(changes, stateChange{
+			Target:       item,
+			Healthy:      state.Healthy,
+			ResponseCode: state.ResponseCode,
+			Time:         time.Now(),
+		})
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Target < changes[j].Target
+	})
+	return changes
+}
+
+// notifyStateChanges logs the state changes and sends them to all notifiers
+// once the startup grace period is over, see deferStartupChanges. Notifiers
+// are called in the background so a slow receiver doesn't delay the check
+// loop.
+func notifyStateChanges(changes []stateChange, gracePeriod time.Duration) {
+	for _, change := range changes {
+		stateLog.Info("State changed", "target", change.Target, "state", healthState(change.Healthy), "responseCode", change.ResponseCode)
+		events.writeStateChange(change)
+	}
+
+	if len(notifiers) == 0 && len(namespaceNotifiers) == 0 {
+		return
+	}
+
+	// the changes of the grace period are sent after it even without
+	// changes in that round
+	changes = deferStartupChanges(changes, gracePeriod)
+	changes = slices.DeleteFunc(changes, func(change stateChange) bool {
+		return management.muted(change.Target, change.Time)
+	})
+	if len(changes) == 0 {
+		return
+	}
+
+	byNamespace := make(map[string][]stateChange)
+	stateMu.RLock()
+	for _, change := range changes {
+		namespace := itemNamespace(change.Target)
+		byNamespace[namespace] = append(byNamespace[namespace], change)
+	}
+	stateMu.RUnlock()
+	sendNotifications(notifiers, byNamespace[""])
+	for namespace, receivers := range namespaceNotifiers {
+		sendNotifications(receivers, byNamespace[namespace])
+	}
+}
+
+// sendNotifications notifies the receivers about the changes in the background.
+func sendNotifications(receivers []notifier, changes []stateChange) {
+	if len(changes) == 0 {
+		return
+	}
+	for _, n := range receivers {
+		pendingNotifications.Add(1)
+		go func(n notifier) {
+			defer pendingNotifications.Done()
+			for _, change := range changes {
+				selfMetrics.notifications.Add(1)
+				if err := n.notify(change); err != nil {
+					selfMetrics.notificationFailures.Add(1)
+					stateLog.Error("Error sending notification", "target", change.Target, "error", err)
+				}
+			}
+		}(n)
+	}
+}
+
+// notifyAlerts sends the alerts to the notifiers that support them, with the
+// same muting and startup grace period as state changes, see
+// deferStartupAlerts.
+func notifyAlerts(alerts []alert, gracePeriod time.Duration) {
+	alerts = deferStartupAlerts(alerts, gracePeriod)
+	alerts = slices.DeleteFunc(alerts, func(a alert) bool {
+		return management.muted(a.Target, a.Time)
+	})
+	if len(alerts) == 0 {
+		return
+	}
+
+	byNamespace := make(map[string][]alert)
+	stateMu.RLock()
+	for _, a := range alerts {
+		namespace := itemNamespace(a.Target)
+		byNamespace[namespace] = append(byNamespace[namespace], a)
+	}
+	stateMu.RUnlock()
+	sendAlerts(notifiers, byNamespace[""])
+	for namespace, receivers := range namespaceNotifiers {
+		sendAlerts(receivers, byNamespace[namespace])
+	}
+}
+
+func sendAlerts(receivers []notifier, alerts []alert) {
+	if len(alerts) == 0 {
+		return
+	}
+	for _, n := range receivers {
+		n, ok := n.(alertNotifier)
+		if !ok {
+			continue
+		}
+		pendingNotifications.Add(1)
+		go func() {
+			defer pendingNotifications.Done()
+			for _, a := range alerts {
+				selfMetrics.notifications.Add(1)
+				if err := n.notifyAlert(a); err != nil {
+					selfMetrics.notificationFailures.Add(1)
+					stateLog.Error("Error sending alert", "target", a.Target, "alert", a.Alert, "error", err)
+				}
+			}
+		}()
+	}
+}
+
+// waitForNotifications blocks until all pending notifications are sent or the
+// context is done.
+func waitForNotifications(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		pendingNotifications.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		slog.Warn("Not all notifications were sent before shutdown")
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingNotifier records the state changes and alerts it receives.
+type recordingNotifier struct {
+	mu      sync.Mutex
+	changes []string
+	alerts  []string
+}
+
+func (n *recordingNotifier) notify(change stateChange) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.changes = append(n.changes, change.Target)
+	return nil
+}
+
+func (n *recordingNotifier) notifyAlert(a alert) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.alerts = append(n.alerts, a.Target)
+	return nil
+}
+
+// setNotifiers makes receivers the notifiers of items without a namespace and
+// namespaced those of the namespaces for the test, with the grace period over.
+func setNotifiers(t *testing.T, receivers []notifier, namespaced map[string][]notifier) {
+	t.Helper()
+	previous, previousNamespaced := notifiers, namespaceNotifiers
+	notifiers, namespaceNotifiers = receivers, namespaced
+	resetGracePeriod(t)
+	graceMu.Lock()
+	graceChanges, graceAlerts = nil, nil
+	graceMu.Unlock()
+	t.Cleanup(func() { notifiers, namespaceNotifiers = previous, previousNamespaced })
+}
+
+// resetGracePeriod starts the held back changes and alerts over for the test.
+func resetGracePeriod(t *testing.T) {
+	t.Helper()
+	graceMu.Lock()
+	previousChanges, previousAlerts := graceChanges, graceAlerts
+	graceChanges, graceAlerts = make(map[string]graceChange), make(map[graceAlertKey]graceAlert)
+	graceMu.Unlock()
+	t.Cleanup(func() {
+		graceMu.Lock()
+		graceChanges, graceAlerts = previousChanges, previousAlerts
+		graceMu.Unlock()
+	})
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	const secret = "s3cret"
+	var (
+		mu       sync.Mutex
+		received []map[string]any
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(r.Header.Get(webhookIdHeader) + "." + r.Header.Get(webhookTimestampHeader) + "."))
+		mac.Write(body)
+		if r.Header.Get(webhookSignatureHeader) != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var payload map[string]any
+		if err := json.Unmarshal(body, &payload); err != nil || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		received = append(received, payload)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	n := webhookNotifier{webhook: Webhook{Url: server.URL, Secret: secret}, client: server.Client()}
+	if err := n.notify(stateChange{Target: "https://a.example.com/", Healthy: false, ResponseCode: 503}); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.notifyAlert(alert{Target: "https://a.example.com/", Alert: alertSloBurnRate, Firing: true}); err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != 2 || received[0]["responseCode"] != 503.0 || received[1]["alert"] != alertSloBurnRate {
+		t.Errorf("received %v, want the state change and the alert", received)
+	}
+
+	wrongSecret := webhookNotifier{webhook: Webhook{Url: server.URL, Secret: "other"}, client: server.Client()}
+	if err := wrongSecret.notify(stateChange{Target: "https://a.example.com/"}); err == nil {
+		t.Errorf("notify succeeded although the receiver rejected the signature")
+	}
+}
+
+func TestSignWebhook(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	first := httptest.NewRequest(http.MethodPost, "/", nil)
+	signWebhook(first, "secret", []byte(`{}`), now)
+	second := httptest.NewRequest(http.MethodPost, "/", nil)
+	signWebhook(second, "secret", []byte(`{}`), now)
+
+	if first.Header.Get(webhookTimestampHeader) != "1700000000" {
+		t.Errorf("timestamp = %q, want the unix time", first.Header.Get(webhookTimestampHeader))
+	}
+	// the id makes every signature unique, so requests can't be replayed
+	if first.Header.Get(webhookIdHeader) == second.Header.Get(webhookIdHeader) || first.Header.Get(webhookSignatureHeader) == second.Header.Get(webhookSignatureHeader) {
+		t.Errorf("two requests got the same id or signature")
+	}
+}
+
+func TestDeferStartupChanges(t *testing.T) {
+	resetGracePeriod(t)
+	const grace = time.Hour
+	down := func(target string) stateChange { return stateChange{Target: target, Healthy: false} }
+	up := func(target string) stateChange { return stateChange{Target: target, Healthy: true} }
+
+	if pending := deferStartupChanges([]stateChange{down("a"), down("b"), down("c")}, grace); len(pending) != 0 {
+		t.Fatalf("sent %v during the grace period", pending)
+	}
+	// b recovered during the grace period
+	deferStartupChanges([]stateChange{up("b")}, grace)
+
+	// c recovers in the first round after the grace period
+	pending := deferStartupChanges([]stateChange{up("c"), down("d")}, 0)
+	var targets []string
+	for _, change := range pending {
+		targets = append(targets, change.Target)
+	}
+	if !slices.Equal(targets, []string{"a", "d"}) {
+		t.Errorf("sent %v after the grace period, want a and d", targets)
+	}
+	if pending := deferStartupChanges([]stateChange{up("a")}, 0); len(pending) != 1 {
+		t.Errorf("sent %v once the held back changes were sent, want the change", pending)
+	}
+}
+
+func TestDeferStartupAlerts(t *testing.T) {
+	resetGracePeriod(t)
+	const grace = time.Hour
+	firing := func(target, kind string) alert { return alert{Target: target, Alert: kind, Firing: true} }
+	ended := func(target, kind string) alert { return alert{Target: target, Alert: kind, Firing: false} }
+
+	if pending := deferStartupAlerts([]alert{firing("a", alertSloBurnRate), firing("a", alertLatencyAnomaly), firing("b", alertSloBurnRate)}, grace); len(pending) != 0 {
+		t.Fatalf("sent %v during the grace period", pending)
+	}
+	// the burn rate of b ended during the grace period
+	deferStartupAlerts([]alert{ended("b", alertSloBurnRate)}, grace)
+
+	// the anomaly of a ends in the first round after the grace period
+	pending := deferStartupAlerts([]alert{ended("a", alertLatencyAnomaly), firing("c", alertLatencyAnomaly)}, 0)
+	want := []alert{firing("a", alertSloBurnRate), firing("c", alertLatencyAnomaly)}
+	if !slices.Equal(pending, want) {
+		t.Errorf("sent %v after the grace period, want %v", pending, want)
+	}
+	if pending := deferStartupAlerts([]alert{ended("a", alertSloBurnRate)}, 0); len(pending) != 1 {
+		t.Errorf("sent %v once the held back alerts were sent, want the alert", pending)
+	}
+}
+
+func TestNotifyNamespaces(t *testing.T) {
+	applyNamespaceConfig(t)
+	plain, acme, other := &recordingNotifier{}, &recordingNotifier{}, &recordingNotifier{}
+	setNotifiers(t, []notifier{plain}, map[string][]notifier{"acme": {acme}, "other": {other}})
+
+	notifyStateChanges([]stateChange{{Target: "https://main.example.com/"}, {Target: "https://shop.acme.example/"}, {Target: "Acme"}}, 0)
+	notifyAlerts([]alert{{Target: "https://shop.acme.example/", Alert: alertSloBurnRate, Firing: true}}, 0)
+	waitForNotifications(t.Context())
+
+	if !slices.Equal(plain.changes, []string{"https://main.example.com/"}) || len(plain.alerts) != 0 {
+		t.Errorf("notifiers without a namespace got %v and the alerts %v", plain.changes, plain.alerts)
+	}
+	slices.Sort(acme.changes)
+	if !slices.Equal(acme.changes, []string{"Acme", "https://shop.acme.example/"}) || !slices.Equal(acme.alerts, []string{"https://shop.acme.example/"}) {
+		t.Errorf("notifiers of the namespace got %v and the alerts %v", acme.changes, acme.alerts)
+	}
+	if len(other.changes) != 0 || len(other.alerts) != 0 {
+		t.Errorf("notifiers of another namespace got %v and the alerts %v", other.changes, other.alerts)
+	}
+}
+
+func TestNotifyMuted(t *testing.T) {
+	applyTestConfig(t, Config{Targets: []Target{{Url: "https://a.example.com/"}, {Url: "https://b.example.com/"}}})
+	receiver := &recordingNotifier{}
+	setNotifiers(t, []notifier{receiver}, nil)
+	management.mu.Lock()
+	previous := management.state.Silences
+	management.state.Silences = []Silence{{Targets: []string{"https://a.example.com/"}, Until: time.Now().Add(time.Hour)}}
+	management.mu.Unlock()
+	t.Cleanup(func() {
+		management.mu.Lock()
+		management.state.Silences = previous
+		management.mu.Unlock()
+	})
+
+	now := time.Now()
+	notifyStateChanges([]stateChange{{Target: "https://a.example.com/", Time: now}, {Target: "https://b.example.com/", Time: now}}, 0)
+	notifyAlerts([]alert{{Target: "https://a.example.com/", Alert: alertLatencyAnomaly, Firing: true, Time: now}}, 0)
+	waitForNotifications(t.Context())
+	if !slices.Equal(receiver.changes, []string{"https://b.example.com/"}) || len(receiver.alerts) != 0 {
+		t.Errorf("got %v and the alerts %v, want only the change of the item that isn't silenced", receiver.changes, receiver.alerts)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+// otlpAggregationCumulative is the temporality of all exported sums, the
+// counters are never reset while the checker runs.
+const otlpAggregationCumulative = 2
+
+type otlpMetricsPayload struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpMetric struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Gauge       *otlpGauge     `json:"gauge,omitempty"`
+	Sum         *otlpSum       `json:"sum,omitempty"`
+	Histogram   *otlpHistogram `json:"histogram,omitempty"`
+}
+
+type otlpHistogram struct {
+	DataPoints             []otlpHistogramDataPoint `json:"dataPoints"`
+	AggregationTemporality int                      `json:"aggregationTemporality"`
+}
+
+type otlpHistogramDataPoint struct {
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	TimeUnixNano      string         `json:"timeUnixNano"`
+	Count             string         `json:"count"`
+	Sum               float64        `json:"sum"`
+	BucketCounts      []string       `json:"bucketCounts"`
+	ExplicitBounds    []float64      `json:"explicitBounds"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpDataPoint `json:"dataPoints"`
+}
+
+type otlpSum struct {
+	DataPoints             []otlpDataPoint `json:"dataPoints"`
+	AggregationTemporality int             `json:"aggregationTemporality"`
+	IsMonotonic            bool            `json:"isMonotonic"`
+}
+
+type otlpDataPoint struct {
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string         `json:"timeUnixNano"`
+	AsDouble          float64        `json:"asDouble"`
+}
+
+// metricsExporter pushes the same metrics that are served on /metrics to an
+// OTLP collector. It is nil if the export is disabled.
+var metricsExporter *otlpClient
+
+func setupMetricsExport(endpoint string, interval time.Duration) {
+	if endpoint == "" || interval <= 0 {
+		return
+	}
+	metricsExporter = newOTLPClient(endpoint)
+	go func() {
+		for {
+			time.Sleep(interval)
+			exportMetrics()
+		}
+	}()
+}
+
+func exportMetrics() {
+	if metricsExporter == nil {
+		return
+	}
+
+	metrics := collectMetrics(nil)
+	payload := otlpMetricsPayload{ResourceMetrics: []otlpResourceMetrics{{
+		Resource: otlpDefaultResource(),
+		ScopeMetrics: []otlpScopeMetrics{{
+			Scope:   otlpScope{Name: "status-checker", Version: version},
+			Metrics: toOTLPMetrics(metrics, time.Now()),
+		}},
+	}}}
+	if err := metricsExporter.post("/v1/metrics", payload); err != nil {
+		slog.Error("Error exporting metrics", "metrics", len(metrics), "error", err)
+	}
+}
+
+func toOTLPMetrics(metrics []metric, now time.Time) []otlpMetric {
+	var converted []otlpMetric
+	for _, m := range metrics {
+		if m.kind == metricHistogram {
+			if len(m.histograms) > 0 {
+				converted = append(converted, toOTLPHistogram(m, now))
+			}
+			continue
+		}
+		if len(m.samples) == 0 {
+			continue
+		}
+
+		var points []otlpDataPoint
+		for _, sample := range m.samples {
+			point := otlpDataPoint{TimeUnixNano: otlpTime(now), AsDouble: sample.value}
+			for _, label := range sample.labels {
+				point.Attributes = append(point.Attributes, otlpString(label.name, label.value))
+			}
+			if m.kind == metricCounter {
+				point.StartTimeUnixNano = otlpTime(startTime)
+			}
+			points = append(points, point)
+		}
+
+		otlp := otlpMetric{Name: metricsPrefix + m.name, Description: m.help}
+		if m.kind == metricCounter {
+			otlp.Sum = &otlpSum{DataPoints: points, AggregationTemporality: otlpAggregationCumulative, IsMonotonic: true}
+		} else {
+			otlp.Gauge = &otlpGauge{DataPoints: points}
+		}
+		converted = append(converted, otlp)
+	}
+	return converted
+}
+
+func toOTLPHistogram(m metric, now time.Time) otlpMetric {
+	histogram := &otlpHistogram{AggregationTemporality: otlpAggregationCumulative}
+	for _, h := range m.histograms {
+		point := otlpHistogramDataPoint{
+			StartTimeUnixNano: otlpTime(startTime),
+			TimeUnixNano:      otlpTime(now),
+			Count:             strconv.FormatUint(h.histogram.Count, 10),
+			Sum:               h.histogram.Sum,
+			ExplicitBounds:    h.histogram.Bounds,
+		}
+		for _, label := range h.labels {
+			point.Attributes = append(point.Attributes, otlpString(label.name, label.value))
+		}
+		for _, count := range h.histogram.Counts {
+			point.BucketCounts = append(point.BucketCounts, strconv.FormatUint(count, 10))
+		}
+		histogram.DataPoints = append(histogram.DataPoints, point)
+	}
+	return otlpMetric{Name: metricsPrefix + m.name, Description: m.help, Histogram: histogram}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// PageConfig customizes the status page, the frontend reads it from
+// /api/page-config.
+type PageConfig struct {
+	Title       string       `json:"title,omitempty"`
+	LogoUrl     string       `json:"logoUrl,omitempty"`
+	Theme       PageTheme    `json:"theme,omitzero"`
+	FooterLinks []FooterLink `json:"footerLinks,omitempty"`
+	// RefreshInterval is how often in seconds the page polls /v2/status-json
+	// while the websocket isn't connected, the check interval if not set.
+	RefreshInterval int `json:"refreshInterval,omitempty"`
+
+	// Locale selects the language of the page, e.g. de, and Strings
+	// overrides single strings of it, see /api/strings.
+	Locale  string            `json:"locale,omitempty"`
+	Strings map[string]string `json:"strings,omitempty"`
+}
+
+// PageTheme are CSS colors of the status page.
+type PageTheme struct {
+	Background string `json:"background,omitempty"`
+	Text       string `json:"text,omitempty"`
+	Healthy    string `json:"healthy,omitempty"`
+	Unhealthy  string `json:"unhealthy,omitempty"`
+	Degraded   string `json:"degraded,omitempty"`
+}
+
+type FooterLink struct {
+	Text string `json:"text"`
+	Url  string `json:"url"`
+}
+
+func (p PageConfig) validate() error {
+	if p.LogoUrl != "" {
+		if _, err := url.Parse(p.LogoUrl); err != nil {
+			return fmt.Errorf("invalid page logoUrl: %w", err)
+		}
+	}
+	for _, link := range p.FooterLinks {
+		if link.Text == "" || link.Url == "" {
+			return fmt.Errorf("page footer links need a text and an url")
+		}
+		if _, err := url.Parse(link.Url); err != nil {
+			return fmt.Errorf("invalid page footer link %q: %w", link.Text, err)
+		}
+	}
+	if p.RefreshInterval < 0 {
+		return fmt.Errorf("page refreshInterval can't be negative")
+	}
+	return validateStrings(p.Strings)
+}
+
+// pageConfigResponse is the page config with the defaults applied and the
+// features the frontend has to know about.
+type pageConfigResponse struct {
+	PageConfig
+	Subscriptions bool   `json:"subscriptions"`
+	Timezone      string `json:"timezone"`
+}
+
+// handlePageConfig serves the page config, checkInterval is the default
+// refresh interval in seconds.
+func handlePageConfig(checkInterval int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// email subscriptions are only offered on the main page
+		namespace := r.PathValue("namespace")
+		stateMu.RLock()
+		response := pageConfigResponse{PageConfig: config.pageConfig(namespace), Subscriptions: subscriptions != nil && namespace == "", Timezone: displayLocation.String()}
+		stateMu.RUnlock()
+		if response.Title == "" {
+			response.Title = "Status Checker"
+		}
+		if response.RefreshInterval == 0 {
+			response.RefreshInterval = checkInterval
+		}
+		writeJSON(w, http.StatusOK, response)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// writePidFile writes the pid of the current process to path. It fails if
+// the file belongs to a process that is still running.
+func writePidFile(path string) error {
+	if content, err := os.ReadFile(path); err == nil {
+		pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+		if err == nil && pid != os.Getpid() && processRunning(pid) {
+			return fmt.Errorf("pid file %s belongs to running process %d", path, pid)
+		}
+	}
+
+	return os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644)
+}
+
+// daemonizedEnv is set for the child process started by daemonize.
+const daemonizedEnv = "STATUS_CHECKER_DAEMONIZED"
+
+func isDaemonized() bool {
+	return os.Getenv(daemonizedEnv) == "1"
+}
+
+// withoutDaemonFlag removes the daemon flag from the arguments so the
+// daemonized child doesn't daemonize again.
+func withoutDaemonFlag(arguments []string) []string {
+	var filtered []string
+	for _, argument := range arguments {
+		switch argument {
+		case "-daemon", "--daemon", "-daemon=true", "--daemon=true":
+			continue
+		}
+		filtered = append(filtered, argument)
+	}
+	return filtered
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// pingClient sends the pings to dead man's switches like healthchecks.io.
+var pingClient = &http.Client{Timeout: 10 * time.Second}
+
+// sendPing requests url in the background, with /fail appended if the check
+// failed as healthchecks.io expects it. The pings of targets added through
+// the API are sent with the managedCheckClient.
+func sendPing(url string, healthy bool, managed bool) {
+	if !healthy {
+		url = strings.TrimSuffix(url, "/") + "/fail"
+	}
+
+	pendingNotifications.Add(1)
+	go func() {
+		defer pendingNotifications.Done()
+		client := pingClient
+		if managed {
+			client = managedCheckClient
+		}
+		if err := ping(client, url); err != nil {
+			checkLog.Warn("Error sending ping", "url", url, "error", err)
+		}
+	}()
+}
+
+func ping(client *http.Client, url string) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "status-checker/"+version)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("ping responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// ProbeModule configures how /probe checks a target, like a module of the
+// Prometheus blackbox exporter.
+type ProbeModule struct {
+	// ValidStatusCodes are healthy, any 2xx code if not set.
+	ValidStatusCodes []int             `json:"validStatusCodes,omitempty"`
+	UserAgent        string            `json:"userAgent,omitempty"`
+	Headers          map[string]string `json:"headers,omitempty"`
+	// Timeout in seconds, the check timeout if not set. It is reduced to
+	// the scrape timeout of Prometheus.
+	Timeout int `json:"timeout,omitempty"`
+}
+
+// defaultProbeModule is used if the probe doesn't ask for a module of the
+// config.
+const defaultProbeModule = "http_2xx"
+
+func (m ProbeModule) healthy(statusCode int) bool {
+	if len(m.ValidStatusCodes) == 0 {
+		return statusCode >= 200 && statusCode < 300
+	}
+	return slices.Contains(m.ValidStatusCodes, statusCode)
+}
+
+// handleProbe runs a single check of the target query parameter and responds
+// with the metrics of the blackbox exporter, so its scrape configs work
+// unchanged. Probed targets are subject to the --api-target-* policy.
+func handleProbe(w http.ResponseWriter, r *http.Request) {
+	targetUrl := r.URL.Query().Get("target")
+	if targetUrl == "" {
+		http.Error(w, "target parameter is missing", http.StatusBadRequest)
+		return
+	}
+	parsed, err := url.Parse(targetUrl)
+	if err != nil {
+		http.Error(w, "invalid target: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := apiTargetPolicy.checkUrl(parsed); err != nil {
+		http.Error(w, fmt.Sprintf("%s: %s", errTargetNotAllowed, err), http.StatusForbidden)
+		return
+	}
+	moduleName := r.URL.Query().Get("module")
+	if moduleName == "" {
+		moduleName = defaultProbeModule
+	}
+
+	stateMu.RLock()
+	module, ok := config.ProbeModules[moduleName]
+	stateMu.RUnlock()
+	if !ok && moduleName != defaultProbeModule {
+		http.Error(w, fmt.Sprintf("unknown module %q", moduleName), http.StatusBadRequest)
+		return
+	}
+
+	timeout := checkClient.Timeout
+	if module.Timeout > 0 {
+		timeout = time.Duration(module.Timeout) * time.Second
+	}
+	if header := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"); header != "" {
+		// leave some time to respond
+		if seconds, err := strconv.ParseFloat(header, 64); err == nil && seconds > 0.5 {
+			timeout = min(timeout, time.Duration((seconds-0.5)*float64(time.Second)))
+		}
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	target := Target{Url: targetUrl, UserAgent: module.UserAgent, Headers: module.Headers, managed: true}
+	stateMu.RLock()
+	target.headers = config.requestHeaders(target)
+	stateMu.RUnlock()
+	start := time.Now()
+	resp, err := doCheckRequest(ctx, target, nil)
+	duration := time.Since(start)
+
+	success := false
+	statusCode := 0
+	var certExpiry time.Time
+	if resp != nil {
+		resp.Body.Close()
+		statusCode = resp.StatusCode
+		success = err == nil && module.healthy(statusCode)
+		if resp.TLS != nil {
+			for _, cert := range resp.TLS.PeerCertificates {
+				if certExpiry.IsZero() || cert.NotAfter.Before(certExpiry) {
+					certExpiry = cert.NotAfter
+				}
+			}
+		}
+	}
+	if err != nil {
+		checkLog.Debug("Probe failed", "target", targetUrl, "module", moduleName, "error", err)
+	}
+
+	metrics := []metric{
+		gaugeMetric("probe_success", "whether the probe was successful", boolMetricValue(success)),
+		gaugeMetric("probe_duration_seconds", "how long the probe took", duration.Seconds()),
+		gaugeMetric("probe_http_status_code", "response code of the probe, 0 if there was no response", float64(statusCode)),
+	}
+	if !certExpiry.IsZero() {
+		metrics = append(metrics, gaugeMetric("probe_ssl_earliest_cert_expiry", "expiry of the first certificate of the chain to expire", float64(certExpiry.Unix())))
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	writePrometheusMetrics(w, "", metrics)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// setTargetPolicy makes policy the API target policy for the test.
+func setTargetPolicy(t *testing.T, policy *targetPolicy) {
+	t.Helper()
+	previous := apiTargetPolicy
+	apiTargetPolicy = policy
+	t.Cleanup(func() { apiTargetPolicy = previous })
+}
+
+func TestHandleProbe(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/error":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/redirect":
+			http.Redirect(w, r, "http://localhost/", http.StatusFound)
+		case "/agent":
+			if r.UserAgent() != "probe-agent" || r.Header.Get("X-Probe") != "1" {
+				w.WriteHeader(http.StatusBadRequest)
+			}
+		}
+	}))
+	defer target.Close()
+	applyTestConfig(t, Config{ProbeModules: map[string]ProbeModule{
+		"http_5xx": {ValidStatusCodes: []int{500}},
+		"agent":    {UserAgent: "probe-agent", Headers: map[string]string{"X-Probe": "1"}},
+	}})
+	// the test server listens on a loopback address, which the default policy
+	// denies
+	policy, err := newTargetPolicy(defaultAPITargetSchemes, "", "localhost", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	setTargetPolicy(t, policy)
+
+	tests := []struct {
+		name    string
+		target  string
+		module  string
+		status  int
+		metrics []string
+	}{
+		{name: "no target", status: http.StatusBadRequest},
+		{name: "unknown module", target: target.URL, module: "tcp_connect", status: http.StatusBadRequest},
+		{name: "scheme not allowed", target: "ftp://example.com/", status: http.StatusForbidden},
+		{name: "host not allowed", target: "http://localhost/", status: http.StatusForbidden},
+		{name: "healthy", target: target.URL, status: http.StatusOK,
+			metrics: []string{"probe_success 1", "probe_http_status_code 200"}},
+		{name: "unhealthy", target: target.URL + "/error", status: http.StatusOK,
+			metrics: []string{"probe_success 0", "probe_http_status_code 500"}},
+		{name: "valid status codes of the module", target: target.URL + "/error", module: "http_5xx", status: http.StatusOK,
+			metrics: []string{"probe_success 1", "probe_http_status_code 500"}},
+		{name: "headers of the module", target: target.URL + "/agent", module: "agent", status: http.StatusOK,
+			metrics: []string{"probe_success 1"}},
+		{name: "redirect not allowed", target: target.URL + "/redirect", status: http.StatusOK,
+			metrics: []string{"probe_success 0", "probe_http_status_code 302"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			query := url.Values{}
+			if test.target != "" {
+				query.Set("target", test.target)
+			}
+			if test.module != "" {
+				query.Set("module", test.module)
+			}
+			w := httptest.NewRecorder()
+			handleProbe(w, httptest.NewRequest(http.MethodGet, "/probe?"+query.Encode(), nil))
+			if w.Code != test.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, test.status, w.Body)
+			}
+			for _, metric := range test.metrics {
+				if !strings.Contains(w.Body.String(), "\n"+metric+"\n") {
+					t.Errorf("no %q in\n%s", metric, w.Body)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleProbeDeniedAddress(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer target.Close()
+	applyTestConfig(t, Config{})
+	policy, err := newTargetPolicy(defaultAPITargetSchemes, "", defaultAPITargetDenyHosts, "", defaultAPITargetDenyCIDRs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setTargetPolicy(t, policy)
+
+	// the address is denied before probing, a name resolving to it when
+	// connecting
+	w := httptest.NewRecorder()
+	handleProbe(w, httptest.NewRequest(http.MethodGet, "/probe?target="+url.QueryEscape(target.URL), nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("status of a denied address = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	byName := strings.Replace(target.URL, "127.0.0.1", "localhost", 1)
+	w = httptest.NewRecorder()
+	handleProbe(w, httptest.NewRequest(http.MethodGet, "/probe?target="+url.QueryEscape(byName), nil))
+	if !strings.Contains(w.Body.String(), "\nprobe_success 0\n") || !strings.Contains(w.Body.String(), "\nprobe_http_status_code 0\n") {
+		t.Errorf("probe of a name resolving to a denied address:\n%s", w.Body)
+	}
+}
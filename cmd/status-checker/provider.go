@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+// providerMaxFeedSize limits the feeds read, the incident history of Google
+// Cloud is several megabytes.
+const providerMaxFeedSize = 32 << 20
+
+// Types of provider status feeds.
+const (
+	// providerStatuspage is a page hosted by Statuspage.io like
+	// https://www.githubstatus.com or https://www.cloudflarestatus.com, the
+	// components are read from /api/v2/components.json.
+	providerStatuspage = "statuspage"
+	// providerGcp is https://status.cloud.google.com/incidents.json.
+	providerGcp = "gcp"
+	// providerAws is the RSS feed of one service and region of the AWS
+	// health dashboard, e.g. https://status.aws.amazon.com/rss/ec2-us-east-1.rss.
+	providerAws = "aws"
+)
+
+var providerTypes = []string{providerStatuspage, providerGcp, providerAws}
+
+// ProviderStatus makes a target reflect the status feed of a third party
+// at its Url instead of the response code. Components limits it to the
+// Statuspage.io components or Google Cloud products with these names, all
+// count if not set.
+type ProviderStatus struct {
+	Type       string   `json:"type"`
+	Components []string `json:"components,omitempty"`
+}
+
+func (p ProviderStatus) validate() error {
+	if !slices.Contains(providerTypes, p.Type) {
+		return fmt.Errorf("unknown provider type %q, use %s", p.Type, strings.Join(providerTypes, ", "))
+	}
+	if len(p.Components) > 0 && p.Type == providerAws {
+		return fmt.Errorf("provider type aws has no components, use the feed of the service")
+	}
+	return nil
+}
+
+func (p ProviderStatus) feedUrl(url string) string {
+	if p.Type == providerStatuspage {
+		return strings.TrimSuffix(url, "/") + "/api/v2/components.json"
+	}
+	return url
+}
+
+// problems returns the affected components or incidents of the feed, the feed
+// is healthy if there are none.
+func (p ProviderStatus) problems(feed io.Reader, now time.Time) ([]string, error) {
+	switch p.Type {
+	case providerStatuspage:
+		return statuspageProblems(feed, p.Components)
+	case providerGcp:
+		return gcpProblems(feed, p.Components)
+	default:
+		return awsProblems(feed, now)
+	}
+}
+
+// statuspageProblems returns the components that are degraded or down,
+// maintenance doesn't count.
+func statuspageProblems(feed io.Reader, components []string) ([]string, error) {
+	var parsed struct {
+		Components []struct {
+			Name   string `json:"name"`
+			Status string `json:"status"`
+			Group  bool   `json:"group"`
+		} `json:"components"`
+	}
+	if err := json.NewDecoder(feed).Decode(&parsed); err != nil {
+		return nil, fmt.Errorf("parsing statuspage components: %w", err)
+	}
+
+	var problems []string
+	found := make(map[string]bool)
+	for _, component := range parsed.Components {
+		if len(components) > 0 && !slices.Contains(components, component.Name) {
+			continue
+		}
+		// groups summarize the status of their components
+		if len(components) == 0 && component.Group {
+			continue
+		}
+		found[component.Name] = true
+		if component.Status != "operational" && component.Status != "under_maintenance" {
+			problems = append(problems, component.Name+": "+strings.ReplaceAll(component.Status, "_", " "))
+		}
+	}
+	for _, name := range components {
+		if !found[name] {
+			return nil, fmt.Errorf("no component %q in the status feed", name)
+		}
+	}
+	return problems, nil
+}
+
+// gcpProblems returns the ongoing incidents affecting the products.
+func gcpProblems(feed io.Reader, products []string) ([]string, error) {
+	var incidents []struct {
+		ExternalDesc     string `json:"external_desc"`
+		End              string `json:"end"`
+		AffectedProducts []struct {
+			Title string `json:"title"`
+		} `json:"affected_products"`
+	}
+	if err := json.NewDecoder(feed).Decode(&incidents); err != nil {
+		return nil, fmt.Errorf("parsing google cloud incidents: %w", err)
+	}
+
+	var problems []string
+	for _, incident := range incidents {
+		if incident.End != "" {
+			continue
+		}
+		for _, product := range incident.AffectedProducts {
+			if len(products) == 0 || slices.Contains(products, product.Title) {
+				problems = append(problems, product.Title+": "+incident.ExternalDesc)
+				break
+			}
+		}
+	}
+	return problems, nil
+}
+
+// awsStaleItems is how long an item of an AWS feed is considered current,
+// the feeds keep resolved items for a while.
+const awsStaleItems = 24 * time.Hour
+
+// awsProblems looks at the latest item of a service feed. AWS posts updates
+// of an event as new items and the last one of a resolved event starts with
+// [RESOLVED] or says the service is operating normally.
+func awsProblems(feed io.Reader, now time.Time) ([]string, error) {
+	var parsed struct {
+		Items []struct {
+			Title   string `xml:"title"`
+			PubDate string `xml:"pubDate"`
+		} `xml:"channel>item"`
+	}
+	if err := xml.NewDecoder(feed).Decode(&parsed); err != nil {
+		return nil, fmt.Errorf("parsing aws feed: %w", err)
+	}
+
+	var latest string
+	var latestTime time.Time
+	for _, item := range parsed.Items {
+		published, err := time.Parse(time.RFC1123Z, item.PubDate)
+		if err != nil {
+			published, err = time.Parse(time.RFC1123, item.PubDate)
+		}
+		if err == nil && published.After(latestTime) {
+			latest, latestTime = item.Title, published
+		}
+	}
+	if latestTime.IsZero() || now.Sub(latestTime) > awsStaleItems {
+		return nil, nil
+	}
+	title := strings.ToLower(latest)
+	if strings.HasPrefix(title, "[resolved]") || strings.Contains(title, "operating normally") {
+		return nil, nil
+	}
+	return []string{latest}, nil
+}
+
+// checkProvider reads the status feed of a provider target.
+func checkProvider(ctx context.Context, target Target) statusUpdate {
+	item := target.Url
+	timeStart := time.Now()
+	trace := newCheckTrace(item, timeStart)
+	feed := target
+	feed.Url = target.Provider.feedUrl(target.Url)
+	resp, err := doCheckRequest(ctx, feed, trace)
+	trace.end(resp, err)
+	if err != nil && ctx.Err() != nil {
+		return statusUpdate{item: item, cancelled: true}
+	}
+
+	code := 0
+	if resp != nil {
+		code = resp.StatusCode
+		defer resp.Body.Close()
+	}
+	if err == nil && (code < 200 || code >= 300) {
+		err = fmt.Errorf("status feed responded with status %d", code)
+	}
+	var problems []string
+	if err == nil {
+		problems, err = target.Provider.problems(io.LimitReader(resp.Body, providerMaxFeedSize), time.Now())
+		if err == nil && len(problems) > 0 {
+			err = errors.New(strings.Join(problems, "; "))
+		}
+	}
+	if err != nil {
+		checkLog.Warn("Provider check failed", "target", item, "duration", time.Since(timeStart), "error", err)
+		return statusUpdate{item: item, err: err, state: StatusState{
+			Healthy:       false,
+			ResponseTime:  time.Since(timeStart),
+			ResponseCode:  code,
+			LastUnhealthy: time.Now(),
+			Problems:      problems}}
+	}
+	return statusUpdate{item: item, state: StatusState{
+		Healthy:      true,
+		ResponseTime: time.Since(timeStart),
+		ResponseCode: code,
+		LastHealthy:  time.Now()}}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxQueuedResults limits the results queued for a target between two check
+// rounds, older ones are dropped.
+const maxQueuedResults = 100
+
+// reportedResult is a check result of a passive target pushed to
+// /api/results/{target} by an external system.
+type reportedResult struct {
+	Healthy      *bool     `json:"healthy"`
+	ResponseCode int       `json:"responseCode,omitempty"`
+	ResponseTime int64     `json:"responseTime,omitempty"` // milliseconds
+	Message      string    `json:"message,omitempty"`
+	Time         time.Time `json:"time,omitzero"` // when it was checked, the time it was received if not set
+}
+
+var (
+	resultsMu sync.Mutex
+	// queuedResults are merged into the state in the next check round so
+	// updateStatusState stays the only writer of check results.
+	queuedResults = make(map[string][]statusUpdate)
+	// lastReported is when the latest result of a passive target arrived.
+	lastReported = make(map[string]time.Time)
+)
+
+// reportedUpdates returns the queued results of the passive targets and an
+// unhealthy result for each one that hasn't reported in its ResultTimeout.
+func reportedUpdates(targets []Target, now time.Time) []statusUpdate {
+	resultsMu.Lock()
+	defer resultsMu.Unlock()
+
+	var updates []statusUpdate
+	for _, target := range targets {
+		if !target.Passive {
+			continue
+		}
+		queued := queuedResults[target.Url]
+		delete(queuedResults, target.Url)
+		updates = append(updates, queued...)
+
+		last, ok := lastReported[target.Url]
+		if !ok {
+			last = startTime
+		}
+		timeout := time.Duration(target.ResultTimeout) * time.Second
+		if len(queued) == 0 && timeout > 0 && now.Sub(last) > timeout {
+			updates = append(updates, statusUpdate{
+				item:  target.Url,
+				err:   fmt.Errorf("no result reported since %s", last.Format(time.RFC3339)),
+				state: StatusState{Healthy: false, LastUnhealthy: now},
+			})
+		}
+	}
+	return updates
+}
+
+// handleReportResult queues a result for a passive target, it is applied in
+// the next check round.
+func handleReportResult(w http.ResponseWriter, r *http.Request) {
+	item := r.PathValue("target")
+	var result reportedResult
+	if !decodeJSON(w, r, &result) {
+		return
+	}
+	if result.Healthy == nil {
+		http.Error(w, "healthy is required", http.StatusBadRequest)
+		return
+	}
+	if result.ResponseTime < 0 {
+		http.Error(w, "responseTime can't be negative", http.StatusBadRequest)
+		return
+	}
+
+	stateMu.RLock()
+	target, ok := configTarget(item)
+	allowed := targetsAllowed(r, []string{item})
+	stateMu.RUnlock()
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown target %q", item), http.StatusNotFound)
+		return
+	}
+	if !allowed {
+		http.Error(w, fmt.Sprintf("tokens of namespace %q can only act on its targets", tokenNamespace(r)), http.StatusForbidden)
+		return
+	}
+	if !target.Passive {
+		http.Error(w, fmt.Sprintf("target %q is checked by status-checker, set passive to report its results", item), http.StatusConflict)
+		return
+	}
+
+	now := time.Now()
+	if result.Time.IsZero() || result.Time.After(now) {
+		result.Time = now
+	}
+	update := statusUpdate{item: item, state: StatusState{
+		Healthy:      *result.Healthy,
+		ResponseCode: result.ResponseCode,
+		ResponseTime: time.Duration(result.ResponseTime) * time.Millisecond,
+	}}
+	if *result.Healthy {
+		update.state.LastHealthy = result.Time
+	} else {
+		update.state.LastUnhealthy = result.Time
+		message := result.Message
+		if message == "" {
+			message = "reported unhealthy"
+		}
+		update.err = errors.New(message)
+	}
+
+	resultsMu.Lock()
+	queued := append(queuedResults[item], update)
+	if len(queued) > maxQueuedResults {
+		queued = queued[len(queued)-maxQueuedResults:]
+	}
+	queuedResults[item] = queued
+	lastReported[item] = now
+	resultsMu.Unlock()
+
+	checkLog.Debug("Result reported", "target", item, "healthy", *result.Healthy, "actor", requestActor(r))
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// encryptedPrefix marks encrypted values, the version allows changing the
+// scheme later.
+const encryptedPrefix = "enc:v1:"
+
+// redacted replaces secrets where they are shown instead of stored.
+const redacted = "<redacted>"
+
+// secretBox encrypts secrets written to the data path with AES-256-GCM.
+type secretBox struct {
+	aead cipher.AEAD
+}
+
+// secrets is nil if no key is configured, secrets are stored in plain text
+// then.
+var secrets *secretBox
+
+// setupSecrets reads the base64 encoded 32 byte key, e.g. generated with
+// openssl rand -base64 32, from key or the file keyFile.
+func setupSecrets(key string, keyFile string) error {
+	if key != "" && keyFile != "" {
+		return errors.New("only one of --secrets-key and --secrets-key-file can be set")
+	}
+	if keyFile != "" {
+		content, err := os.ReadFile(keyFile)
+		if err != nil {
+			return err
+		}
+		key = strings.TrimSpace(string(content))
+	}
+	if key == "" {
+		return nil
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(raw) != 32 {
+		return errors.New("the secrets key has to be 32 bytes encoded as base64")
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	secrets = &secretBox{aead: aead}
+	return nil
+}
+
+// encrypt returns value unchanged if no key is configured.
+func (b *secretBox) encrypt(value string) (string, error) {
+	if b == nil || strings.HasPrefix(value, encryptedPrefix) {
+		return value, nil
+	}
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := b.aead.Seal(nonce, nonce, []byte(value), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decrypt returns values without the encrypted prefix unchanged, so secrets
+// written before a key was configured can still be read.
+func (b *secretBox) decrypt(value string) (string, error) {
+	encoded, ok := strings.CutPrefix(value, encryptedPrefix)
+	if !ok {
+		return value, nil
+	}
+	if b == nil {
+		return "", errors.New("found encrypted secrets but no secrets key is configured")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < b.aead.NonceSize() {
+		return "", errors.New("malformed encrypted secret")
+	}
+	nonce, ciphertext := sealed[:b.aead.NonceSize()], sealed[b.aead.NonceSize():]
+	plain, err := b.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", errors.New("decrypting secret failed, is the secrets key correct?")
+	}
+	return string(plain), nil
+}
+
+// transformTargetSecrets returns copies of the targets with f applied to all
+// header values, as headers are where credentials of a target go.
+func transformTargetSecrets(targets []Target, f func(string) (string, error)) ([]Target, error) {
+	transformed := make([]Target, 0, len(targets))
+	for _, target := range targets {
+		if target.Headers != nil {
+			target.Headers = maps.Clone(target.Headers)
+			for name, value := range target.Headers {
+				changed, err := f(value)
+				if err != nil {
+					return nil, fmt.Errorf("header %s of target %s: %w", name, target.Url, err)
+				}
+				target.Headers[name] = changed
+			}
+		}
+		transformed = append(transformed, target)
+	}
+	return transformed, nil
+}
+
+// redactTarget hides the header values of a target, e.g. for the audit log.
+func redactTarget(target Target) Target {
+	redactedTargets, _ := transformTargetSecrets([]Target{target}, func(string) (string, error) {
+		return redacted, nil
+	})
+	return redactedTargets[0]
+}
+
+// redactUrl hides the password of a URL, e.g. for the log.
+func redactUrl(raw string) string {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return redacted
+	}
+	return parsed.Redacted()
+}
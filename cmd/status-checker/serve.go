@@ -0,0 +1,691 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+type args struct {
+	listen          string
+	configPath      string
+	staticPath      string
+	dataPath        string
+	timeout         int
+	checkTimeout    int
+	gracePeriod     int
+	otlpEndpoint    string
+	otlpMetrics     int
+	statsd          statsdArgs
+	mqtt            mqttArgs
+	eventsPath      string
+	maxPerHost      int
+	maxConcurrent   int
+	historySize     int
+	pidFile         string
+	daemon          bool
+	logLevel        string
+	logComponents   string
+	quiet           bool
+	verbose         bool
+	veryVerbose     bool
+	logFormat       string
+	logFile         logFileArgs
+	shutdownTimeout int
+	debug           bool
+	debugToken      string
+	noPersist       bool
+	persistInterval int
+	simulate        bool
+	apiToken        string
+	apiTokensFile   string
+	adminListen     string
+	adminAllow      string
+	wsAllow         string
+	secretsKey      string
+	secretsKeyFile  string
+	tls             tlsArgs
+	targetPolicy    targetPolicyArgs
+	page            pageAccess
+	probe           bool
+	smtp            smtpArgs
+	publicUrl       string
+}
+
+type targetPolicyArgs struct {
+	schemes    string
+	allowHosts string
+	denyHosts  string
+	allowCIDRs string
+	denyCIDRs  string
+}
+
+type statsdArgs struct {
+	address string
+	prefix  string
+	tags    string
+	format  string
+}
+
+type logFileArgs struct {
+	path        string
+	maxSize     int
+	rotateHours int
+	maxBackups  int
+	maxAgeDays  int
+}
+
+// addConfigFlags adds the flags shared by all commands that read the config.
+func addConfigFlags(fs *flag.FlagSet, configPath *string) {
+	fs.StringVar(configPath, "config", "./config.json", "path to the config file (default ./config.json)")
+	fs.StringVar(configPath, "c", "./config.json", "path to the config file (default ./config.json) (shorthand)")
+}
+
+// addCheckFlags adds the flags shared by all commands that run checks.
+func addCheckFlags(fs *flag.FlagSet, checkTimeout *int, maxPerHost *int, maxConcurrent *int) {
+	fs.IntVar(checkTimeout, "check-timeout", 10, "timeout of a single check in seconds (default 10)")
+	fs.IntVar(maxPerHost, "max-per-host", 0, "maximum number of concurrent checks against the same host (default 0, unlimited)")
+	fs.IntVar(maxConcurrent, "max-concurrent-checks", defaultMaxConcurrentChecks, fmt.Sprintf("maximum number of checks running at the same time, 0 starts all at once (default %d)", defaultMaxConcurrentChecks))
+}
+
+func newServeFlagSet(a *args) *flag.FlagSet {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addConfigFlags(fs, &a.configPath)
+	addCheckFlags(fs, &a.checkTimeout, &a.maxPerHost, &a.maxConcurrent)
+	fs.StringVar(&a.listen, "listen", ":8081", "address to serve the status page on (default :8081)")
+	fs.StringVar(&a.listen, "l", ":8081", "address to serve the status page on (default :8081) (shorthand)")
+	fs.StringVar(&a.staticPath, "static", "./static", "path to the static files (default ./static)")
+	fs.StringVar(&a.staticPath, "s", "./static", "path to the static files (default ./static) (shorthand)")
+	fs.IntVar(&a.timeout, "timeout", 10, "timeout in seconds (default 10)")
+	fs.IntVar(&a.timeout, "t", 10, "timeout in seconds (default 10) (shorthand)")
+	fs.StringVar(&a.dataPath, "data", "./data", "path to the data files (default ./data)")
+	fs.StringVar(&a.dataPath, "d", "./data", "path to the data files (default ./data) (shorthand)")
+	fs.IntVar(&a.historySize, "history-size", defaultHistorySize, fmt.Sprintf("number of recent check results kept in memory per target for /api/history, 0 disables it (default %d)", defaultHistorySize))
+	fs.IntVar(&a.gracePeriod, "grace-period", 60, "seconds after startup during which notifications are held back, they are sent after it if still relevant (default 60)")
+	fs.StringVar(&a.otlpEndpoint, "otlp-endpoint", "", "OTLP/HTTP endpoint to export traces of checks and metrics to, e.g. http://localhost:4318 (default disabled)")
+	fs.IntVar(&a.otlpMetrics, "otlp-metrics-interval", 0, "seconds between pushes of the metrics to --otlp-endpoint, 0 disables (default 0)")
+	fs.StringVar(&a.statsd.address, "statsd-address", "", "host:port of a statsd server to send the state and response time of every target to after each round (default disabled)")
+	fs.StringVar(&a.statsd.prefix, "statsd-prefix", "status_checker.", "prefix of the statsd metric names (default status_checker.)")
+	fs.StringVar(&a.statsd.tags, "statsd-tags", "", "comma separated tags added to every statsd metric, e.g. env:prod (default none)")
+	fs.StringVar(&a.mqtt.url, "mqtt-url", "", "MQTT broker to publish the state of every target and the summary to as retained messages after each round, mqtt:// or mqtts:// with optional user:password@ (default disabled)")
+	fs.StringVar(&a.mqtt.topicPrefix, "mqtt-topic-prefix", "status-checker/", "prefix of the MQTT topics status, summary and targets/<target> (default status-checker/)")
+	fs.StringVar(&a.mqtt.discoveryPrefix, "mqtt-discovery-prefix", "", "Home Assistant MQTT discovery prefix, usually homeassistant, to announce every target and composite as binary_sensor (default disabled)")
+	fs.StringVar(&a.mqtt.clientId, "mqtt-client-id", "", "MQTT client id (default status-checker-<hostname>)")
+	fs.StringVar(&a.statsd.format, "statsd-format", "dogstatsd", "statsd for plain statsd with the target in the metric name or dogstatsd with the target as tag (default dogstatsd)")
+	fs.StringVar(&a.eventsPath, "events", "", "file to append every check result and state change to as NDJSON, - for stdout (default none)")
+	fs.StringVar(&a.pidFile, "pidfile", "", "path to write the pid of the process to (default none)")
+	fs.BoolVar(&a.daemon, "daemon", false, "detach from the terminal and run in the background, output goes to status-checker.log in the data path (default false)")
+	fs.StringVar(&a.logLevel, "log-level", "info", "minimum level of logged messages: trace, debug, info, warn or error (default info)")
+	fs.StringVar(&a.logComponents, "log-components", "", "comma separated component=level pairs overriding --log-level for the check, state and websocket logs, e.g. check=off (default none)")
+	fs.BoolVar(&a.quiet, "q", false, "only log state changes, warnings and errors but not of every check, same as --log-level warn --log-components state=info,check=off (default false)")
+	fs.BoolVar(&a.verbose, "v", false, "log debug messages, same as --log-level debug (default false)")
+	fs.BoolVar(&a.veryVerbose, "vv", false, "also log the result of every check, same as --log-level trace (default false)")
+	fs.StringVar(&a.logFormat, "log-format", "text", "format of log lines: text or json (default text)")
+	fs.StringVar(&a.logFile.path, "log-file", "", "path of a file to write logs to instead of stderr (default none)")
+	fs.IntVar(&a.logFile.maxSize, "log-max-size", 100, "size in megabytes after which the log file is rotated, 0 disables (default 100)")
+	fs.IntVar(&a.logFile.rotateHours, "log-rotate-hours", 24, "hours after which the log file is rotated, 0 disables (default 24)")
+	fs.IntVar(&a.logFile.maxBackups, "log-max-backups", 7, "number of rotated log files to keep, 0 keeps all (default 7)")
+	fs.IntVar(&a.logFile.maxAgeDays, "log-max-age", 30, "days after which rotated log files are removed, 0 keeps them (default 30)")
+	fs.IntVar(&a.shutdownTimeout, "shutdown-timeout", 10, "seconds to wait for in-flight checks and notifications on shutdown (default 10)")
+	fs.BoolVar(&a.debug, "debug", false, "serve pprof and runtime stats below /debug/, requires --debug-token (default false)")
+	fs.StringVar(&a.debugToken, "debug-token", "", "token required to access /debug/ as bearer token or basic auth password (default none)")
+	fs.StringVar(&a.adminListen, "admin-listen", "", "separate address to serve the management API and /debug/ on, e.g. localhost:8082 (default the --listen address)")
+	fs.StringVar(&a.tls.certFile, "tls-cert", "", "certificate file to serve HTTPS with, reloaded when it changes (default plain HTTP)")
+	fs.StringVar(&a.tls.keyFile, "tls-key", "", "private key file of --tls-cert (default none)")
+	fs.StringVar(&a.tls.minVersion, "tls-min-version", "1.2", "minimum TLS version: 1.2 or 1.3 (default 1.2)")
+	fs.StringVar(&a.tls.cipherSuites, "tls-cipher-suites", "", "comma separated TLS 1.2 cipher suites, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 (default the Go defaults)")
+	fs.IntVar(&a.tls.hstsMaxAge, "hsts-max-age", 0, "max-age in seconds of the Strict-Transport-Security header sent over HTTPS, 0 disables (default 0)")
+	fs.BoolVar(&a.tls.hstsIncludeSubdomains, "hsts-include-subdomains", false, "add includeSubDomains to the Strict-Transport-Security header (default false)")
+	fs.BoolVar(&a.tls.hstsPreload, "hsts-preload", false, "add preload to the Strict-Transport-Security header (default false)")
+	fs.StringVar(&a.page.user, "page-user", "", "user required to view the status page with --page-password (default none)")
+	fs.StringVar(&a.page.password, "page-password", "", "basic auth password required to view the status page and /status-json (default none)")
+	fs.StringVar(&a.page.token, "page-token", "", "token required to view the status page and /status-json, share links as /?token=<token> (default none)")
+	fs.StringVar(&a.smtp.address, "smtp-address", "", "host:port of the SMTP server to send mails to subscribers of the status page with (default disabled)")
+	fs.StringVar(&a.smtp.user, "smtp-user", "", "user to authenticate at the SMTP server with (default none)")
+	fs.StringVar(&a.smtp.password, "smtp-password", "", "password to authenticate at the SMTP server with (default none)")
+	fs.StringVar(&a.smtp.from, "smtp-from", "", "sender address of mails to subscribers, e.g. status@example.com (default none)")
+	fs.StringVar(&a.publicUrl, "public-url", "", "URL the status page is reachable at, used for links in mails and allowed as origin of websockets with page access (default none)")
+	fs.StringVar(&a.adminAllow, "admin-allow", "", "comma separated CIDR ranges allowed to reach the management API and /debug/, e.g. 10.0.0.0/8,::1 (default all)")
+	fs.StringVar(&a.wsAllow, "ws-allow", "", "comma separated CIDR ranges allowed to connect to /ws (default all)")
+	fs.StringVar(&a.apiToken, "api-token", "", "admin token of the management API below /api/ as bearer token or basic auth password, the API is disabled without any token (default none)")
+	fs.StringVar(&a.apiTokensFile, "api-tokens-file", "", "JSON file with named API tokens and their scopes read, silence, manage-targets, announce, report, probe or admin, e.g. [{\"name\": \"ci\", \"token\": \"...\", \"scopes\": [\"manage-targets\"]}], a namespace limits a token to the targets of that namespace (default none)")
+	fs.StringVar(&a.secretsKey, "secrets-key", "", "base64 encoded 32 byte key to encrypt secrets written to the data path with, better set as STATUS_CHECKER_SECRETS_KEY (default none)")
+	fs.StringVar(&a.secretsKeyFile, "secrets-key-file", "", "file containing the --secrets-key, e.g. mounted from a secret manager (default none)")
+	fs.StringVar(&a.targetPolicy.schemes, "api-target-schemes", defaultAPITargetSchemes, "comma separated url schemes allowed for targets added through the API (default "+defaultAPITargetSchemes+")")
+	fs.StringVar(&a.targetPolicy.allowHosts, "api-target-allow-hosts", "", "comma separated hosts, or *.domain for subdomains, targets added through the API are limited to (default all)")
+	fs.StringVar(&a.targetPolicy.denyHosts, "api-target-deny-hosts", defaultAPITargetDenyHosts, "comma separated hosts, or *.domain for subdomains, targets added through the API may not use (default "+defaultAPITargetDenyHosts+")")
+	fs.StringVar(&a.targetPolicy.allowCIDRs, "api-target-allow-cidrs", "", "comma separated CIDR ranges targets added through the API may connect to, a range within a denied one allows it, e.g. 0.0.0.0/0,::/0,10.1.0.0/16 to add a private range (default all)")
+	fs.StringVar(&a.targetPolicy.denyCIDRs, "api-target-deny-cidrs", defaultAPITargetDenyCIDRs, "comma separated CIDR ranges targets added through the API may not connect to (default loopback, unspecified, link-local, private and cloud metadata addresses)")
+	fs.BoolVar(&a.probe, "probe", false, "serve /probe?target=<url>&module=<name> to tokens with the probe scope to check any URL allowed by the --api-target-* flags like the blackbox exporter (default false)")
+	fs.BoolVar(&a.noPersist, "no-persist", false, "keep the state in memory only, nothing is loaded from or saved to the data path (default false)")
+	fs.IntVar(&a.persistInterval, "persist-interval", 0, "minimum seconds between writes of the state to the data path, 0 writes changes after each check round (default 0)")
+	fs.BoolVar(&a.simulate, "simulate", false, "report synthetic up, slow and down results on a schedule instead of requesting the targets, to test the status page, notifiers and alerts (default false)")
+	return fs
+}
+
+func parseServeArgs(arguments []string) args {
+	var a args
+	fs := newServeFlagSet(&a)
+
+	// Parse the flags
+	parseFlags(fs, arguments)
+
+	if fs.NArg() > 0 {
+		fmt.Println("Positional arguments found")
+		os.Exit(2)
+	}
+
+	if a.dataPath[len(a.dataPath)-1] != '/' {
+		a.dataPath += "/"
+	}
+
+	if a.logFile.path != "" {
+		file, err := openRotatingFile(a.logFile.path,
+			int64(a.logFile.maxSize)*1024*1024,
+			time.Duration(a.logFile.rotateHours)*time.Hour,
+			a.logFile.maxBackups,
+			time.Duration(a.logFile.maxAgeDays)*24*time.Hour)
+		if err != nil {
+			fmt.Println("Error opening log file:", err)
+			os.Exit(2)
+		}
+		logOutput = file
+	}
+
+	switch {
+	case a.veryVerbose:
+		a.logLevel = "trace"
+	case a.verbose:
+		a.logLevel = "debug"
+	case a.quiet:
+		// state changes are the one thing still worth logging, explicitly
+		// given component levels take precedence
+		a.logLevel = "warn"
+		a.logComponents = componentState + "=info," + componentCheck + "=off," + a.logComponents
+	}
+
+	if err := setupLogging(a.logLevel, a.logFormat, a.logComponents); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(2)
+	}
+
+	slog.Info("Parsed arguments",
+		"listen", a.listen,
+		"adminListen", a.adminListen,
+		"tlsCert", a.tls.certFile,
+		"config", a.configPath,
+		"static", a.staticPath,
+		"data", a.dataPath,
+		"timeout", a.timeout,
+		"checkTimeout", a.checkTimeout,
+		"gracePeriod", a.gracePeriod,
+		"otlpEndpoint", a.otlpEndpoint,
+		"otlpMetricsInterval", a.otlpMetrics,
+		"statsdAddress", a.statsd.address,
+		"mqtt", redactUrl(a.mqtt.url),
+		"events", a.eventsPath,
+		"maxPerHost", a.maxPerHost,
+		"maxConcurrentChecks", a.maxConcurrent,
+		"historySize", a.historySize,
+		"pidFile", a.pidFile,
+		"logFile", a.logFile.path,
+		"debug", a.debug,
+		"noPersist", a.noPersist,
+		"persistInterval", a.persistInterval,
+		"simulate", a.simulate,
+	)
+
+	return a
+}
+
+// configureChecks applies the check related flags.
+func configureChecks(checkTimeout int, maxPerHost int, maxConcurrent int) {
+	checkClient.Timeout = time.Duration(checkTimeout) * time.Second
+	managedCheckClient.Timeout = checkClient.Timeout
+	checkHostLimiter.configure(maxPerHost)
+	maxConcurrentChecks = maxConcurrent
+}
+
+func runServe(arguments []string) int {
+
+	args := parseServeArgs(arguments)
+
+	if args.daemon && !isDaemonized() {
+		if err := os.MkdirAll(args.dataPath, os.ModePerm); err != nil {
+			slog.Error("Error creating directory", "path", args.dataPath, "error", err)
+			return 1
+		}
+		if err := daemonize(arguments, args.dataPath+"status-checker.log"); err != nil {
+			slog.Error("Error starting daemon", "error", err)
+			return 1
+		}
+	}
+
+	if args.pidFile != "" {
+		if err := writePidFile(args.pidFile); err != nil {
+			slog.Error("Error writing pid file", "error", err)
+			return 1
+		}
+	}
+
+	slog.Info("Starting status-checker", "version", version, "commit", commit, "buildDate", buildDate)
+	parseConfig(args.configPath)
+	setupNotifiers()
+	setupZabbix()
+	setupTracing(args.otlpEndpoint)
+	setupMetricsExport(args.otlpEndpoint, time.Duration(args.otlpMetrics)*time.Second)
+	if err := setupEvents(args.eventsPath); err != nil {
+		slog.Error("Error opening event output", "error", err)
+		return 1
+	}
+	if err := setupStatsd(args.statsd.address, args.statsd.prefix, args.statsd.tags, args.statsd.format); err != nil {
+		slog.Error("Error setting up statsd", "error", err)
+		return 1
+	}
+	if err := setupMqtt(args.mqtt); err != nil {
+		slog.Error("Error setting up MQTT", "error", err)
+		return 1
+	}
+
+	// the page and everything it loads is protected if page access is set
+	page := func(handler http.Handler) http.Handler {
+		return requirePageAccess(args.page, handler)
+	}
+	if args.page.enabled() {
+		upgrader.CheckOrigin = pageOriginCheck(args.publicUrl)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/", page(http.FileServer(http.Dir(args.staticPath))))
+
+	// /status-json only serves the items as before the payload object of
+	// /v2/status-json
+	statusJson := func(legacy bool) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			encoded, err := encodedStatus(r.PathValue("namespace"))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			if legacy {
+				w.Write(encoded.items)
+			} else {
+				w.Write(encoded.full)
+			}
+		})
+	}
+	mux.Handle("/status-json", page(statusJson(true)))
+	mux.Handle("/v2/status-json", page(statusJson(false)))
+
+	adminAllowed, err := parseAllowlist(args.adminAllow)
+	if err != nil {
+		slog.Error("Invalid --admin-allow", "error", err)
+		return 1
+	}
+	wsAllowed, err := parseAllowlist(args.wsAllow)
+	if err != nil {
+		slog.Error("Invalid --ws-allow", "error", err)
+		return 1
+	}
+
+	mux.Handle("/ws", allowFrom(wsAllowed, page(handleConnections(true))))
+	mux.Handle("/v2/ws", allowFrom(wsAllowed, page(handleConnections(false))))
+	mux.HandleFunc("/healthz", handleHealthz)
+	mux.HandleFunc("/api/version", handleVersion)
+	mux.Handle("GET /api/targets/{target}", page(http.HandlerFunc(handleTargetDetail)))
+	mux.Handle("GET /api/uptime-bars/{target}", page(http.HandlerFunc(handleUptimeBars)))
+	mux.Handle("GET /api/history/{target}", page(http.HandlerFunc(handleHistory)))
+	mux.Handle("GET /api/page-config", page(handlePageConfig(args.timeout)))
+	mux.Handle("GET /api/strings", page(http.HandlerFunc(handleStrings)))
+	mux.Handle("GET /api/summary", page(http.HandlerFunc(handleSummary)))
+	mux.Handle("GET /widget", page(http.HandlerFunc(handleWidget)))
+	mux.Handle("GET /widget.js", page(http.HandlerFunc(handleWidgetScript)))
+
+	// the status pages of the namespaces, the handlers read the namespace
+	// path value and use the main page without it
+	namespaced := func(handler http.Handler) http.Handler {
+		return page(requireNamespace(handler))
+	}
+	mux.Handle("GET /ns/{namespace}/{$}", namespaced(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, filepath.Join(args.staticPath, "index.html"))
+	})))
+	mux.Handle("/ns/{namespace}/status-json", namespaced(statusJson(true)))
+	mux.Handle("/ns/{namespace}/v2/status-json", namespaced(statusJson(false)))
+	mux.Handle("/ns/{namespace}/ws", allowFrom(wsAllowed, namespaced(handleConnections(true))))
+	mux.Handle("/ns/{namespace}/v2/ws", allowFrom(wsAllowed, namespaced(handleConnections(false))))
+	mux.Handle("GET /ns/{namespace}/api/page-config", namespaced(handlePageConfig(args.timeout)))
+	mux.Handle("GET /ns/{namespace}/api/strings", namespaced(http.HandlerFunc(handleStrings)))
+	mux.Handle("GET /ns/{namespace}/api/targets/{target}", namespaced(http.HandlerFunc(handleTargetDetail)))
+	mux.Handle("GET /ns/{namespace}/api/uptime-bars/{target}", namespaced(http.HandlerFunc(handleUptimeBars)))
+	mux.Handle("GET /ns/{namespace}/api/history/{target}", namespaced(http.HandlerFunc(handleHistory)))
+	mux.Handle("GET /ns/{namespace}/api/summary", namespaced(http.HandlerFunc(handleSummary)))
+
+	if err := setupSubscriptions(args.smtp, args.publicUrl, args.dataPath, !args.noPersist); err != nil {
+		slog.Error("Error setting up email subscriptions", "error", err)
+		return 1
+	}
+	if subscriptions != nil {
+		registerSubscriptions(mux, page)
+	}
+
+	// the admin surface is kept off the public listener if it has its own
+	adminMux := mux
+	if args.adminListen != "" {
+		adminMux = http.NewServeMux()
+	}
+
+	if err := setupSecrets(args.secretsKey, args.secretsKeyFile); err != nil {
+		slog.Error("Error reading secrets key", "error", err)
+		return 1
+	}
+	var tokens []apiToken
+	if args.apiToken != "" {
+		tokens = append(tokens, apiToken{Name: "api-token", Token: args.apiToken, Scopes: []string{scopeAdmin}})
+	}
+	if args.apiTokensFile != "" {
+		fileTokens, err := readAPITokens(args.apiTokensFile)
+		if err != nil {
+			slog.Error("Error reading API tokens", "error", err)
+			return 1
+		}
+		tokens = append(tokens, fileTokens...)
+	}
+	for _, token := range tokens {
+		if _, ok := config.namespace(token.Namespace); token.Namespace != "" && !ok {
+			slog.Error("API token of unknown namespace", "token", token.Name, "namespace", token.Namespace)
+			return 1
+		}
+	}
+	p := args.targetPolicy
+	apiTargetPolicy, err = newTargetPolicy(p.schemes, p.allowHosts, p.denyHosts, p.allowCIDRs, p.denyCIDRs)
+	if err != nil {
+		slog.Error("Invalid API target policy", "error", err)
+		return 1
+	}
+	if len(tokens) > 0 {
+		if err := setupManagement(args.dataPath, !args.noPersist); err != nil {
+			slog.Error("Error loading managed state", "error", err)
+			return 1
+		}
+		registerManagement(adminMux, tokens, adminAllowed)
+		// apps for UptimeRobot only know the path of its API
+		mux.Handle("POST /v2/getMonitors", handleUptimeRobotMonitors(tokens, args.timeout))
+	}
+	adminMux.Handle("/metrics", handleMetrics(tokens, page))
+	if args.probe {
+		if len(tokens) == 0 {
+			slog.Error("Not serving /probe as no API token is set")
+		} else {
+			adminMux.Handle("GET /probe", allowFrom(adminAllowed, requireScope(tokens, scopeProbe, http.HandlerFunc(handleProbe))))
+		}
+	}
+
+	if args.debug {
+		if args.debugToken == "" {
+			slog.Error("Not serving /debug/ as --debug-token is not set")
+		} else {
+			adminMux.Handle("/debug/", allowFrom(adminAllowed, debugHandler(args.debugToken)))
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		select {
+		case <-shutdownRequested:
+			stop()
+		case <-ctx.Done():
+		}
+	}()
+
+	// in-flight checks get some time to finish once a shutdown was requested
+	shutdownTimeout := time.Duration(args.shutdownTimeout) * time.Second
+	checkCtx, cancelChecks := context.WithCancel(context.Background())
+	defer cancelChecks()
+	context.AfterFunc(ctx, func() {
+		time.AfterFunc(shutdownTimeout, cancelChecks)
+	})
+
+	tlsConfig, err := newTLSConfig(args.tls)
+	if err != nil {
+		slog.Error("Error configuring TLS", "error", err)
+		return 1
+	}
+	servers := []*http.Server{startServer(args.listen, mux, args.tls, tlsConfig)}
+	if args.adminListen != "" {
+		servers = append(servers, startServer(args.adminListen, adminMux, args.tls, tlsConfig))
+	}
+
+	historySize = args.historySize
+	simulateAll = args.simulate
+	if simulateAll {
+		slog.Warn("Simulating all checks, the targets aren't requested")
+	}
+	if !args.noPersist {
+		_, err := loadStatusState(args.dataPath)
+		if err != nil {
+			slog.Warn("Error loading status state", "error", err)
+		}
+		if err := loadUptime(args.dataPath); err != nil {
+			slog.Warn("Error loading uptime history", "error", err)
+		}
+		if err := loadHistory(args.dataPath); err != nil {
+			slog.Warn("Error loading recent history", "error", err)
+		}
+	}
+
+	configureChecks(args.checkTimeout, args.maxPerHost, args.maxConcurrent)
+	checkWatchdog.configure(time.Duration(args.timeout)*time.Second, checkClient.Timeout)
+	go checkWatchdog.run(time.Duration(args.gracePeriod) * time.Second)
+	go runSdWatchdog()
+	go hub.run()
+
+	// rounds start every interval, a round taking longer delays the next
+	// one instead of running concurrently
+	interval := time.Duration(args.timeout) * time.Second
+	ready := false
+	for ctx.Err() == nil {
+		roundStart := time.Now()
+		runCheckRound(checkCtx, args)
+		if !ready {
+			// the server is listening and the first round is complete
+			ready = true
+			if err := sdNotify("READY=1"); err != nil {
+				slog.Error("Error notifying systemd", "error", err)
+			}
+		}
+
+		wait := interval - time.Since(roundStart)
+		if wait <= 0 {
+			slog.Warn("Check round took longer than the interval, consider raising --max-concurrent-checks or --timeout", "duration", time.Since(roundStart), "interval", interval)
+			wait = 0
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(wait):
+		}
+	}
+
+	shutdown(servers, args, shutdownTimeout)
+	return 0
+}
+
+// startServer serves handler on address in the background, using HTTPS if
+// tlsConfig is set. Errors are only logged so the checks keep running without
+// the server.
+func startServer(address string, handler http.Handler, tlsArgs tlsArgs, tlsConfig *tls.Config) *http.Server {
+	server := &http.Server{Handler: handler}
+	slog.Info("Starting server", "address", address, "tls", tlsConfig != nil)
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		slog.Error("Error starting server", "address", address, "error", err)
+		return server
+	}
+	if tlsConfig != nil {
+		server.Handler = hstsHandler(tlsArgs, handler)
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Error starting server", "address", address, "error", err)
+		}
+	}()
+	return server
+}
+
+// shutdownRequested is closed to stop serve without a signal, e.g. by the
+// Windows service control manager.
+var shutdownRequested = make(chan struct{})
+
+// runCheckRound checks all targets, notifies about state changes, persists
+// the result and sends it to all websocket clients.
+func runCheckRound(ctx context.Context, args args) {
+	checkWatchdog.tick()
+	roundStart := time.Now()
+	previousHealth := snapshotHealth()
+	previousDegraded := snapshotDegraded()
+	updateStatusState(ctx)
+	selfMetrics.lastRoundDuration.Store(int64(time.Since(roundStart)))
+	selfMetrics.rounds.Add(1)
+	stateMu.RLock()
+	pingUrl := config.PingUrl
+	stateMu.RUnlock()
+	if pingUrl != "" {
+		sendPing(pingUrl, true, false)
+	}
+	notifyStateChanges(detectStateChanges(previousHealth), time.Duration(args.gracePeriod)*time.Second)
+	notifyAlerts(detectAnomalies(previousDegraded), time.Duration(args.gracePeriod)*time.Second)
+	notifyAlerts(detectBurnRates(time.Now()), time.Duration(args.gracePeriod)*time.Second)
+	slog.Debug("Check round complete", "clients", hub.clients.Load())
+	statusView := StatusStatesToView()
+	if statsd != nil {
+		statsd.emit(statusView)
+	}
+	if mqtt != nil {
+		mqtt.publish(statusView)
+	}
+	if zabbix != nil {
+		zabbix.emit(statusView)
+	}
+	if !args.noPersist {
+		persistInterval := time.Duration(args.persistInterval) * time.Second
+		persistRound(statusView, args.dataPath, persistInterval)
+		if time.Since(lastHistoryFlush) >= max(historyFlushInterval, persistInterval) {
+			lastHistoryFlush = time.Now()
+			if err := saveHistory(args.dataPath); err != nil {
+				slog.Error("Error saving recent history", "error", err)
+			}
+		}
+	}
+	broadcastStatus(statusView)
+}
+
+// persistFlushInterval is how often the state is written when only response
+// times and check times changed, writing it after every round wears out SD
+// cards.
+const persistFlushInterval = 5 * time.Minute
+
+// lastPersisted are the significant fields of the written state and
+// lastPersist when it was written, they are only used by the check loop.
+var (
+	lastPersisted []byte
+	lastPersist   time.Time
+)
+
+// persistRound saves the state and the uptime history if an item changed
+// since they were last written or persistFlushInterval passed, but not
+// before interval passed since the last write.
+func persistRound(statusView []StatusView, dataPath string, interval time.Duration) {
+	if time.Since(lastPersist) < interval {
+		return
+	}
+	significant, err := significantState(statusView)
+	if err == nil && bytes.Equal(significant, lastPersisted) && time.Since(lastPersist) < persistFlushInterval {
+		return
+	}
+	// a failed write is retried with the next round
+	if err := persistStatusState(statusView, dataPath); err != nil {
+		slog.Error("Error saving status state", "error", err)
+		return
+	}
+	if err := saveUptime(dataPath); err != nil {
+		slog.Error("Error saving uptime history", "error", err)
+		return
+	}
+	lastPersisted, lastPersist = significant, time.Now()
+}
+
+// persistStatusState saves the state and creates the data directory if it
+// doesn't exist yet.
+func persistStatusState(statusView []StatusView, dataPath string) error {
+	err := saveStatusState(statusView, dataPath)
+	if errors.Is(err, syscall.ENOENT) {
+		slog.Info("Data directory not found while saving status state, creating it", "path", dataPath)
+		if err := os.MkdirAll(dataPath, os.ModePerm); err != nil {
+			return fmt.Errorf("creating directory %s: %w", dataPath, err)
+		}
+		slog.Info("Retrying to save status state")
+		err = saveStatusState(statusView, dataPath)
+	}
+	return err
+}
+
+// shutdown saves the latest state and releases all resources before serve
+// returns.
+func shutdown(servers []*http.Server, args args, timeout time.Duration) {
+	slog.Info("Shutting down")
+	if err := sdNotify("STOPPING=1"); err != nil {
+		slog.Error("Error notifying systemd", "error", err)
+	}
+
+	if !args.noPersist {
+		if err := persistStatusState(StatusStatesToView(), args.dataPath); err != nil {
+			slog.Error("Error saving status state", "error", err)
+		}
+		if err := saveUptime(args.dataPath); err != nil {
+			slog.Error("Error saving uptime history", "error", err)
+		}
+		if err := saveHistory(args.dataPath); err != nil {
+			slog.Error("Error saving recent history", "error", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if mqtt != nil {
+		mqtt.close()
+	}
+
+	// hijacked websocket connections are not closed by server.Shutdown
+	hub.closeAll()
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil {
+			slog.Error("Error shutting down server", "error", err)
+		}
+	}
+
+	waitForNotifications(ctx)
+	if tracer != nil {
+		tracer.flush()
+	}
+	exportMetrics()
+	events.close()
+
+	if args.pidFile != "" {
+		os.Remove(args.pidFile)
+	}
+	slog.Info("Shutdown complete")
+}
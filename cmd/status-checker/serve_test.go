@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPersistRound(t *testing.T) {
+	previous, previousTime := lastPersisted, lastPersist
+	lastPersisted, lastPersist = nil, time.Time{}
+	t.Cleanup(func() { lastPersisted, lastPersist = previous, previousTime })
+
+	dir := filepath.Join(t.TempDir(), "data")
+	dataPath := dir + "/"
+	views := []StatusView{{Url: "https://a.example.com/", Healthy: true, LastHealth: 1767322800}}
+	written := func() bool {
+		_, err := os.Stat(dataPath + "status_state.json")
+		return err == nil
+	}
+
+	// the data directory can't be created where a file is
+	if err := os.WriteFile(dir, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	persistRound(views, dataPath, 0)
+	if lastPersisted != nil || !lastPersist.IsZero() {
+		t.Fatalf("failed write counted as persisted")
+	}
+
+	// the next round retries
+	if err := os.Remove(dir); err != nil {
+		t.Fatal(err)
+	}
+	persistRound(views, dataPath, 0)
+	if !written() || lastPersisted == nil {
+		t.Fatalf("state not written once the data directory can be created")
+	}
+
+	// unchanged items aren't written again
+	os.Remove(dataPath + "status_state.json")
+	views[0].LastHealth++
+	persistRound(views, dataPath, 0)
+	if written() {
+		t.Errorf("unchanged state written again")
+	}
+	views[0].Healthy = false
+	persistRound(views, dataPath, 0)
+	if !written() {
+		t.Errorf("changed state not written")
+	}
+
+	// the interval holds back changes
+	os.Remove(dataPath + "status_state.json")
+	views[0].Healthy = true
+	persistRound(views, dataPath, time.Hour)
+	if written() {
+		t.Errorf("state written within the persist interval")
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+func newServiceFlagSet(name *string) *flag.FlagSet {
+	return flag.NewFlagSet("service", flag.ExitOnError)
+}
+
+func runService(arguments []string) int {
+	fmt.Fprintln(os.Stderr, "Error: running as a service is only supported on Windows, use systemd with Type=notify instead")
+	return 1
+}
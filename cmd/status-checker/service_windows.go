@@ -0,0 +1,250 @@
+//go:build windows
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+const serviceUsage = `Usage: %s service <install|uninstall|start|stop|run> [flags] [-- serve flags]
+
+Manages the checker as a Windows service. The serve flags given on install are
+used whenever the service runs, use absolute paths for config, static and data.
+`
+
+func newServiceFlagSet(name *string) *flag.FlagSet {
+	fs := flag.NewFlagSet("service", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), serviceUsage, os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.StringVar(name, "name", "status-checker", "name of the Windows service (default status-checker)")
+	return fs
+}
+
+func runService(arguments []string) int {
+	var name string
+	fs := newServiceFlagSet(&name)
+
+	if len(arguments) == 0 {
+		fs.Usage()
+		return 2
+	}
+	verb := arguments[0]
+	parseFlags(fs, arguments[1:])
+	serveArguments := fs.Args()
+
+	var err error
+	switch verb {
+	case "install":
+		err = installService(name, serveArguments)
+	case "uninstall":
+		err = uninstallService(name)
+	case "start":
+		err = startService(name)
+	case "stop":
+		err = stopService(name)
+	case "run":
+		err = runAsService(name, serveArguments)
+	default:
+		fs.Usage()
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s service %s: %s\n", verb, name, err)
+		return 1
+	}
+	return 0
+}
+
+func installService(name string, serveArguments []string) error {
+	exePath, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	exePath, err = filepath.Abs(exePath)
+	if err != nil {
+		return err
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	if s, err := m.OpenService(name); err == nil {
+		s.Close()
+		return fmt.Errorf("service already exists")
+	}
+
+	serviceArguments := append([]string{"service", "run", "--name", name, "--"}, serveArguments...)
+	s, err := m.CreateService(name, exePath, mgr.Config{
+		DisplayName: "Status Checker",
+		Description: "Checks the health of HTTP services and serves a status page",
+		StartType:   mgr.StartAutomatic,
+	}, serviceArguments...)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	if err := eventlog.InstallAsEventCreate(name, eventlog.Error|eventlog.Warning|eventlog.Info); err != nil {
+		s.Delete()
+		return fmt.Errorf("installing event log source: %w", err)
+	}
+
+	fmt.Printf("Installed service %s: %s %s\n", name, exePath, strings.Join(serviceArguments, " "))
+	return nil
+}
+
+func uninstallService(name string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(name)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	if err := s.Delete(); err != nil {
+		return err
+	}
+	if err := eventlog.Remove(name); err != nil {
+		return fmt.Errorf("removing event log source: %w", err)
+	}
+
+	fmt.Printf("Uninstalled service %s\n", name)
+	return nil
+}
+
+func startService(name string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(name)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	return s.Start()
+}
+
+func stopService(name string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(name)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	status, err := s.Control(svc.Stop)
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(30 * time.Second)
+	for status.State != svc.Stopped {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for the service to stop")
+		}
+		time.Sleep(300 * time.Millisecond)
+		if status, err = s.Query(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// eventLogWriter forwards log lines to the Windows event log.
+type eventLogWriter struct {
+	elog *eventlog.Log
+}
+
+func (w eventLogWriter) Write(p []byte) (int, error) {
+	message := strings.TrimSpace(string(p))
+	var err error
+	if strings.Contains(message, "level=ERROR") || strings.Contains(message, `"level":"ERROR"`) {
+		err = w.elog.Error(1, message)
+	} else {
+		err = w.elog.Info(1, message)
+	}
+	return len(p), err
+}
+
+type windowsService struct {
+	serveArguments []string
+}
+
+func (s windowsService) Execute(arguments []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+	done := make(chan struct{})
+	go func() {
+		runServe(s.serveArguments)
+		close(done)
+	}()
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for {
+		select {
+		case <-done:
+			return false, 0
+		case request := <-requests:
+			switch request.Cmd {
+			case svc.Interrogate:
+				status <- request.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				slog.Info("Stopping service")
+				status <- svc.Status{State: svc.StopPending}
+				close(shutdownRequested)
+				<-done
+				return false, 0
+			}
+		}
+	}
+}
+
+// runAsService is called by the service control manager.
+func runAsService(name string, serveArguments []string) error {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		return err
+	}
+	if !isService {
+		return fmt.Errorf("not started by the service control manager, use start instead")
+	}
+
+	elog, err := eventlog.Open(name)
+	if err != nil {
+		return err
+	}
+	defer elog.Close()
+	logOutput = eventLogWriter{elog}
+
+	slog.Info("Starting service", "name", name)
+	return svc.Run(name, windowsService{serveArguments})
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"time"
+)
+
+// States of simulation phases.
+const (
+	simulateUp   = "up"
+	simulateSlow = "slow"
+	simulateDown = "down"
+)
+
+// defaultSimulatedLatency is the response time of a simulated target in
+// milliseconds if it doesn't set one, slow phases take ten times as long.
+const defaultSimulatedLatency = 100
+
+// Simulation makes a target report synthetic results instead of being
+// requested, to exercise the status page, notifiers and alerts without
+// breaking a real service. The Schedule repeats from the start of the
+// checker, Latency is the response time of up phases in milliseconds.
+type Simulation struct {
+	Schedule []SimulationPhase `json:"schedule,omitempty"`
+	Latency  int               `json:"latency,omitempty"`
+}
+
+// SimulationPhase is a State, up, slow or down, that lasts Seconds. Latency
+// overrides the response time of the phase in milliseconds.
+type SimulationPhase struct {
+	State   string `json:"state"`
+	Seconds int    `json:"seconds"`
+	Latency int    `json:"latency,omitempty"`
+}
+
+// defaultSchedule is used by the --simulate flag for the targets without a
+// simulation and by simulations without a schedule.
+var defaultSchedule = []SimulationPhase{
+	{State: simulateUp, Seconds: 300},
+	{State: simulateSlow, Seconds: 60},
+	{State: simulateUp, Seconds: 240},
+	{State: simulateDown, Seconds: 120},
+}
+
+// simulateAll is set by the --simulate flag, no target is requested.
+var simulateAll bool
+
+func (s Simulation) validate() error {
+	if s.Latency < 0 {
+		return fmt.Errorf("simulation latency can't be negative")
+	}
+	for _, phase := range s.Schedule {
+		switch phase.State {
+		case simulateUp, simulateSlow, simulateDown:
+		default:
+			return fmt.Errorf("simulation phase state %q has to be up, slow or down", phase.State)
+		}
+		if phase.Seconds <= 0 {
+			return fmt.Errorf("simulation phases have to last at least a second")
+		}
+		if phase.Latency < 0 {
+			return fmt.Errorf("simulation phase latency can't be negative")
+		}
+	}
+	return nil
+}
+
+// phase returns the phase of the schedule at now. The default schedule is
+// shifted by a hash of the target, so simulated targets don't all change at
+// once.
+func (s Simulation) phase(item string, now time.Time) SimulationPhase {
+	schedule := s.Schedule
+	var offset time.Duration
+	if len(schedule) == 0 {
+		schedule = defaultSchedule
+		h := fnv.New32a()
+		h.Write([]byte(item))
+		offset = time.Duration(h.Sum32()) * time.Second
+	}
+	var cycle time.Duration
+	for _, phase := range schedule {
+		cycle += time.Duration(phase.Seconds) * time.Second
+	}
+	elapsed := (now.Sub(startTime) + offset) % cycle
+	for _, phase := range schedule {
+		elapsed -= time.Duration(phase.Seconds) * time.Second
+		if elapsed < 0 {
+			return phase
+		}
+	}
+	return schedule[len(schedule)-1]
+}
+
+// simulateCheck returns the result of the current phase of the simulation,
+// response times vary by up to 20%.
+func simulateCheck(ctx context.Context, target Target, now time.Time) statusUpdate {
+	simulation := Simulation{}
+	if target.Simulate != nil {
+		simulation = *target.Simulate
+	}
+	phase := simulation.phase(target.Url, now)
+
+	latency := phase.Latency
+	if latency == 0 {
+		latency = simulation.Latency
+		if latency == 0 {
+			latency = defaultSimulatedLatency
+		}
+		if phase.State == simulateSlow {
+			latency *= 10
+		}
+	}
+	responseTime := time.Duration(float64(latency)*(0.8+0.4*rand.Float64())) * time.Millisecond
+
+	state := StatusState{Healthy: true, ResponseCode: 200, ResponseTime: responseTime, Protocol: "HTTP/1.1", LastHealthy: now}
+	if phase.State == simulateDown {
+		state = StatusState{Healthy: false, ResponseCode: 503, ResponseTime: responseTime, Protocol: "HTTP/1.1", LastUnhealthy: now}
+	}
+	checkLog.Log(ctx, levelTrace, "Simulated check", "target", target.Url, "phase", phase.State, "responseCode", state.ResponseCode)
+	return statusUpdate{item: target.Url, state: state}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSimulationPhase(t *testing.T) {
+	simulation := Simulation{Schedule: []SimulationPhase{
+		{State: simulateUp, Seconds: 10},
+		{State: simulateDown, Seconds: 5, Latency: 20},
+		{State: simulateSlow, Seconds: 1},
+	}}
+	tests := []struct {
+		elapsed time.Duration
+		state   string
+	}{
+		{0, simulateUp},
+		{9900 * time.Millisecond, simulateUp},
+		{10 * time.Second, simulateDown},
+		{14 * time.Second, simulateDown},
+		{15 * time.Second, simulateSlow},
+		// the schedule repeats every 16 seconds
+		{16 * time.Second, simulateUp},
+		{26 * time.Second, simulateDown},
+		{16*time.Hour + 15*time.Second, simulateSlow},
+	}
+	for _, test := range tests {
+		if phase := simulation.phase("https://sim.example.com/", startTime.Add(test.elapsed)); phase.State != test.state {
+			t.Errorf("phase after %s = %s, want %s", test.elapsed, phase.State, test.state)
+		}
+	}
+	if phase := simulation.phase("https://sim.example.com/", startTime.Add(12*time.Second)); phase.Latency != 20 {
+		t.Errorf("phase latency = %d, want the latency of the down phase", phase.Latency)
+	}
+}
+
+func TestSimulationDefaultSchedule(t *testing.T) {
+	cycle := 0
+	want := make(map[string]int)
+	for _, phase := range defaultSchedule {
+		cycle += phase.Seconds
+		want[phase.State] += phase.Seconds
+	}
+
+	// items are shifted differently but spend the same time in each state
+	sequences := make(map[string]bool)
+	for _, item := range []string{"https://a.example.com/", "https://b.example.com/", "https://c.example.com/"} {
+		seconds := make(map[string]int)
+		sequence := ""
+		for s := range cycle {
+			state := Simulation{}.phase(item, startTime.Add(time.Duration(s)*time.Second)).State
+			seconds[state]++
+			sequence += state[:1]
+		}
+		for state, n := range want {
+			if seconds[state] != n {
+				t.Errorf("%s is %s for %d of %d seconds, want %d", item, state, seconds[state], cycle, n)
+			}
+		}
+		sequences[sequence] = true
+	}
+	if len(sequences) == 1 {
+		t.Errorf("all items change at the same time with the default schedule")
+	}
+}
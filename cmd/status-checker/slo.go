@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// defaultSloDays is the period of an SLO if the config doesn't set days.
+const defaultSloDays = 30
+
+// burnRule fires if the error budget is burned at least rate times faster
+// than allowed over both windows, the short one makes it end soon after the
+// errors stop.
+type burnRule struct {
+	long  time.Duration
+	short time.Duration
+	rate  float64
+}
+
+// burnRules are the multi-window rules of the Google SRE workbook, 2% of a
+// 30 day budget in an hour and 5% in six hours.
+var burnRules = []burnRule{
+	{long: time.Hour, short: 5 * time.Minute, rate: 14.4},
+	{long: 6 * time.Hour, short: 30 * time.Minute, rate: 6},
+}
+
+// burnWindow is the longest window of the burnRules.
+const burnWindow = 6 * time.Hour
+
+// SLO is the objective of a target, the percentage of healthy checks over
+// Days days. The error budget is the remaining share of checks, it is alerted
+// about when it is burned too fast, see burnRules.
+type SLO struct {
+	Objective float64 `json:"objective"`
+	Days      int     `json:"days,omitempty"`
+}
+
+func (s SLO) validate() error {
+	if s.Objective <= 0 || s.Objective >= 100 {
+		return fmt.Errorf("slo objective has to be a percentage between 0 and 100")
+	}
+	if s.Days < 0 || s.Days > uptimeDays {
+		return fmt.Errorf("slo days have to be between 1 and %d", uptimeDays)
+	}
+	return nil
+}
+
+func (s SLO) days() int {
+	if s.Days == 0 {
+		return defaultSloDays
+	}
+	return s.Days
+}
+
+// budget is the allowed share of unhealthy checks.
+func (s SLO) budget() float64 {
+	return 1 - s.Objective/100
+}
+
+// burnBucket counts the checks of a target in one minute.
+type burnBucket struct {
+	minute int64 // unix minutes
+	checks int
+	failed int
+}
+
+var (
+	sloMu sync.Mutex
+	// burnBuckets are the checks of the last burnWindow of the targets with
+	// an SLO, oldest first.
+	burnBuckets = make(map[string][]burnBucket)
+	// burning are the targets an alert is firing for.
+	burning = make(map[string]bool)
+)
+
+// recordBurn counts a check result of a target with an SLO.
+func recordBurn(item string, healthy bool, now time.Time) {
+	sloMu.Lock()
+	defer sloMu.Unlock()
+
+	minute := now.Unix() / 60
+	buckets := burnBuckets[item]
+	if len(buckets) == 0 || buckets[len(buckets)-1].minute != minute {
+		buckets = append(buckets, burnBucket{minute: minute})
+	}
+	buckets[len(buckets)-1].checks++
+	if !healthy {
+		buckets[len(buckets)-1].failed++
+	}
+
+	oldest := minute - int64(burnWindow/time.Minute)
+	for len(buckets) > 0 && buckets[0].minute < oldest {
+		buckets = buckets[1:]
+	}
+	burnBuckets[item] = buckets
+}
+
+// burnRate returns the share of failed checks in the window divided by the
+// budget, ok is false if there were no checks. The caller has to hold sloMu.
+func burnRate(item string, slo SLO, window time.Duration, now time.Time) (rate float64, ok bool) {
+	oldest := (now.Unix() - int64(window/time.Second)) / 60
+	checks, failed := 0, 0
+	for _, bucket := range burnBuckets[item] {
+		if bucket.minute > oldest {
+			checks += bucket.checks
+			failed += bucket.failed
+		}
+	}
+	if checks == 0 {
+		return 0, false
+	}
+	return float64(failed) / float64(checks) / slo.budget(), true
+}
+
+// burnRuleFiring returns the first rule whose windows both burn too fast. A
+// rule only applies once the checks cover its long window, so a few errors
+// after a restart don't look like a burned budget. The caller has to hold
+// sloMu.
+func burnRuleFiring(item string, slo SLO, now time.Time) (burnRule, bool) {
+	buckets := burnBuckets[item]
+	for _, rule := range burnRules {
+		if len(buckets) == 0 || buckets[0].minute > now.Unix()/60-int64(rule.long/time.Minute) {
+			continue
+		}
+		long, _ := burnRate(item, slo, rule.long, now)
+		short, _ := burnRate(item, slo, rule.short, now)
+		if long >= rule.rate && short >= rule.rate {
+			return rule, true
+		}
+	}
+	return burnRule{}, false
+}
+
+// budgetRemaining returns the share of the error budget of the SLO period
+// that is left, negative if it is exhausted. ok is false without checks.
+func budgetRemaining(item string, slo SLO, now time.Time) (remaining float64, ok bool) {
+	checks, healthy := uptimeCounts(item, slo.days(), now)
+	if checks == 0 {
+		return 0, false
+	}
+	allowed := float64(checks) * slo.budget()
+	return 1 - float64(checks-healthy)/allowed, true
+}
+
+// detectBurnRates returns the alerts for the targets whose error budget
+// started or stopped burning too fast.
+func detectBurnRates(now time.Time) []alert {
+	stateMu.RLock()
+	slos := make(map[string]SLO)
+	for _, target := range config.Targets {
+		if target.Slo != nil {
+			slos[target.Url] = *target.Slo
+		}
+	}
+	stateMu.RUnlock()
+
+	sloMu.Lock()
+	defer sloMu.Unlock()
+	var alerts []alert
+	for item := range burnBuckets {
+		if _, ok := slos[item]; !ok {
+			delete(burnBuckets, item)
+			delete(burning, item)
+		}
+	}
+	for item, slo := range slos {
+		rule, firing := burnRuleFiring(item, slo, now)
+		if firing == burning[item] {
+			continue
+		}
+		if firing {
+			burning[item] = true
+			message := fmt.Sprintf("error budget of %g%% over %d days is burned more than %gx too fast over %s", slo.Objective, slo.days(), rule.rate, formatWindow(rule.long))
+			alerts = append(alerts, alert{Target: item, Alert: alertSloBurnRate, Firing: true, Message: message, Time: now})
+		} else {
+			delete(burning, item)
+			message := fmt.Sprintf("error budget of %g%% over %d days is no longer burned too fast", slo.Objective, slo.days())
+			alerts = append(alerts, alert{Target: item, Alert: alertSloBurnRate, Message: message, Time: now})
+		}
+	}
+	return alerts
+}
+
+// formatWindow formats the windows of burnRules, e.g. 1h or 30m.
+func formatWindow(window time.Duration) string {
+	if window%time.Hour == 0 {
+		return fmt.Sprintf("%dh", window/time.Hour)
+	}
+	return fmt.Sprintf("%dm", window/time.Minute)
+}
+
+// sloStatus is the state of the SLO of a target in /api/targets/{target}.
+// BurnRates are by window, e.g. 1h, and only contain windows with checks.
+type sloStatus struct {
+	Objective       float64            `json:"objective"`
+	Days            int                `json:"days"`
+	BudgetRemaining *float64           `json:"budgetRemaining,omitempty"`
+	BurnRates       map[string]float64 `json:"burnRates"`
+	Burning         bool               `json:"burning"`
+}
+
+func sloSnapshot(item string, slo SLO, now time.Time) *sloStatus {
+	status := &sloStatus{Objective: slo.Objective, Days: slo.days(), BurnRates: make(map[string]float64)}
+	if remaining, ok := budgetRemaining(item, slo, now); ok {
+		status.BudgetRemaining = &remaining
+	}
+	sloMu.Lock()
+	defer sloMu.Unlock()
+	for _, rule := range burnRules {
+		for _, window := range []time.Duration{rule.short, rule.long} {
+			if rate, ok := burnRate(item, slo, window, now); ok {
+				status.BurnRates[formatWindow(window)] = rate
+			}
+		}
+	}
+	status.Burning = burning[item]
+	return status
+}
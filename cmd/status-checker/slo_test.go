@@ -0,0 +1,92 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// setBurnBuckets sets one check per minute of the last minutes of item,
+// failed reports whether the check the given minutes ago failed.
+func setBurnBuckets(t *testing.T, item string, now time.Time, minutes int, failed func(ago int) bool) {
+	t.Helper()
+	sloMu.Lock()
+	defer sloMu.Unlock()
+	var buckets []burnBucket
+	for ago := minutes - 1; ago >= 0; ago-- {
+		bucket := burnBucket{minute: now.Unix()/60 - int64(ago), checks: 1}
+		if failed(ago) {
+			bucket.failed = 1
+		}
+		buckets = append(buckets, bucket)
+	}
+	burnBuckets[item] = buckets
+	t.Cleanup(func() {
+		sloMu.Lock()
+		defer sloMu.Unlock()
+		delete(burnBuckets, item)
+	})
+}
+
+func TestBurnRate(t *testing.T) {
+	const item = "https://slo.example.com/"
+	slo := SLO{Objective: 99}
+	now := time.Date(2026, 1, 2, 12, 0, 30, 0, time.UTC)
+	// the last ten minutes failed
+	setBurnBuckets(t, item, now, 120, func(ago int) bool { return ago < 10 })
+
+	tests := []struct {
+		window time.Duration
+		rate   float64
+	}{
+		{5 * time.Minute, 100},
+		{10 * time.Minute, 100},
+		{20 * time.Minute, 50},
+		{time.Hour, 100.0 / 6},
+		{6 * time.Hour, 100.0 / 12},
+	}
+	sloMu.Lock()
+	defer sloMu.Unlock()
+	for _, test := range tests {
+		rate, ok := burnRate(item, slo, test.window, now)
+		if !ok || math.Abs(rate-test.rate) > 1e-9 {
+			t.Errorf("burnRate over %s = %g, %t, want %g", test.window, rate, ok, test.rate)
+		}
+	}
+	if rate, ok := burnRate("https://unknown.example.com/", slo, time.Hour, now); ok || rate != 0 {
+		t.Errorf("burnRate without checks = %g, %t, want 0, false", rate, ok)
+	}
+}
+
+func TestBurnRuleFiring(t *testing.T) {
+	const item = "https://slo.example.com/"
+	slo := SLO{Objective: 99}
+	now := time.Date(2026, 1, 2, 12, 0, 30, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		minutes int
+		failed  func(ago int) bool
+		firing  bool
+		long    time.Duration
+	}{
+		{"healthy", 361, func(int) bool { return false }, false, 0},
+		{"within budget", 361, func(ago int) bool { return ago%100 == 0 }, false, 0},
+		{"failing since the start", 30, func(int) bool { return true }, false, 0},
+		{"failing for an hour", 90, func(ago int) bool { return ago < 60 }, true, time.Hour},
+		{"recovered five minutes ago", 90, func(ago int) bool { return ago >= 5 && ago < 60 }, false, 0},
+		{"slow burn", 361, func(ago int) bool { return ago >= 10 && ago < 60 }, true, 6 * time.Hour},
+		{"slow burn recovered", 361, func(ago int) bool { return ago >= 35 && ago < 60 }, false, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setBurnBuckets(t, item, now, test.minutes, test.failed)
+			sloMu.Lock()
+			rule, firing := burnRuleFiring(item, slo, now)
+			sloMu.Unlock()
+			if firing != test.firing || rule.long != test.long {
+				t.Errorf("burnRuleFiring = %v, %t, want the %s rule firing %t", rule, firing, test.long, test.firing)
+			}
+		})
+	}
+}
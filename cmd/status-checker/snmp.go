@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/asn1"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultSnmpEnterpriseOid is below netSnmpPlaypen of the NET-SNMP-MIB, which
+// is meant for experiments. Set enterpriseOid to an OID of your own private
+// enterprise number in production.
+const defaultSnmpEnterpriseOid = "1.3.6.1.4.1.8072.9999.9999.1"
+
+// SnmpTrap is a trap receiver that gets an SNMPv2c trap for every state
+// change. The traps are <enterpriseOid>.0.1 for unhealthy and .0.2 for
+// healthy with the variables <enterpriseOid>.1.1 item, .1.2 healthy as 1 or 0
+// and .1.3 response code.
+type SnmpTrap struct {
+	// Address is host:port, the port is 162 if missing.
+	Address   string `json:"address"`
+	Community string `json:"community,omitempty"` // public if not set
+	// EnterpriseOid is defaultSnmpEnterpriseOid if not set.
+	EnterpriseOid string `json:"enterpriseOid,omitempty"`
+}
+
+func (t SnmpTrap) validate() error {
+	if t.Address == "" {
+		return fmt.Errorf("snmp trap receiver without address")
+	}
+	if t.EnterpriseOid != "" {
+		if _, err := parseOid(t.EnterpriseOid); err != nil {
+			return fmt.Errorf("snmp trap receiver %s: %w", t.Address, err)
+		}
+	}
+	return nil
+}
+
+func parseOid(oid string) (asn1.ObjectIdentifier, error) {
+	var parsed asn1.ObjectIdentifier
+	for _, part := range strings.Split(strings.TrimPrefix(oid, "."), ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid OID %q", oid)
+		}
+		parsed = append(parsed, n)
+	}
+	if len(parsed) < 2 || parsed[0] > 2 {
+		return nil, fmt.Errorf("invalid OID %q", oid)
+	}
+	return parsed, nil
+}
+
+// OIDs every SNMPv2 trap starts with, RFC 3416.
+var (
+	sysUpTimeOid   = asn1.ObjectIdentifier{1, 3, 6, 1, 2, 1, 1, 3, 0}
+	snmpTrapOidOid = asn1.ObjectIdentifier{1, 3, 6, 1, 6, 3, 1, 1, 4, 1, 0}
+)
+
+type snmpVarbind struct {
+	Name  asn1.ObjectIdentifier
+	Value asn1.RawValue
+}
+
+// snmpPdu is encoded as SNMPv2-Trap-PDU with the tag:7 parameter.
+type snmpPdu struct {
+	RequestId   int32
+	ErrorStatus int
+	ErrorIndex  int
+	Varbinds    []snmpVarbind
+}
+
+type snmpMessage struct {
+	Version   int // 1 is SNMPv2c
+	Community []byte
+	Pdu       asn1.RawValue
+}
+
+func snmpValue(value any, params string) (asn1.RawValue, error) {
+	encoded, err := asn1.MarshalWithParams(value, params)
+	return asn1.RawValue{FullBytes: encoded}, err
+}
+
+// encodeSnmpTrap returns the SNMPv2c trap message of change, uptime is the
+// time since the checker was started.
+func encodeSnmpTrap(trap SnmpTrap, change stateChange, uptime time.Duration) ([]byte, error) {
+	enterprise := trap.EnterpriseOid
+	if enterprise == "" {
+		enterprise = defaultSnmpEnterpriseOid
+	}
+	base, err := parseOid(enterprise)
+	if err != nil {
+		return nil, err
+	}
+	oid := func(suffix ...int) asn1.ObjectIdentifier {
+		return append(slices.Clone(base), suffix...)
+	}
+
+	trapOid := oid(0, 1)
+	healthy := 0
+	if change.Healthy {
+		trapOid = oid(0, 2)
+		healthy = 1
+	}
+	// TimeTicks are hundredths of a second and wrap around at 2^32
+	ticks := int64(uptime/(10*time.Millisecond)) % (1 << 32)
+
+	values := []struct {
+		name   asn1.ObjectIdentifier
+		value  any
+		params string
+	}{
+		{sysUpTimeOid, ticks, "application,tag:3"},
+		{snmpTrapOidOid, trapOid, ""},
+		{oid(1, 1), []byte(change.Target), ""},
+		{oid(1, 2), healthy, ""},
+		{oid(1, 3), change.ResponseCode, ""},
+	}
+	pdu := snmpPdu{RequestId: rand.Int32()}
+	for _, v := range values {
+		value, err := snmpValue(v.value, v.params)
+		if err != nil {
+			return nil, err
+		}
+		pdu.Varbinds = append(pdu.Varbinds, snmpVarbind{Name: v.name, Value: value})
+	}
+	encodedPdu, err := asn1.MarshalWithParams(pdu, "tag:7")
+	if err != nil {
+		return nil, err
+	}
+
+	community := trap.Community
+	if community == "" {
+		community = "public"
+	}
+	return asn1.Marshal(snmpMessage{Version: 1, Community: []byte(community), Pdu: asn1.RawValue{FullBytes: encodedPdu}})
+}
+
+type snmpTrapNotifier struct {
+	trap SnmpTrap
+}
+
+// notify sends the trap over UDP, there is no acknowledgement so only
+// encoding and local network errors are reported.
+func (n snmpTrapNotifier) notify(change stateChange) error {
+	message, err := encodeSnmpTrap(n.trap, change, time.Since(startTime))
+	if err != nil {
+		return err
+	}
+	address := n.trap.Address
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, "162")
+	}
+	conn, err := net.DialTimeout("udp", address, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write(message)
+	return err
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Defaults of the policy for targets added through the API, blocking
+// loopback, unspecified, link-local and private addresses and the cloud
+// metadata services. The metadata addresses within private ranges stay
+// denied if those ranges are allowed.
+const (
+	defaultAPITargetSchemes   = "http,https"
+	defaultAPITargetDenyCIDRs = "127.0.0.0/8,::1/128,0.0.0.0/8,::/128,169.254.0.0/16,fe80::/10,10.0.0.0/8,172.16.0.0/12,192.168.0.0/16,fc00::/7,100.64.0.0/10,fd00:ec2::254/128,100.100.100.200/32"
+	defaultAPITargetDenyHosts = "metadata.google.internal"
+)
+
+// targetPolicy restricts what targets added through the management API may
+// reach, so the API can't be used to scan the internal network. Targets of
+// the config file are trusted and not restricted.
+type targetPolicy struct {
+	schemes    []string
+	allowHosts []string
+	denyHosts  []string
+	allowCIDRs []netip.Prefix
+	denyCIDRs  []netip.Prefix
+}
+
+// apiTargetPolicy is set from the --api-target-* flags.
+var apiTargetPolicy = &targetPolicy{}
+
+func newTargetPolicy(schemes, allowHosts, denyHosts, allowCIDRs, denyCIDRs string) (*targetPolicy, error) {
+	policy := &targetPolicy{
+		schemes:    splitList(schemes),
+		allowHosts: splitList(allowHosts),
+		denyHosts:  splitList(denyHosts),
+	}
+	var err error
+	if policy.allowCIDRs, err = parseAllowlist(allowCIDRs); err != nil {
+		return nil, err
+	}
+	if policy.denyCIDRs, err = parseAllowlist(denyCIDRs); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, strings.ToLower(item))
+		}
+	}
+	return items
+}
+
+// hostMatches matches a host against a pattern, which is either a host name
+// or *.domain matching all subdomains.
+func hostMatches(pattern string, host string) bool {
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	return pattern == host
+}
+
+// checkUrl checks scheme and host of a target url. Addresses are checked
+// again when connecting, as names may resolve to a different one later.
+func (p *targetPolicy) checkUrl(u *url.URL) error {
+	if len(p.schemes) > 0 && !slices.Contains(p.schemes, strings.ToLower(u.Scheme)) {
+		return fmt.Errorf("scheme %q is not allowed", u.Scheme)
+	}
+
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "" {
+		return errors.New("url without host")
+	}
+	matches := func(pattern string) bool { return hostMatches(pattern, host) }
+	if slices.ContainsFunc(p.denyHosts, matches) {
+		return fmt.Errorf("host %q is not allowed", host)
+	}
+	if len(p.allowHosts) > 0 && !slices.ContainsFunc(p.allowHosts, matches) {
+		return fmt.Errorf("host %q is not in the allowed hosts", host)
+	}
+
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return p.checkAddr(addr)
+	}
+	return nil
+}
+
+// checkAddr checks an address against the ranges. The most specific range
+// containing it decides, so an allowed range within a denied one opts in to
+// it, and a denied range wins over an allowed one of the same size.
+func (p *targetPolicy) checkAddr(addr netip.Addr) error {
+	addr = addr.Unmap()
+	denied, allowed := longestMatch(p.denyCIDRs, addr), longestMatch(p.allowCIDRs, addr)
+	if denied >= 0 && denied >= allowed {
+		return fmt.Errorf("address %s is not allowed", addr)
+	}
+	if len(p.allowCIDRs) > 0 && allowed < 0 {
+		return fmt.Errorf("address %s is not in the allowed ranges", addr)
+	}
+	return nil
+}
+
+// longestMatch returns the length of the longest prefix containing addr, -1
+// if none does.
+func longestMatch(prefixes []netip.Prefix, addr netip.Addr) int {
+	longest := -1
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			longest = max(longest, prefix.Bits())
+		}
+	}
+	return longest
+}
+
+// managedCheckClient checks targets added through the API and sends their
+// pings. It enforces apiTargetPolicy on every connection and redirect, it
+// doesn't use a proxy as the policy would only see the proxy's address.
+var managedCheckClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		Proxy:               nil,
+		DialContext:         policyDialer().DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+		ForceAttemptHTTP2:   true,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return apiTargetPolicy.checkUrl(req.URL)
+	},
+}
+
+// policyDialer checks the address after it was resolved, right before
+// connecting to it.
+func policyDialer() *net.Dialer {
+	return &net.Dialer{
+		Timeout: 30 * time.Second,
+		Control: func(network string, address string, c syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			return apiTargetPolicy.checkAddr(addrPort.Addr())
+		},
+	}
+}
+
+// checkClientFor returns the client to check the target with.
+func checkClientFor(target Target) *http.Client {
+	client, h3 := checkClient, http3CheckTransport
+	if target.managed {
+		client, h3 = managedCheckClient, managedHttp3CheckTransport
+	}
+	if target.Http3 != "" {
+		return http3CheckClient(client, h3, target.Http3)
+	}
+	return client
+}
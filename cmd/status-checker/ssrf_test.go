@@ -0,0 +1,133 @@
+package main
+
+import (
+	"net/netip"
+	"net/url"
+	"testing"
+)
+
+func TestTargetPolicyCheckUrl(t *testing.T) {
+	defaults, err := newTargetPolicy(defaultAPITargetSchemes, "", defaultAPITargetDenyHosts, "", defaultAPITargetDenyCIDRs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restricted, err := newTargetPolicy("https", "*.example.com,status.example.org", "internal.example.com", "203.0.113.0/24", "203.0.113.128/25")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		policy  *targetPolicy
+		url     string
+		allowed bool
+	}{
+		{"public host", defaults, "https://example.com/health", true},
+		{"public address", defaults, "http://203.0.113.7:8080/", true},
+		{"scheme", defaults, "ftp://example.com/", false},
+		{"scheme case", defaults, "HTTPS://example.com/", true},
+		{"no host", defaults, "http:///path", false},
+		{"loopback", defaults, "http://127.0.0.1/", false},
+		{"loopback range", defaults, "http://127.1.2.3/", false},
+		{"ipv6 loopback", defaults, "http://[::1]:8080/", false},
+		{"unspecified", defaults, "http://0.0.0.0/", false},
+		{"ipv6 unspecified", defaults, "http://[::]/", false},
+		{"mapped loopback", defaults, "http://[::ffff:127.0.0.1]/", false},
+		{"link-local", defaults, "http://169.254.169.254/latest/meta-data/", false},
+		{"ipv6 link-local", defaults, "http://[fe80::1]/", false},
+		{"aws ipv6 metadata", defaults, "http://[fd00:ec2::254]/", false},
+		{"alibaba metadata", defaults, "http://100.100.100.200/", false},
+		{"private 10/8", defaults, "http://10.0.0.1/", false},
+		{"private 172.16/12", defaults, "http://172.31.255.1/", false},
+		{"outside 172.16/12", defaults, "http://172.32.0.1/", true},
+		{"private 192.168/16", defaults, "http://192.168.1.1/", false},
+		{"ipv6 unique local", defaults, "http://[fd12:3456::1]/", false},
+		{"carrier-grade nat", defaults, "http://100.64.0.1/", false},
+		{"metadata host", defaults, "http://metadata.google.internal/", false},
+		{"metadata host trailing dot", defaults, "http://Metadata.Google.Internal./", false},
+
+		{"allowed subdomain", restricted, "https://api.example.com/", true},
+		{"allowed host", restricted, "https://status.example.org/", true},
+		{"domain of wildcard", restricted, "https://example.com/", false},
+		{"other host", restricted, "https://example.net/", false},
+		{"denied subdomain", restricted, "https://internal.example.com/", false},
+		{"allowed scheme only", restricted, "http://api.example.com/", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			u, err := url.Parse(test.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := test.policy.checkUrl(u); (err == nil) != test.allowed {
+				t.Errorf("checkUrl(%s) = %v, allowed %t", test.url, err, test.allowed)
+			}
+		})
+	}
+}
+
+func TestTargetPolicyPrivateOptIn(t *testing.T) {
+	// the whole internet and one private range
+	policy, err := newTargetPolicy("", "", "", "0.0.0.0/0,::/0,10.1.0.0/16,fd00::/8", defaultAPITargetDenyCIDRs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		addr    string
+		allowed bool
+	}{
+		{"203.0.113.7", true},
+		{"2001:db8::1", true},
+		{"10.1.2.3", true},
+		{"10.2.0.1", false},
+		{"192.168.1.1", false},
+		{"fd12::1", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"169.254.169.254", false},
+		// more specific than the allowed range
+		{"fd00:ec2::254", false},
+	}
+	for _, test := range tests {
+		if err := policy.checkAddr(netip.MustParseAddr(test.addr)); (err == nil) != test.allowed {
+			t.Errorf("checkAddr(%s) = %v, allowed %t", test.addr, err, test.allowed)
+		}
+	}
+
+	// a denied range wins over an allowed one of the same size
+	policy, err = newTargetPolicy("", "", "", "10.0.0.0/8", "10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := policy.checkAddr(netip.MustParseAddr("10.0.0.1")); err == nil {
+		t.Errorf("checkAddr of a range both allowed and denied succeeded")
+	}
+}
+
+func TestTargetPolicyCidrs(t *testing.T) {
+	policy, err := newTargetPolicy("", "", "", "10.0.0.0/8,2001:db8::/32", "10.1.0.0/16")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		url     string
+		allowed bool
+	}{
+		{"http://10.0.0.1/", true},
+		{"http://10.1.0.1/", false},
+		{"http://192.0.2.1/", false},
+		{"http://[2001:db8::1]/", true},
+		{"http://[2001:db9::1]/", false},
+		// names are checked when connecting to their address
+		{"http://service.internal/", true},
+	}
+	for _, test := range tests {
+		u, err := url.Parse(test.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := policy.checkUrl(u); (err == nil) != test.allowed {
+			t.Errorf("checkUrl(%s) = %v, allowed %t", test.url, err, test.allowed)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+)
+
+// statsdMaxPacket keeps packets below the usual MTU so they aren't
+// fragmented.
+const statsdMaxPacket = 1432
+
+// statsdEmitter sends the state and response time of every target after
+// each check round. In the dogstatsd format the target is sent as tag, plain
+// statsd has no tags so it becomes part of the metric name.
+type statsdEmitter struct {
+	conn      net.Conn
+	prefix    string
+	tags      []string
+	dogstatsd bool
+}
+
+// statsd is nil if no statsd address is configured.
+var statsd *statsdEmitter
+
+func setupStatsd(address string, prefix string, tags string, format string) error {
+	if address == "" {
+		return nil
+	}
+	if format != "statsd" && format != "dogstatsd" {
+		return fmt.Errorf("invalid statsd format %q, use statsd or dogstatsd", format)
+	}
+
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return err
+	}
+	emitter := &statsdEmitter{conn: conn, prefix: prefix, dogstatsd: format == "dogstatsd"}
+	for _, tag := range strings.Split(tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			emitter.tags = append(emitter.tags, tag)
+		}
+	}
+	if len(emitter.tags) > 0 && !emitter.dogstatsd {
+		return fmt.Errorf("statsd tags require the dogstatsd format")
+	}
+	statsd = emitter
+	return nil
+}
+
+func (e *statsdEmitter) line(name string, target string, value string, kind string) string {
+	if !e.dogstatsd {
+		return e.prefix + name + "." + statsdSanitize(target) + ":" + value + "|" + kind
+	}
+	tags := append([]string{"target:" + statsdSanitizeTag(target)}, e.tags...)
+	return e.prefix + name + ":" + value + "|" + kind + "|#" + strings.Join(tags, ",")
+}
+
+// statsdSanitize replaces the characters with a meaning in the statsd
+// protocol and the dots separating statsd name segments.
+func statsdSanitize(s string) string {
+	return strings.NewReplacer(":", "_", "|", "_", "@", "_", "#", "_", ",", "_", ".", "_", "/", "_", " ", "_").Replace(s)
+}
+
+// statsdSanitizeTag replaces the characters that would end a dogstatsd tag,
+// urls can be kept readable otherwise.
+func statsdSanitizeTag(s string) string {
+	return strings.NewReplacer("|", "_", "#", "_", ",", "_", " ", "_").Replace(s)
+}
+
+func (e *statsdEmitter) emit(views []StatusView) {
+	var lines []string
+	for _, view := range views {
+		lines = append(lines,
+			e.line("up", view.Url, fmt.Sprint(boolMetricValue(view.Healthy)), "g"),
+			e.line("response_time", view.Url, fmt.Sprint(view.ResponseTime), "ms"),
+			e.line("response_code", view.Url, fmt.Sprint(view.ResponseCode), "g"),
+		)
+	}
+
+	var packet strings.Builder
+	for _, line := range lines {
+		if packet.Len() > 0 && packet.Len()+1+len(line) > statsdMaxPacket {
+			e.send(packet.String())
+			packet.Reset()
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	if packet.Len() > 0 {
+		e.send(packet.String())
+	}
+}
+
+func (e *statsdEmitter) send(packet string) {
+	if _, err := e.conn.Write([]byte(packet)); err != nil {
+		slog.Warn("Error sending statsd metrics", "error", err)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const defaultStatuspageApiUrl = "https://api.statuspage.io/v1"
+
+// Statuspage maps targets and composites to components of a Statuspage.io
+// page whose status is updated on every state change.
+type Statuspage struct {
+	PageId string `json:"pageId"`
+	ApiKey string `json:"apiKey"`
+	// Components maps target URLs or composite names to component ids.
+	Components map[string]string `json:"components"`
+	// ApiUrl is defaultStatuspageApiUrl if not set.
+	ApiUrl string `json:"apiUrl,omitempty"`
+}
+
+func (s Statuspage) validate() error {
+	if s.PageId == "" || s.ApiKey == "" {
+		return fmt.Errorf("statuspage requires a pageId and an apiKey")
+	}
+	if len(s.Components) == 0 {
+		return fmt.Errorf("statuspage has no components")
+	}
+	return nil
+}
+
+type statuspageNotifier struct {
+	statuspage Statuspage
+	client     *http.Client
+}
+
+// notify sets the component of the changed item to operational or major
+// outage, items without component are ignored.
+func (n statuspageNotifier) notify(change stateChange) error {
+	component, ok := n.statuspage.Components[change.Target]
+	if !ok {
+		return nil
+	}
+	status := "major_outage"
+	if change.Healthy {
+		status = "operational"
+	}
+
+	body, err := json.Marshal(map[string]any{"component": map[string]string{"status": status}})
+	if err != nil {
+		return err
+	}
+	apiUrl := n.statuspage.ApiUrl
+	if apiUrl == "" {
+		apiUrl = defaultStatuspageApiUrl
+	}
+	endpoint := strings.TrimSuffix(apiUrl, "/") + "/pages/" + url.PathEscape(n.statuspage.PageId) + "/components/" + url.PathEscape(component)
+
+	req, err := http.NewRequest(http.MethodPatch, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "OAuth "+n.statuspage.ApiKey)
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("statuspage component %s responded with status %d", component, resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// defaultLocale is used if the page config sets no locale, missing strings
+// of other locales fall back to it.
+const defaultLocale = "en"
+
+// pageStrings are the built-in translations of the status page. {count} is
+// replaced by the frontend.
+var pageStrings = map[string]map[string]string{
+	"en": {
+		"connecting":           "Connecting...",
+		"connected":            "Connected",
+		"disconnected":         "Disconnected",
+		"error":                "Error",
+		"allOperational":       "All systems operational",
+		"unhealthyCount":       "{count} unhealthy",
+		"partialOutage":        "Partial outage",
+		"majorOutage":          "Major outage",
+		"degraded":             "Degraded performance",
+		"degradedCount":        "{count} slow",
+		"never":                "never",
+		"subscribe":            "Subscribe to updates",
+		"subscribePlaceholder": "you@example.com",
+		"subscribeConfirm":     "Check your inbox to confirm the subscription.",
+		"maintenanceScheduled": "Scheduled maintenance",
+		"maintenanceOngoing":   "Maintenance in progress",
+	},
+	"de": {
+		"connecting":           "Verbinde...",
+		"connected":            "Verbunden",
+		"disconnected":         "Getrennt",
+		"error":                "Fehler",
+		"allOperational":       "Alle Systeme funktionieren",
+		"unhealthyCount":       "{count} gestört",
+		"partialOutage":        "Teilweise gestört",
+		"majorOutage":          "Schwere Störung",
+		"degraded":             "Eingeschränkte Leistung",
+		"degradedCount":        "{count} langsam",
+		"never":                "nie",
+		"subscribe":            "Updates abonnieren",
+		"subscribePlaceholder": "du@example.com",
+		"subscribeConfirm":     "Bitte bestätige das Abonnement über den Link in deinem Postfach.",
+		"maintenanceScheduled": "Geplante Wartung",
+		"maintenanceOngoing":   "Wartung läuft",
+	},
+}
+
+// validateStrings checks that overrides only use keys the page knows.
+func validateStrings(overrides map[string]string) error {
+	for key := range overrides {
+		if _, ok := pageStrings[defaultLocale][key]; !ok {
+			known := make([]string, 0, len(pageStrings[defaultLocale]))
+			for key := range pageStrings[defaultLocale] {
+				known = append(known, key)
+			}
+			slices.Sort(known)
+			return fmt.Errorf("unknown page string %q, use %s", key, strings.Join(known, ", "))
+		}
+	}
+	return nil
+}
+
+// localizedStrings returns the strings of locale with the overrides applied,
+// strings missing in the locale are taken from the default locale.
+func localizedStrings(locale string, overrides map[string]string) map[string]string {
+	result := make(map[string]string, len(pageStrings[defaultLocale]))
+	for key, value := range pageStrings[defaultLocale] {
+		result[key] = value
+	}
+	// "de-AT" uses "de" unless there is a translation for it
+	base, _, _ := strings.Cut(locale, "-")
+	for _, l := range []string{base, locale} {
+		for key, value := range pageStrings[l] {
+			result[key] = value
+		}
+	}
+	for key, value := range overrides {
+		result[key] = value
+	}
+	return result
+}
+
+type stringsResponse struct {
+	Locale  string            `json:"locale"`
+	Strings map[string]string `json:"strings"`
+}
+
+// handleStrings serves the strings of the configured locale, the locale query
+// parameter selects another one.
+func handleStrings(w http.ResponseWriter, r *http.Request) {
+	stateMu.RLock()
+	page := config.pageConfig(r.PathValue("namespace"))
+	stateMu.RUnlock()
+	locale := page.Locale
+	overrides := page.Strings
+
+	if requested := r.URL.Query().Get("locale"); requested != "" && requested != locale {
+		// the overrides are meant for the configured locale
+		locale = requested
+		overrides = nil
+	}
+	if locale == "" {
+		locale = defaultLocale
+	}
+	writeJSON(w, http.StatusOK, stringsResponse{Locale: locale, Strings: localizedStrings(locale, overrides)})
+}
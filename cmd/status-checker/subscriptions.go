@@ -0,0 +1,353 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// subscriptionConfirmTime is how long a confirmation link is valid.
+	subscriptionConfirmTime = 24 * time.Hour
+	// subscriptionResendTime limits how often a confirmation mail is sent
+	// to the same address.
+	subscriptionResendTime = 10 * time.Minute
+	// maxPendingSubscriptions limits the unconfirmed subscriptions so the
+	// form can't be used to fill the disk.
+	maxPendingSubscriptions = 1000
+)
+
+type smtpArgs struct {
+	address  string
+	user     string
+	password string
+	from     string
+}
+
+// subscriber receives status updates by mail once the address is confirmed.
+// The token is part of the confirmation and unsubscribe links.
+type subscriber struct {
+	Email     string    `json:"email"`
+	Token     string    `json:"token"`
+	Confirmed bool      `json:"confirmed"`
+	Created   time.Time `json:"created"`
+}
+
+// subscriptionStore keeps the subscribers, it is nil if no SMTP server is
+// configured.
+type subscriptionStore struct {
+	mu          sync.Mutex
+	path        string // empty if nothing is persisted
+	subscribers []subscriber
+	smtp        smtpArgs
+	publicUrl   string
+}
+
+var subscriptions *subscriptionStore
+
+// setupSubscriptions enables email subscriptions if an SMTP server is set and
+// loads the subscribers from the data path.
+func setupSubscriptions(args smtpArgs, publicUrl string, dataPath string, persist bool) error {
+	if args.address == "" {
+		return nil
+	}
+	if args.from == "" {
+		return fmt.Errorf("--smtp-from is required to send mails")
+	}
+	if _, err := url.ParseRequestURI(publicUrl); err != nil {
+		return fmt.Errorf("--public-url is required for the links in mails: %w", err)
+	}
+
+	store := &subscriptionStore{smtp: args, publicUrl: strings.TrimSuffix(publicUrl, "/")}
+	if persist {
+		store.path = dataPath + "subscribers.json"
+		if err := os.MkdirAll(dataPath, os.ModePerm); err != nil {
+			return err
+		}
+		if err := store.load(); err != nil {
+			return err
+		}
+	}
+	subscriptions = store
+	notifiers = append(notifiers, store)
+	return nil
+}
+
+func (s *subscriptionStore) load() error {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &s.subscribers)
+}
+
+// save persists the subscribers, the caller has to hold s.mu.
+func (s *subscriptionStore) save() {
+	if s.path == "" {
+		return
+	}
+	data, err := json.MarshalIndent(s.subscribers, "", "  ")
+	if err == nil {
+		tmp := s.path + ".tmp"
+		if err = os.WriteFile(tmp, data, 0600); err == nil {
+			err = os.Rename(tmp, s.path)
+		}
+	}
+	if err != nil {
+		slog.Error("Error saving subscribers", "error", err)
+	}
+}
+
+func (s *subscriptionStore) link(action string, token string) string {
+	return s.publicUrl + "/api/subscriptions/" + action + "?token=" + url.QueryEscape(token)
+}
+
+// send mails a plain text message with an unsubscribe link to a subscriber.
+func (s *subscriptionStore) send(to subscriber, subject string, body string) error {
+	unsubscribe := s.link("unsubscribe", to.Token)
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", s.smtp.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", to.Email)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "List-Unsubscribe: <%s>\r\n", unsubscribe)
+	fmt.Fprintf(&msg, "List-Unsubscribe-Post: List-Unsubscribe=One-Click\r\n")
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	fmt.Fprintf(&msg, "\r\n\r\nUnsubscribe: %s\r\n", unsubscribe)
+
+	var auth smtp.Auth
+	if s.smtp.user != "" {
+		host := s.smtp.address
+		if i := strings.LastIndex(host, ":"); i >= 0 {
+			host = host[:i]
+		}
+		auth = smtp.PlainAuth("", s.smtp.user, s.smtp.password, host)
+	}
+	return smtp.SendMail(s.smtp.address, auth, s.smtp.from, []string{to.Email}, []byte(msg.String()))
+}
+
+// broadcast sends a mail to all confirmed subscribers.
+func (s *subscriptionStore) broadcast(subject string, body string) error {
+	s.mu.Lock()
+	recipients := slices.DeleteFunc(slices.Clone(s.subscribers), func(sub subscriber) bool { return !sub.Confirmed })
+	s.mu.Unlock()
+
+	var errs []error
+	for _, recipient := range recipients {
+		if err := s.send(recipient, subject, body); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", recipient.Email, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// notify tells the subscribers about an incident or its resolution of a
+// public item.
+func (s *subscriptionStore) notify(change stateChange) error {
+	stateMu.RLock()
+	name, _, _ := describeItem(change.Target)
+	public := isPublic(change.Target)
+	stateMu.RUnlock()
+	if !public {
+		return nil
+	}
+	if name == "" {
+		name = change.Target
+	}
+
+	subject := name + " is down"
+	body := fmt.Sprintf("%s is not reachable since %s.", name, change.Time.UTC().Format(time.RFC1123))
+	if change.Healthy {
+		subject = name + " is up again"
+		body = fmt.Sprintf("%s is reachable again since %s.", name, change.Time.UTC().Format(time.RFC1123))
+	}
+	body += "\n\nStatus page: " + s.publicUrl + "/"
+	return s.broadcast(subject, body)
+}
+
+// notifyMaintenance tells the subscribers about a planned maintenance window
+// in the background.
+func (s *subscriptionStore) notifyMaintenance(maintenance Maintenance) {
+	affected := "all services"
+	if len(maintenance.Targets) > 0 {
+		stateMu.RLock()
+		names := make([]string, 0, len(maintenance.Targets))
+		for _, target := range maintenance.Targets {
+			if !isPublic(target) {
+				continue
+			}
+			name, _, _ := describeItem(target)
+			if name == "" {
+				name = target
+			}
+			names = append(names, name)
+		}
+		stateMu.RUnlock()
+		if len(names) == 0 {
+			return
+		}
+		affected = strings.Join(names, ", ")
+	}
+
+	subject := "Planned maintenance: " + affected
+	body := fmt.Sprintf("Maintenance of %s is planned from %s to %s.", affected,
+		maintenance.Start.UTC().Format(time.RFC1123), maintenance.End.UTC().Format(time.RFC1123))
+	if maintenance.Comment != "" {
+		body += "\n\n" + maintenance.Comment
+	}
+	body += "\n\nStatus page: " + s.publicUrl + "/"
+
+	pendingNotifications.Add(1)
+	go func() {
+		defer pendingNotifications.Done()
+		selfMetrics.notifications.Add(1)
+		if err := s.broadcast(subject, body); err != nil {
+			selfMetrics.notificationFailures.Add(1)
+			stateLog.Error("Error sending maintenance notification", "maintenance", maintenance.Id, "error", err)
+		}
+	}()
+}
+
+// registerSubscriptions adds the public subscription endpoints to mux. The
+// confirm and unsubscribe endpoints are the links in the mails.
+func registerSubscriptions(mux *http.ServeMux, page func(http.Handler) http.Handler) {
+	mux.Handle("POST /api/subscriptions", page(http.HandlerFunc(handleSubscribe)))
+	mux.HandleFunc("GET /api/subscriptions/confirm", handleConfirmSubscription)
+	mux.HandleFunc("GET /api/subscriptions/unsubscribe", handleUnsubscribeForm)
+	// the form and the one-click unsubscribe of mail clients, RFC 8058
+	mux.HandleFunc("POST /api/subscriptions/unsubscribe", handleUnsubscribe)
+}
+
+// handleSubscribe accepts {"email": "..."} or a form with an email field and
+// mails a confirmation link. The response is the same whether the address
+// is already subscribed or not.
+func handleSubscribe(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Email string `json:"email"`
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if !decodeJSON(w, r, &request) {
+			return
+		}
+	} else {
+		request.Email = r.FormValue("email")
+	}
+	address, err := mail.ParseAddress(request.Email)
+	if err != nil || address.Name != "" {
+		http.Error(w, "invalid email address", http.StatusBadRequest)
+		return
+	}
+	email := strings.ToLower(address.Address)
+
+	s := subscriptions
+	s.mu.Lock()
+	now := time.Now()
+	s.subscribers = slices.DeleteFunc(s.subscribers, func(sub subscriber) bool {
+		return !sub.Confirmed && now.Sub(sub.Created) > subscriptionConfirmTime
+	})
+	i := slices.IndexFunc(s.subscribers, func(sub subscriber) bool { return sub.Email == email })
+	var pending *subscriber
+	switch {
+	case i >= 0 && (s.subscribers[i].Confirmed || now.Sub(s.subscribers[i].Created) < subscriptionResendTime):
+	case i >= 0:
+		s.subscribers[i].Created = now
+		pending = &s.subscribers[i]
+	case pendingSubscriptions(s.subscribers) >= maxPendingSubscriptions:
+		s.mu.Unlock()
+		http.Error(w, "too many pending subscriptions", http.StatusServiceUnavailable)
+		return
+	default:
+		s.subscribers = append(s.subscribers, subscriber{Email: email, Token: randomHex(16), Created: now})
+		pending = &s.subscribers[len(s.subscribers)-1]
+	}
+	var confirm subscriber
+	if pending != nil {
+		confirm = *pending
+		s.save()
+	}
+	s.mu.Unlock()
+
+	if pending != nil {
+		body := "Please confirm your subscription to the status updates:\n\n" + s.link("confirm", confirm.Token) +
+			"\n\nIgnore this mail if you didn't subscribe."
+		if err := s.send(confirm, "Confirm your subscription", body); err != nil {
+			slog.Error("Error sending confirmation mail", "error", err)
+			http.Error(w, "could not send the confirmation mail", http.StatusBadGateway)
+			return
+		}
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "confirmation sent"})
+}
+
+func pendingSubscriptions(subscribers []subscriber) int {
+	pending := 0
+	for _, sub := range subscribers {
+		if !sub.Confirmed {
+			pending++
+		}
+	}
+	return pending
+}
+
+func handleConfirmSubscription(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	s := subscriptions
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.IndexFunc(s.subscribers, func(sub subscriber) bool { return tokenMatches(sub.Token, token) })
+	if i < 0 || (!s.subscribers[i].Confirmed && time.Since(s.subscribers[i].Created) > subscriptionConfirmTime) {
+		http.Error(w, "unknown or expired confirmation link", http.StatusNotFound)
+		return
+	}
+	s.subscribers[i].Confirmed = true
+	s.save()
+	fmt.Fprintln(w, "Your subscription is confirmed.")
+}
+
+// unsubscribeForm is the page of the unsubscribe link. Opening the link only
+// asks to confirm, as mail scanners and link previews open links too.
+const unsubscribeForm = `<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>Unsubscribe</title></head>
+<body>
+<form method="post" action="unsubscribe?token=%s">
+<p>Do you want to stop receiving the status updates?</p>
+<button type="submit">Unsubscribe</button>
+</form>
+</body>
+</html>
+`
+
+func handleUnsubscribeForm(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, unsubscribeForm, html.EscapeString(url.QueryEscape(r.URL.Query().Get("token"))))
+}
+
+func handleUnsubscribe(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	s := subscriptions
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.subscribers = slices.DeleteFunc(s.subscribers, func(sub subscriber) bool { return tokenMatches(sub.Token, token) })
+	s.save()
+	fmt.Fprintln(w, "You are unsubscribed.")
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// smtpRecorder is an SMTP server that keeps the mails it receives.
+type smtpRecorder struct {
+	mu    sync.Mutex
+	mails []string
+}
+
+// startSmtpRecorder serves SMTP on a local port until the test ends.
+func startSmtpRecorder(t *testing.T) (*smtpRecorder, string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	recorder := &smtpRecorder{}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go recorder.serve(conn)
+		}
+	}()
+	return recorder, listener.Addr().String()
+}
+
+func (s *smtpRecorder) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+	reply("220 localhost")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 localhost")
+		case command == "DATA":
+			reply("354 go ahead")
+			var mail strings.Builder
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				mail.WriteString(line)
+			}
+			s.mu.Lock()
+			s.mails = append(s.mails, mail.String())
+			s.mu.Unlock()
+			reply("250 ok")
+		case command == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func (s *smtpRecorder) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.mails...)
+}
+
+// setSubscriptions makes store the subscriptions for the test.
+func setSubscriptions(t *testing.T, store *subscriptionStore) {
+	t.Helper()
+	previous := subscriptions
+	subscriptions = store
+	t.Cleanup(func() { subscriptions = previous })
+}
+
+var confirmToken = regexp.MustCompile(`/api/subscriptions/confirm\?token=([0-9a-f]+)`)
+
+func TestSubscriptions(t *testing.T) {
+	applyTestConfig(t, Config{Targets: []Target{{Url: "https://a.example.com/", Name: "Shop"}}})
+	recorder, address := startSmtpRecorder(t)
+	store := &subscriptionStore{smtp: smtpArgs{address: address, from: "status@example.com"}, publicUrl: "https://status.example.com"}
+	setSubscriptions(t, store)
+	mux := http.NewServeMux()
+	registerSubscriptions(mux, func(handler http.Handler) http.Handler { return handler })
+
+	request := func(method, target string, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		if body != "" {
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+	subscribed := func() []subscriber {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		return append([]subscriber(nil), store.subscribers...)
+	}
+
+	if w := request(http.MethodPost, "/api/subscriptions", "email="+url.QueryEscape("Jane <jane@example.com>")); w.Code != http.StatusBadRequest {
+		t.Errorf("status of an address with a name = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if w := request(http.MethodPost, "/api/subscriptions", "email=Jane@Example.com"); w.Code != http.StatusAccepted {
+		t.Fatalf("status of subscribing = %d, want %d: %s", w.Code, http.StatusAccepted, w.Body)
+	}
+	// no second confirmation mail right away
+	request(http.MethodPost, "/api/subscriptions", "email=jane@example.com")
+	mails := recorder.received()
+	if len(mails) != 1 || !strings.Contains(mails[0], "To: jane@example.com\r\n") {
+		t.Fatalf("mails = %q, want one confirmation mail to the lowercase address", mails)
+	}
+	match := confirmToken.FindStringSubmatch(mails[0])
+	if match == nil {
+		t.Fatalf("no confirmation link in %q", mails[0])
+	}
+	token := match[1]
+
+	// unconfirmed subscribers get no updates
+	if err := store.notify(stateChange{Target: "https://a.example.com/", Time: time.Now()}); err != nil || len(recorder.received()) != 1 {
+		t.Errorf("notify before the confirmation = %v, sent %d mails", err, len(recorder.received())-1)
+	}
+	if w := request(http.MethodGet, "/api/subscriptions/confirm?token=0123", ""); w.Code != http.StatusNotFound {
+		t.Errorf("status of an unknown confirmation token = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if w := request(http.MethodGet, "/api/subscriptions/confirm?token="+token, ""); w.Code != http.StatusOK || !subscribed()[0].Confirmed {
+		t.Fatalf("status of confirming = %d, want %d and a confirmed subscriber", w.Code, http.StatusOK)
+	}
+
+	if err := store.notify(stateChange{Target: "https://a.example.com/", Time: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	// the private watchdog isn't announced
+	if err := store.notify(stateChange{Target: watchdogTarget, Time: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	mails = recorder.received()
+	if len(mails) != 2 || !strings.Contains(mails[1], "Subject: Shop is down\r\n") {
+		t.Fatalf("mails = %q, want the incident of Shop", mails)
+	}
+	if !strings.Contains(mails[1], "List-Unsubscribe: <https://status.example.com/api/subscriptions/unsubscribe?token="+token+">\r\n") ||
+		!strings.Contains(mails[1], "List-Unsubscribe-Post: List-Unsubscribe=One-Click\r\n") {
+		t.Errorf("no one-click unsubscribe headers in %q", mails[1])
+	}
+
+	// opening the link only shows the form, which posts to the same link
+	w := request(http.MethodGet, "/api/subscriptions/unsubscribe?token="+token, "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `<form method="post" action="unsubscribe?token=`+token+`">`) {
+		t.Errorf("unsubscribe link = %d %q, want the form", w.Code, w.Body)
+	}
+	if len(subscribed()) != 1 {
+		t.Fatalf("opening the unsubscribe link unsubscribed")
+	}
+	w = request(http.MethodGet, "/api/subscriptions/unsubscribe?token="+url.QueryEscape(`"><script>`), "")
+	if strings.Contains(w.Body.String(), "<script>") {
+		t.Errorf("token not escaped in %q", w.Body)
+	}
+	if w := request(http.MethodPost, "/api/subscriptions/unsubscribe?token="+token, "List-Unsubscribe=One-Click"); w.Code != http.StatusOK || len(subscribed()) != 0 {
+		t.Errorf("status of the one-click unsubscribe = %d with %d subscribers left, want %d and none", w.Code, len(subscribed()), http.StatusOK)
+	}
+}
+
+func TestSubscriptionConfirmExpired(t *testing.T) {
+	store := &subscriptionStore{subscribers: []subscriber{
+		{Email: "old@example.com", Token: "01", Created: time.Now().Add(-subscriptionConfirmTime - time.Minute)},
+		{Email: "confirmed@example.com", Token: "02", Confirmed: true, Created: time.Now().Add(-subscriptionConfirmTime - time.Minute)},
+	}}
+	setSubscriptions(t, store)
+	for token, status := range map[string]int{"01": http.StatusNotFound, "02": http.StatusOK} {
+		w := httptest.NewRecorder()
+		handleConfirmSubscription(w, httptest.NewRequest(http.MethodGet, "/api/subscriptions/confirm?token="+token, nil))
+		if w.Code != status {
+			t.Errorf("status of confirming with %s = %d, want %d", token, w.Code, status)
+		}
+	}
+}
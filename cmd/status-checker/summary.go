@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// Overall states of the system.
+const (
+	overallOperational   = "operational"
+	overallDegraded      = "degraded performance"
+	overallPartialOutage = "partial outage"
+	overallMajorOutage   = "major outage"
+)
+
+// defaultMajorOutageShare is the share of the weight that has to be
+// unhealthy for a major outage if the config doesn't set majorOutageShare.
+const defaultMajorOutageShare = 0.5
+
+// summary is the overall status computed from the weights of the public
+// items, the response of /api/summary.
+type summary struct {
+	Status          string   `json:"status"`
+	Total           int      `json:"total"`
+	Unhealthy       int      `json:"unhealthy"`
+	TotalWeight     float64  `json:"totalWeight"`
+	UnhealthyWeight float64  `json:"unhealthyWeight"`
+	UnhealthyItems  []string `json:"unhealthyItems"`
+	// DegradedItems are the healthy items with a latency anomaly.
+	DegradedItems []string `json:"degradedItems"`
+}
+
+func (c Config) majorOutageShare() float64 {
+	if c.MajorOutageShare > 0 {
+		return c.MajorOutageShare
+	}
+	return defaultMajorOutageShare
+}
+
+// itemWeight returns the weight and criticality of a target or composite,
+// the caller has to hold stateMu.
+func itemWeight(item string) (weight float64, critical bool) {
+	switch i := configItems[item]; {
+	case i.target != nil:
+		return i.target.weight(), i.target.Critical
+	case i.composite != nil:
+		return i.composite.weight(), i.composite.Critical
+	}
+	return 1, false
+}
+
+func (t Target) weight() float64 {
+	if t.Weight == nil {
+		return 1
+	}
+	return *t.Weight
+}
+
+func (c Composite) weight() float64 {
+	if c.Weight == nil {
+		return 1
+	}
+	return *c.Weight
+}
+
+// computeSummary weights the public items. Unhealthy items in a running
+// maintenance window don't count as outage. An unhealthy critical item is a
+// major outage, as is an unhealthy share of the weight of at least
+// majorOutageShare. Without an outage, degraded items are degraded
+// performance.
+func computeSummary(views []StatusView, now time.Time) summary {
+	s := summary{Status: overallOperational, UnhealthyItems: []string{}, DegradedItems: []string{}}
+
+	unhealthy := make(map[string]bool)
+	for _, view := range views {
+		if !view.Healthy && !management.inMaintenance(view.Url, now) {
+			unhealthy[view.Url] = true
+		}
+	}
+
+	stateMu.RLock()
+	defer stateMu.RUnlock()
+	criticalDown := false
+	for _, view := range views {
+		weight, critical := itemWeight(view.Url)
+		s.Total++
+		s.TotalWeight += weight
+		if unhealthy[view.Url] {
+			s.Unhealthy++
+			s.UnhealthyWeight += weight
+			s.UnhealthyItems = append(s.UnhealthyItems, view.Url)
+			criticalDown = criticalDown || critical
+		} else if view.Degraded {
+			s.DegradedItems = append(s.DegradedItems, view.Url)
+		}
+	}
+
+	switch {
+	case criticalDown || (s.TotalWeight > 0 && s.UnhealthyWeight/s.TotalWeight >= config.majorOutageShare()):
+		s.Status = overallMajorOutage
+	case s.Unhealthy > 0:
+		s.Status = overallPartialOutage
+	case len(s.DegradedItems) > 0:
+		s.Status = overallDegraded
+	}
+	return s
+}
+
+func handleSummary(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, computeSummary(publicViewsIn(StatusStatesToView(), r.PathValue("namespace")), time.Now()))
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultSyslogEnterpriseNumber is the example number of RFC 5612, set
+	// enterpriseNumber to your private enterprise number in production.
+	defaultSyslogEnterpriseNumber = 32473
+	syslogTimeout                 = 10 * time.Second
+)
+
+// Syslog facilities by name, RFC 5424 section 6.2.1.
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+const (
+	syslogSeverityError  = 3
+	syslogSeverityNotice = 5
+)
+
+// Syslog receives every state change as RFC 5424 message with the severity
+// error for unhealthy and notice for healthy items. The target, state and
+// response code are structured data with the id state@<enterpriseNumber>.
+type Syslog struct {
+	// Address is udp://host:port, tcp://host:port, tls://host:port or
+	// unix:///dev/log, the port is 514, or 6514 for TLS, if missing. TCP and
+	// TLS use octet counting framing.
+	Address  string `json:"address"`
+	Facility string `json:"facility,omitempty"` // daemon if not set
+	AppName  string `json:"appName,omitempty"`  // status-checker if not set
+	// EnterpriseNumber is defaultSyslogEnterpriseNumber if not set.
+	EnterpriseNumber int `json:"enterpriseNumber,omitempty"`
+}
+
+func (s Syslog) validate() error {
+	parsed, err := url.Parse(s.Address)
+	if err != nil {
+		return fmt.Errorf("invalid syslog address: %w", err)
+	}
+	switch parsed.Scheme {
+	case "udp", "tcp", "tls":
+		if parsed.Hostname() == "" {
+			return fmt.Errorf("syslog address %s without host", s.Address)
+		}
+	case "unix":
+		if parsed.Path == "" {
+			return fmt.Errorf("syslog address %s without path", s.Address)
+		}
+	default:
+		return fmt.Errorf("invalid syslog address %s, use udp://, tcp://, tls:// or unix://", s.Address)
+	}
+	if _, ok := syslogFacilities[s.Facility]; s.Facility != "" && !ok {
+		return fmt.Errorf("unknown syslog facility %q", s.Facility)
+	}
+	if strings.ContainsAny(s.AppName, " \t\r\n") || len(s.AppName) > 48 {
+		return fmt.Errorf("syslog appName %q has to be at most 48 characters without whitespace", s.AppName)
+	}
+	if s.EnterpriseNumber < 0 {
+		return fmt.Errorf("syslog enterpriseNumber can't be negative")
+	}
+	return nil
+}
+
+// syslogParamEscape escapes the characters ending a structured data value.
+func syslogParamEscape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+}
+
+// syslogMessage formats change without framing.
+func syslogMessage(s Syslog, change stateChange, hostname string) string {
+	facility := syslogFacilities["daemon"]
+	if s.Facility != "" {
+		facility = syslogFacilities[s.Facility]
+	}
+	severity := syslogSeverityError
+	if change.Healthy {
+		severity = syslogSeverityNotice
+	}
+	appName := s.AppName
+	if appName == "" {
+		appName = "status-checker"
+	}
+	if hostname == "" {
+		hostname = "-"
+	}
+	enterprise := s.EnterpriseNumber
+	if enterprise == 0 {
+		enterprise = defaultSyslogEnterpriseNumber
+	}
+
+	structured := fmt.Sprintf(`[state@%d target="%s" state="%s" responseCode="%d"]`,
+		enterprise, syslogParamEscape(change.Target), healthState(change.Healthy), change.ResponseCode)
+	return fmt.Sprintf("<%d>1 %s %s %s %d STATE %s %s is %s",
+		facility*8+severity,
+		change.Time.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		hostname, appName, os.Getpid(), structured,
+		change.Target, healthState(change.Healthy))
+}
+
+type syslogNotifier struct {
+	syslog Syslog
+}
+
+func (n syslogNotifier) notify(change stateChange) error {
+	hostname, _ := os.Hostname()
+	message := syslogMessage(n.syslog, change, hostname)
+
+	parsed, err := url.Parse(n.syslog.Address)
+	if err != nil {
+		return err
+	}
+	dialer := &net.Dialer{Timeout: syslogTimeout}
+	var conn net.Conn
+	switch parsed.Scheme {
+	case "unix":
+		conn, err = dialer.Dial("unixgram", parsed.Path)
+	case "udp":
+		conn, err = dialer.Dial("udp", hostWithDefaultPort(parsed.Host, "514"))
+	case "tcp":
+		conn, err = dialer.Dial("tcp", hostWithDefaultPort(parsed.Host, "514"))
+	default:
+		conn, err = tls.DialWithDialer(dialer, "tcp", hostWithDefaultPort(parsed.Host, "6514"), &tls.Config{ServerName: parsed.Hostname()})
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(syslogTimeout))
+
+	if parsed.Scheme == "tcp" || parsed.Scheme == "tls" {
+		// octet counting, RFC 6587 and RFC 5425
+		message = strconv.Itoa(len(message)) + " " + message
+	}
+	_, err = conn.Write([]byte(message))
+	return err
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// sdNotify sends a state to the systemd service manager. It does nothing if
+// the process wasn't started by systemd with Type=notify.
+func sdNotify(state string) error {
+	socketPath := os.Getenv("NOTIFY_SOCKET")
+	if socketPath == "" {
+		return nil
+	}
+
+	// abstract sockets are given with a leading @
+	if socketPath[0] == '@' {
+		socketPath = "\x00" + socketPath[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// sdWatchdogInterval returns the interval in which systemd expects watchdog
+// keepalives or 0 if the watchdog isn't enabled for this process.
+func sdWatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+
+	return time.Duration(usec) * time.Microsecond
+}
+
+// runSdWatchdog sends keepalives to systemd at half the configured interval
+// as long as the internal watchdog considers the checker healthy, so systemd
+// restarts the service if the check loop hangs.
+func runSdWatchdog() {
+	interval := sdWatchdogInterval()
+	if interval == 0 {
+		return
+	}
+
+	for {
+		time.Sleep(interval / 2)
+		if len(checkWatchdog.currentProblems()) > 0 {
+			continue
+		}
+		if err := sdNotify("WATCHDOG=1"); err != nil {
+			slog.Error("Error sending watchdog keepalive to systemd", "error", err)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type tlsArgs struct {
+	certFile              string
+	keyFile               string
+	minVersion            string
+	cipherSuites          string
+	hstsMaxAge            int
+	hstsIncludeSubdomains bool
+	hstsPreload           bool
+}
+
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// newTLSConfig returns nil if no certificate is configured, the listeners
+// serve plain HTTP then.
+func newTLSConfig(a tlsArgs) (*tls.Config, error) {
+	if a.certFile == "" && a.keyFile == "" {
+		return nil, nil
+	}
+	if a.certFile == "" || a.keyFile == "" {
+		return nil, errors.New("--tls-cert and --tls-key have to be set together")
+	}
+
+	minVersion, ok := tlsVersions[a.minVersion]
+	if !ok {
+		return nil, fmt.Errorf("invalid TLS version %q, use 1.2 or 1.3", a.minVersion)
+	}
+
+	reloader := &certReloader{certFile: a.certFile, keyFile: a.keyFile}
+	if _, err := reloader.certificate(nil); err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		MinVersion:     minVersion,
+		GetCertificate: reloader.certificate,
+	}
+	if a.cipherSuites != "" {
+		suites, err := parseCipherSuites(a.cipherSuites)
+		if err != nil {
+			return nil, err
+		}
+		config.CipherSuites = suites
+	}
+	return config, nil
+}
+
+// parseCipherSuites parses a comma separated list of cipher suite names as
+// listed by crypto/tls, only secure suites are accepted. They only apply to
+// TLS 1.2, the TLS 1.3 suites are not configurable.
+func parseCipherSuites(list string) ([]uint16, error) {
+	var configurable []*tls.CipherSuite
+	for _, suite := range tls.CipherSuites() {
+		if slices.Contains(suite.SupportedVersions, tls.VersionTLS12) {
+			configurable = append(configurable, suite)
+		}
+	}
+
+	var suites []uint16
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		i := slices.IndexFunc(configurable, func(s *tls.CipherSuite) bool { return s.Name == name })
+		if i < 0 {
+			var known []string
+			for _, suite := range configurable {
+				known = append(known, suite.Name)
+			}
+			return nil, fmt.Errorf("unknown or insecure cipher suite %q, use one of %s", name, strings.Join(known, ", "))
+		}
+		suites = append(suites, configurable[i].ID)
+	}
+	return suites, nil
+}
+
+// certReloader loads the certificate again once the certificate file
+// changes, so renewed certificates are used without a restart.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+	checked time.Time
+}
+
+func (c *certReloader) certificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// stat at most every few seconds, not on every handshake
+	if c.cert != nil && time.Since(c.checked) < 10*time.Second {
+		return c.cert, nil
+	}
+	c.checked = time.Now()
+
+	info, err := os.Stat(c.certFile)
+	if err != nil {
+		if c.cert != nil {
+			return c.cert, nil
+		}
+		return nil, err
+	}
+	if c.cert != nil && info.ModTime().Equal(c.modTime) {
+		return c.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		if c.cert != nil {
+			// e.g. the key wasn't written yet, keep the old certificate
+			return c.cert, nil
+		}
+		return nil, err
+	}
+	c.cert = &cert
+	c.modTime = info.ModTime()
+	return c.cert, nil
+}
+
+// hstsHandler adds the Strict-Transport-Security header to all responses,
+// unless the max age is 0.
+func hstsHandler(a tlsArgs, next http.Handler) http.Handler {
+	if a.hstsMaxAge <= 0 {
+		return next
+	}
+	value := "max-age=" + strconv.Itoa(a.hstsMaxAge)
+	if a.hstsIncludeSubdomains {
+		value += "; includeSubDomains"
+	}
+	if a.hstsPreload {
+		value += "; preload"
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Strict-Transport-Security", value)
+		next.ServeHTTP(w, r)
+	})
+}
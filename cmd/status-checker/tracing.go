@@ -0,0 +1,220 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+const (
+	otlpSpanKindInternal = 1
+	otlpSpanKindClient   = 3
+
+	otlpStatusOk    = 1
+	otlpStatusError = 2
+)
+
+type otlpSpan struct {
+	TraceId           string         `json:"traceId"`
+	SpanId            string         `json:"spanId"`
+	ParentSpanId      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpSpanStatus `json:"status"`
+}
+
+type otlpSpanStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpTracesPayload struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+// spanExporter buffers finished spans and sends them in batches.
+type spanExporter struct {
+	client *otlpClient
+	mu     sync.Mutex
+	spans  []otlpSpan
+}
+
+// tracer is nil if tracing is disabled.
+var tracer *spanExporter
+
+func setupTracing(endpoint string) {
+	if endpoint == "" {
+		return
+	}
+	tracer = &spanExporter{client: newOTLPClient(endpoint)}
+	go tracer.run(5 * time.Second)
+}
+
+func (e *spanExporter) add(spans ...otlpSpan) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, spans...)
+}
+
+func (e *spanExporter) run(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		e.flush()
+	}
+}
+
+func (e *spanExporter) flush() {
+	e.mu.Lock()
+	spans := e.spans
+	e.spans = nil
+	e.mu.Unlock()
+
+	if len(spans) == 0 {
+		return
+	}
+
+	payload := otlpTracesPayload{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpDefaultResource(),
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "status-checker"},
+			Spans: spans,
+		}},
+	}}}
+	if err := e.client.post("/v1/traces", payload); err != nil {
+		slog.Error("Error exporting spans", "spans", len(spans), "error", err)
+	}
+}
+
+func randomHex(bytes int) string {
+	b := make([]byte, bytes)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// checkTrace records the span of a single check and child spans for the
+// phases of the request reported by httptrace. All methods can be called on a
+// nil checkTrace, which is what newCheckTrace returns if tracing is disabled.
+type checkTrace struct {
+	mu       sync.Mutex
+	root     otlpSpan
+	children []otlpSpan
+	started  map[string]time.Time
+}
+
+func newCheckTrace(item string, start time.Time) *checkTrace {
+	if tracer == nil {
+		return nil
+	}
+	return &checkTrace{
+		root: otlpSpan{
+			TraceId:           randomHex(16),
+			SpanId:            randomHex(8),
+			Name:              "check " + item,
+			Kind:              otlpSpanKindClient,
+			StartTimeUnixNano: otlpTime(start),
+			Attributes:        []otlpKeyValue{otlpString("url.full", item)},
+		},
+		started: make(map[string]time.Time),
+	}
+}
+
+func (t *checkTrace) begin(phase string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.started[phase] = time.Now()
+}
+
+func (t *checkTrace) done(phase string, err error, attributes ...otlpKeyValue) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	start, ok := t.started[phase]
+	if !ok {
+		return
+	}
+	delete(t.started, phase)
+
+	span := otlpSpan{
+		TraceId:           t.root.TraceId,
+		SpanId:            randomHex(8),
+		ParentSpanId:      t.root.SpanId,
+		Name:              phase,
+		Kind:              otlpSpanKindInternal,
+		StartTimeUnixNano: otlpTime(start),
+		EndTimeUnixNano:   otlpTime(time.Now()),
+		Attributes:        attributes,
+		Status:            otlpSpanStatus{Code: otlpStatusOk},
+	}
+	if err != nil {
+		span.Status = otlpSpanStatus{Code: otlpStatusError, Message: err.Error()}
+	}
+	t.children = append(t.children, span)
+}
+
+// attach adds the httptrace hooks to the request.
+func (t *checkTrace) attach(req *http.Request) *http.Request {
+	if t == nil {
+		return req
+	}
+
+	clientTrace := &httptrace.ClientTrace{
+		DNSStart: func(info httptrace.DNSStartInfo) { t.begin("dns") },
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			t.done("dns", info.Err)
+		},
+		ConnectStart: func(network, addr string) { t.begin("connect " + addr) },
+		ConnectDone: func(network, addr string, err error) {
+			t.done("connect "+addr, err, otlpString("network.peer.address", addr))
+		},
+		TLSHandshakeStart: func() { t.begin("tls") },
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			t.done("tls", err, otlpString("tls.protocol.version", tls.VersionName(state.Version)))
+		},
+		WroteRequest: func(info httptrace.WroteRequestInfo) { t.begin("wait for response") },
+		GotFirstResponseByte: func() {
+			t.done("wait for response", nil)
+		},
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), clientTrace))
+}
+
+// end finishes the root span and hands all spans to the exporter.
+func (t *checkTrace) end(resp *http.Response, err error) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.root.EndTimeUnixNano = otlpTime(time.Now())
+	t.root.Status = otlpSpanStatus{Code: otlpStatusOk}
+	if err != nil {
+		t.root.Status = otlpSpanStatus{Code: otlpStatusError, Message: err.Error()}
+	} else {
+		t.root.Attributes = append(t.root.Attributes, otlpInt("http.response.status_code", int64(resp.StatusCode)))
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			t.root.Status = otlpSpanStatus{Code: otlpStatusError}
+		}
+	}
+
+	tracer.add(append([]otlpSpan{t.root}, t.children...)...)
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// checksumsAsset is the release asset listing the sha256 of every binary in
+// the format of sha256sum, as written by make release.
+const checksumsAsset = "checksums.txt"
+
+type release struct {
+	TagName string         `json:"tag_name"`
+	Assets  []releaseAsset `json:"assets"`
+}
+
+type releaseAsset struct {
+	Name string `json:"name"`
+	Url  string `json:"browser_download_url"`
+}
+
+func (r release) asset(name string) (releaseAsset, bool) {
+	for _, asset := range r.Assets {
+		if asset.Name == name {
+			return asset, true
+		}
+	}
+	return releaseAsset{}, false
+}
+
+type updateArgs struct {
+	repo    string
+	apiUrl  string
+	check   bool
+	force   bool
+	timeout int
+}
+
+func newUpdateFlagSet(a *updateArgs) *flag.FlagSet {
+	fs := flag.NewFlagSet("update", flag.ExitOnError)
+	fs.StringVar(&a.repo, "repo", "johannesjahn/status-checker", "GitHub repository to get releases from (default johannesjahn/status-checker)")
+	fs.StringVar(&a.apiUrl, "api-url", "https://api.github.com", "base url of the GitHub API (default https://api.github.com)")
+	fs.BoolVar(&a.check, "check", false, "only report whether an update is available, exits with 1 if there is one (default false)")
+	fs.BoolVar(&a.force, "force", false, "install the latest release even if it is the running version (default false)")
+	fs.IntVar(&a.timeout, "timeout", 300, "timeout of the whole update in seconds (default 300)")
+	return fs
+}
+
+// runUpdate replaces the running binary with the latest GitHub release after
+// verifying its sha256 against the checksums published with the release.
+func runUpdate(arguments []string) int {
+	var a updateArgs
+	parseFlags(newUpdateFlagSet(&a), arguments)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(a.timeout)*time.Second)
+	defer cancel()
+
+	latest, err := latestRelease(ctx, a.apiUrl, a.repo)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 2
+	}
+
+	latestVersion := strings.TrimPrefix(latest.TagName, "v")
+	if latestVersion == strings.TrimPrefix(version, "v") && !a.force {
+		fmt.Printf("status-checker %s is the latest version\n", version)
+		return 0
+	}
+	if a.check {
+		fmt.Printf("Update available: %s -> %s\n", version, latestVersion)
+		return 1
+	}
+
+	executable, err := os.Executable()
+	if err == nil {
+		executable, err = filepath.EvalSymlinks(executable)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error locating the running binary:", err)
+		return 2
+	}
+
+	if err := installRelease(ctx, latest, executable); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 2
+	}
+	fmt.Printf("Updated %s from %s to %s, restart running instances to use it\n", executable, version, latestVersion)
+	return 0
+}
+
+// binaryAssetName is the name of the release asset for this platform.
+func binaryAssetName() string {
+	name := fmt.Sprintf("status-checker_%s_%s", runtime.GOOS, runtime.GOARCH)
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+func latestRelease(ctx context.Context, apiUrl string, repo string) (release, error) {
+	var latest release
+	url := strings.TrimSuffix(apiUrl, "/") + "/repos/" + repo + "/releases/latest"
+	body, err := download(ctx, url, "application/vnd.github+json")
+	if err != nil {
+		return latest, err
+	}
+	defer body.Close()
+
+	if err := json.NewDecoder(body).Decode(&latest); err != nil {
+		return latest, fmt.Errorf("decoding release: %w", err)
+	}
+	if latest.TagName == "" {
+		return latest, errors.New("release without a tag")
+	}
+	return latest, nil
+}
+
+func download(ctx context.Context, url string, accept string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	req.Header.Set("User-Agent", "status-checker/"+version)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// expectedChecksum returns the sha256 of an asset from the checksums asset of
+// the release.
+func expectedChecksum(ctx context.Context, r release, name string) (string, error) {
+	asset, ok := r.asset(checksumsAsset)
+	if !ok {
+		return "", fmt.Errorf("release %s has no %s, refusing to install an unverified binary", r.TagName, checksumsAsset)
+	}
+	body, err := download(ctx, asset.Url, "application/octet-stream")
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		// sha256sum marks binary mode with a leading *
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("%s lists no checksum for %s", checksumsAsset, name)
+}
+
+// installRelease downloads the binary of the release next to the executable,
+// verifies it and moves it into place.
+func installRelease(ctx context.Context, r release, executable string) error {
+	name := binaryAssetName()
+	asset, ok := r.asset(name)
+	if !ok {
+		return fmt.Errorf("release %s has no binary for %s/%s", r.TagName, runtime.GOOS, runtime.GOARCH)
+	}
+	checksum, err := expectedChecksum(ctx, r, name)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(executable)
+	if err != nil {
+		return err
+	}
+
+	// same directory so the final rename doesn't cross file systems
+	tmp, err := os.CreateTemp(filepath.Dir(executable), ".status-checker-update-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	body, err := download(ctx, asset.Url, "application/octet-stream")
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, hash), body)
+	body.Close()
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("downloading %s: %w", name, err)
+	}
+
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != checksum {
+		return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", name, checksum, actual)
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return err
+	}
+
+	// Windows doesn't allow replacing a running binary but renaming it
+	previous := executable + ".old"
+	os.Remove(previous)
+	if err := os.Rename(executable, previous); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), executable); err != nil {
+		os.Rename(previous, executable)
+		return err
+	}
+	// fails on Windows while the old binary is still running, it is removed
+	// by the next update
+	os.Remove(previous)
+	return nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// uptimeDays is the number of days of uptime kept for the status bars.
+const uptimeDays = 90
+
+const uptimeDayFormat = "2006-01-02"
+
+// uptimeDay counts the checks of an item on one day in UTC.
+type uptimeDay struct {
+	Day     string `json:"day"`
+	Checks  int    `json:"checks"`
+	Healthy int    `json:"healthy"`
+}
+
+var (
+	uptimeMu      sync.Mutex
+	uptimeHistory = make(map[string][]uptimeDay) // oldest day first
+)
+
+// recordUptime counts a check result of item for the day of now and drops
+// days that are too old to be shown.
+func recordUptime(item string, healthy bool, now time.Time) {
+	uptimeMu.Lock()
+	defer uptimeMu.Unlock()
+
+	day := now.UTC().Format(uptimeDayFormat)
+	days := uptimeHistory[item]
+	if len(days) == 0 || days[len(days)-1].Day != day {
+		days = append(days, uptimeDay{Day: day})
+	}
+	days[len(days)-1].Checks++
+	if healthy {
+		days[len(days)-1].Healthy++
+	}
+
+	oldest := now.UTC().AddDate(0, 0, -uptimeDays+1).Format(uptimeDayFormat)
+	for len(days) > 0 && days[0].Day < oldest {
+		days = days[1:]
+	}
+	uptimeHistory[item] = days
+}
+
+// saveUptime writes the uptime history to the data path.
+func saveUptime(dataPath string) error {
+	uptimeMu.Lock()
+	data, err := json.Marshal(uptimeHistory)
+	uptimeMu.Unlock()
+	if err != nil {
+		return err
+	}
+	tmp := dataPath + "uptime.json.tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dataPath+"uptime.json")
+}
+
+// loadUptime reads the uptime history saved by saveUptime, a missing file is
+// not an error.
+func loadUptime(dataPath string) error {
+	data, err := os.ReadFile(dataPath + "uptime.json")
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	uptimeMu.Lock()
+	defer uptimeMu.Unlock()
+	return json.Unmarshal(data, &uptimeHistory)
+}
+
+// uptimeCounts returns the number of checks and healthy checks of item in
+// the last days, at most uptimeDays.
+func uptimeCounts(item string, days int, now time.Time) (checks int, healthy int) {
+	uptimeMu.Lock()
+	defer uptimeMu.Unlock()
+
+	oldest := now.UTC().AddDate(0, 0, -days+1).Format(uptimeDayFormat)
+	for _, day := range uptimeHistory[item] {
+		if day.Day >= oldest {
+			checks += day.Checks
+			healthy += day.Healthy
+		}
+	}
+	return checks, healthy
+}
+
+// uptimeBar is the status of an item on one day, the response of
+// /api/uptime-bars/{target} has one for each of the last uptimeDays days.
+type uptimeBar struct {
+	Day    string   `json:"day"`
+	Status string   `json:"status"` // up, partial, down or no-data
+	Checks int      `json:"checks"`
+	Uptime *float64 `json:"uptime,omitempty"` // share of healthy checks
+}
+
+// uptimeBars returns the bars of item from the oldest to the current day.
+func uptimeBars(item string, now time.Time) []uptimeBar {
+	uptimeMu.Lock()
+	counted := make(map[string]uptimeDay, len(uptimeHistory[item]))
+	for _, day := range uptimeHistory[item] {
+		counted[day.Day] = day
+	}
+	uptimeMu.Unlock()
+
+	bars := make([]uptimeBar, 0, uptimeDays)
+	for i := uptimeDays - 1; i >= 0; i-- {
+		day := now.UTC().AddDate(0, 0, -i).Format(uptimeDayFormat)
+		bar := uptimeBar{Day: day, Status: "no-data"}
+		if c, ok := counted[day]; ok && c.Checks > 0 {
+			uptime := float64(c.Healthy) / float64(c.Checks)
+			bar.Checks = c.Checks
+			bar.Uptime = &uptime
+			switch c.Healthy {
+			case c.Checks:
+				bar.Status = "up"
+			case 0:
+				bar.Status = "down"
+			default:
+				bar.Status = "partial"
+			}
+		}
+		bars = append(bars, bar)
+	}
+	return bars
+}
+
+func handleUptimeBars(w http.ResponseWriter, r *http.Request) {
+	item := r.PathValue("target")
+	stateMu.RLock()
+	_, ok := statusState[item]
+	ok = ok && isPublicIn(item, r.PathValue("namespace"))
+	stateMu.RUnlock()
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown target or composite %q", item), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, uptimeBars(item, time.Now()))
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Monitor states of the UptimeRobot API.
+const (
+	uptimeRobotNotChecked = 1
+	uptimeRobotUp         = 2
+	uptimeRobotDown       = 9
+)
+
+// uptimeRobotMaxLimit is the maximum page size of getMonitors.
+const uptimeRobotMaxLimit = 50
+
+type uptimeRobotMonitor struct {
+	Id                  uint32                    `json:"id"`
+	FriendlyName        string                    `json:"friendly_name"`
+	Url                 string                    `json:"url"`
+	Type                int                       `json:"type"`
+	Interval            int                       `json:"interval"`
+	Status              int                       `json:"status"`
+	CustomUptimeRatio   string                    `json:"custom_uptime_ratio,omitempty"`
+	AllTimeUptimeRatio  string                    `json:"all_time_uptime_ratio,omitempty"`
+	ResponseTimes       []uptimeRobotResponseTime `json:"response_times,omitempty"`
+	AverageResponseTime string                    `json:"average_response_time,omitempty"`
+	Logs                *[]struct{}               `json:"logs,omitempty"`
+}
+
+type uptimeRobotResponseTime struct {
+	Datetime int64 `json:"datetime"`
+	Value    int64 `json:"value"`
+}
+
+type uptimeRobotError struct {
+	Type          string `json:"type"`
+	ParameterName string `json:"parameter_name,omitempty"`
+	PassedValue   string `json:"passed_value,omitempty"`
+	Message       string `json:"message"`
+}
+
+func uptimeRobotFail(w http.ResponseWriter, e uptimeRobotError) {
+	writeJSON(w, http.StatusOK, map[string]any{"stat": "fail", "error": e})
+}
+
+// uptimeRobotId derives a stable monitor id from the target URL.
+func uptimeRobotId(url string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(url))
+	return h.Sum32()
+}
+
+// uptimeRatio returns the percentage of healthy checks of item in the last
+// days, -1 if there were no checks.
+func uptimeRatio(item string, days int, now time.Time) float64 {
+	checks, healthy := uptimeCounts(item, days, now)
+	if checks == 0 {
+		return -1
+	}
+	return 100 * float64(healthy) / float64(checks)
+}
+
+func formatUptimeRatio(ratio float64) string {
+	if ratio < 0 {
+		return "0.000"
+	}
+	return strconv.FormatFloat(ratio, 'f', 3, 64)
+}
+
+// handleUptimeRobotMonitors implements getMonitors of the UptimeRobot API v2
+// for the targets, so apps made for UptimeRobot can be used. The api_key is
+// an API token. Logs aren't kept, so they are always empty.
+func handleUptimeRobotMonitors(tokens []apiToken, interval int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		apiKey := r.FormValue("api_key")
+		if apiKey == "" {
+			// apps may send the key as header like for the other endpoints
+			apiKey = requestToken(r)
+		}
+		if _, ok := findToken(tokens, apiKey); !ok {
+			uptimeRobotFail(w, uptimeRobotError{Type: "invalid_parameter", ParameterName: "api_key", PassedValue: apiKey, Message: "api_key is invalid."})
+			return
+		}
+		if format := r.FormValue("format"); format != "" && format != "json" {
+			uptimeRobotFail(w, uptimeRobotError{Type: "invalid_parameter", ParameterName: "format", PassedValue: format, Message: "only json is supported."})
+			return
+		}
+
+		var ratioDays []int
+		if ratios := r.FormValue("custom_uptime_ratios"); ratios != "" {
+			for _, field := range strings.Split(ratios, "-") {
+				days, err := strconv.Atoi(field)
+				if err != nil || days <= 0 {
+					uptimeRobotFail(w, uptimeRobotError{Type: "invalid_parameter", ParameterName: "custom_uptime_ratios", PassedValue: ratios, Message: "custom_uptime_ratios has to be dash separated days."})
+					return
+				}
+				ratioDays = append(ratioDays, days)
+			}
+		}
+		var ids []uint32
+		if monitors := r.FormValue("monitors"); monitors != "" {
+			for _, field := range strings.Split(monitors, "-") {
+				id, err := strconv.ParseUint(field, 10, 32)
+				if err != nil {
+					uptimeRobotFail(w, uptimeRobotError{Type: "invalid_parameter", ParameterName: "monitors", PassedValue: monitors, Message: "monitors has to be dash separated ids."})
+					return
+				}
+				ids = append(ids, uint32(id))
+			}
+		}
+		offset, _ := strconv.Atoi(r.FormValue("offset"))
+		limit, err := strconv.Atoi(r.FormValue("limit"))
+		if err != nil || limit <= 0 || limit > uptimeRobotMaxLimit {
+			limit = uptimeRobotMaxLimit
+		}
+		offset = max(offset, 0)
+
+		now := time.Now()
+		stateMu.RLock()
+		var monitors []uptimeRobotMonitor
+		for _, target := range config.Targets {
+			id := uptimeRobotId(target.Url)
+			if len(ids) > 0 && !slices.Contains(ids, id) {
+				continue
+			}
+			state := statusState[target.Url]
+			monitor := uptimeRobotMonitor{
+				Id:           id,
+				FriendlyName: target.Name,
+				Url:          target.Url,
+				Type:         1, // HTTP(s)
+				Interval:     interval,
+				Status:       uptimeRobotDown,
+			}
+			if monitor.FriendlyName == "" {
+				monitor.FriendlyName = target.Url
+			}
+			switch {
+			case state.LastHealthy.Unix() <= 0 && state.LastUnhealthy.Unix() <= 0:
+				monitor.Status = uptimeRobotNotChecked
+			case state.Healthy:
+				monitor.Status = uptimeRobotUp
+			}
+			if r.FormValue("response_times") == "1" {
+				// only the latest response time is kept
+				monitor.ResponseTimes = []uptimeRobotResponseTime{{Datetime: now.Unix(), Value: state.ResponseTime.Milliseconds()}}
+			}
+			monitors = append(monitors, monitor)
+		}
+		stateMu.RUnlock()
+
+		total := len(monitors)
+		monitors = monitors[min(offset, total):min(offset+limit, total)]
+		for i := range monitors {
+			url := monitors[i].Url
+			if len(ratioDays) > 0 {
+				ratios := make([]string, 0, len(ratioDays))
+				for _, days := range ratioDays {
+					ratios = append(ratios, formatUptimeRatio(uptimeRatio(url, days, now)))
+				}
+				monitors[i].CustomUptimeRatio = strings.Join(ratios, "-")
+			}
+			if r.FormValue("all_time_uptime_ratio") == "1" {
+				monitors[i].AllTimeUptimeRatio = formatUptimeRatio(uptimeRatio(url, uptimeDays, now))
+			}
+			if r.FormValue("response_times") == "1" {
+				if h, ok := latencySnapshot(url); ok && h.Count > 0 {
+					monitors[i].AverageResponseTime = fmt.Sprintf("%.3f", 1000*h.Sum/float64(h.Count))
+				}
+			}
+			if r.FormValue("logs") == "1" {
+				monitors[i].Logs = &[]struct{}{}
+			}
+		}
+		if monitors == nil {
+			monitors = []uptimeRobotMonitor{}
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{
+			"stat":       "ok",
+			"pagination": map[string]int{"offset": offset, "limit": limit, "total": total},
+			"monitors":   monitors,
+		})
+	}
+}
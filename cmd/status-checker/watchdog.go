@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// watchdogTarget is the name used for notifications about the checker itself.
+const watchdogTarget = "status-checker watchdog"
+
+// watchdog detects checks that run far beyond their deadline and a check loop
+// that stopped ticking.
+type watchdog struct {
+	mu           sync.Mutex
+	interval     time.Duration
+	checkTimeout time.Duration
+	lastTick     time.Time
+	inFlight     map[string]time.Time
+	problems     []string
+}
+
+var checkWatchdog = &watchdog{inFlight: make(map[string]time.Time)}
+
+func (w *watchdog) configure(interval time.Duration, checkTimeout time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.interval = interval
+	w.checkTimeout = checkTimeout
+	w.lastTick = time.Now()
+}
+
+// tick has to be called on every iteration of the check loop.
+func (w *watchdog) tick() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.lastTick = time.Now()
+}
+
+func (w *watchdog) checkStarted(item string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.inFlight[item] = time.Now()
+}
+
+// checkFinished also counts as progress of the check loop, as a round may
+// legitimately take longer than the interval if checks are queued per host.
+func (w *watchdog) checkFinished(item string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.inFlight, item)
+	w.lastTick = time.Now()
+}
+
+// evaluate updates the list of problems and reports whether the watchdog
+// considers the checker healthy.
+func (w *watchdog) evaluate() ([]string, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var problems []string
+	stuckAfter := 3 * w.checkTimeout
+	for item, started := range w.inFlight {
+		if running := time.Since(started); running > stuckAfter {
+			problems = append(problems, fmt.Sprintf("check of %s is running for %s", item, running.Round(time.Second)))
+		}
+	}
+	sort.Strings(problems)
+
+	// a round may take up to one check timeout on top of the interval
+	if sinceTick := time.Since(w.lastTick); sinceTick > w.interval+stuckAfter {
+		problems = append(problems, fmt.Sprintf("check loop has made no progress for %s", sinceTick.Round(time.Second)))
+	}
+
+	w.problems = problems
+	return problems, len(problems) == 0
+}
+
+func (w *watchdog) currentProblems() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.problems
+}
+
+// run periodically evaluates the watchdog, logs problems and notifies when the
+// checker becomes unhealthy or recovers.
+func (w *watchdog) run(gracePeriod time.Duration) {
+	healthy := true
+	for {
+		time.Sleep(time.Second)
+
+		problems, nowHealthy := w.evaluate()
+		for _, problem := range problems {
+			slog.Error("Watchdog detected a problem", "problem", problem)
+		}
+		if nowHealthy != healthy {
+			healthy = nowHealthy
+			notifyStateChanges([]stateChange{{
+				Target:  watchdogTarget,
+				Healthy: healthy,
+				Time:    time.Now(),
+			}}, gracePeriod)
+		}
+	}
+}
+
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	problems := checkWatchdog.currentProblems()
+
+	w.Header().Set("Content-Type", "application/json")
+	status := "ok"
+	if len(problems) > 0 {
+		status = "unhealthy"
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(healthzResponse{status, problems})
+}
+
+type healthzResponse struct {
+	Status   string   `json:"status"`
+	Problems []string `json:"problems,omitempty"`
+}
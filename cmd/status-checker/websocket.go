@@ -0,0 +1,292 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// wsSendBuffer is the number of messages queued for a client, a client
+	// that falls further behind is disconnected.
+	wsSendBuffer = 8
+	// wsReplayRounds is the number of deltas kept for clients resuming
+	// after a disconnect.
+	wsReplayRounds = 30
+	wsWriteTimeout = 10 * time.Second
+	wsCloseTimeout = time.Second
+)
+
+// wsClient is a websocket connection with its queue of messages, only its
+// writer goroutine writes messages to the connection.
+type wsClient struct {
+	conn *websocket.Conn
+	// legacy clients of /ws receive the items of the payload each round as
+	// before the payload object of /v2/ws
+	legacy bool
+	delta  bool // receives deltas instead of the full payload
+	// binary clients negotiated the msgpack subprotocol and receive
+	// MessagePack instead of JSON
+	binary bool
+	// since and stream are the cursor of a resuming client, the seq and
+	// stream of the last message it received
+	since     uint64
+	stream    string
+	namespace string
+	send      chan []byte
+}
+
+// write sends the queued messages until the queue is closed by the hub or a
+// write fails, which closes the connection and ends the read loop.
+func (c *wsClient) write() {
+	messageType := websocket.TextMessage
+	if c.binary {
+		messageType = websocket.BinaryMessage
+	}
+	for message := range c.send {
+		c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		if err := c.conn.WriteMessage(messageType, message); err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return // closed by the hub
+			}
+			websocketLog.Warn("Error writing to websocket", "remote", c.conn.RemoteAddr(), "error", err)
+			c.conn.Close()
+			return
+		}
+	}
+}
+
+// close sends a close message and closes the connection, it may be called
+// while the writer goroutine is blocked.
+func (c *wsClient) close(code int, text string) {
+	message := websocket.FormatCloseMessage(code, text)
+	c.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(wsCloseTimeout))
+	c.conn.Close()
+}
+
+// message returns the payload for c, as MessagePack for binary clients.
+func (e encodedPayload) message(c *wsClient) ([]byte, error) {
+	switch {
+	case c.binary && c.legacy:
+		return msgpackMarshal(e.payload.Items)
+	case c.binary:
+		return msgpackMarshal(e.payload)
+	case c.legacy:
+		return e.items, nil
+	}
+	return e.full, nil
+}
+
+// wsBroadcast is the encoded payload of a round, delta is nil if it couldn't
+// be computed and delta clients get the full payload. deltaPayload is kept
+// for binary clients.
+type wsBroadcast struct {
+	seq          uint64
+	encoded      encodedPayload
+	delta        []byte
+	deltaPayload statusDelta
+	// packed are the messages for binary clients, encoded when the first one
+	// needs them
+	packed *wsPacked
+}
+
+// wsPacked are the MessagePack messages of a broadcast, a message that can't
+// be encoded is nil.
+type wsPacked struct {
+	full  []byte
+	items []byte
+	delta []byte
+}
+
+// messages returns the full payload, the items and the delta of the round in
+// the encoding of c.
+func (b *wsBroadcast) messages(c *wsClient) (full []byte, items []byte, delta []byte) {
+	if !c.binary {
+		return b.encoded.full, b.encoded.items, b.delta
+	}
+	if b.packed == nil {
+		b.packed = &wsPacked{}
+		var err error
+		if b.packed.full, err = msgpackMarshal(b.encoded.payload); err != nil {
+			websocketLog.Error("Error encoding the status as MessagePack", "error", err)
+		}
+		if b.packed.items, err = msgpackMarshal(b.encoded.payload.Items); err != nil {
+			websocketLog.Error("Error encoding the status items as MessagePack", "error", err)
+		}
+		if b.delta != nil {
+			if b.packed.delta, err = msgpackMarshal(b.deltaPayload); err != nil {
+				websocketLog.Error("Error encoding the status delta as MessagePack", "error", err)
+			}
+		}
+	}
+	return b.packed.full, b.packed.items, b.packed.delta
+}
+
+// wsHub owns the connected clients, a broadcast never blocks on a client so
+// a stalled browser can't delay the check loop or the other clients.
+type wsHub struct {
+	register   chan *wsClient
+	unregister chan *wsClient
+	broadcast  chan map[string]*wsBroadcast // by namespace
+	shutdown   chan chan struct{}
+
+	clients atomic.Int64
+	dropped atomic.Int64 // clients disconnected for being too slow
+}
+
+var hub = &wsHub{
+	register:   make(chan *wsClient),
+	unregister: make(chan *wsClient),
+	broadcast:  make(chan map[string]*wsBroadcast),
+	shutdown:   make(chan chan struct{}),
+}
+
+// missed returns the deltas a resuming client missed since its cursor, ok is
+// false if they are no longer all kept and it has to start with the full
+// payload.
+func missed(replay []*wsBroadcast, c *wsClient) (deltas []*wsBroadcast, ok bool) {
+	if !c.delta || c.since == 0 || c.stream != wsStream || len(replay) == 0 {
+		return nil, false
+	}
+	if c.since+1 < replay[0].seq || c.since > replay[len(replay)-1].seq {
+		return nil, false
+	}
+	for _, b := range replay {
+		if b.seq > c.since {
+			deltas = append(deltas, b)
+		}
+	}
+	return deltas, true
+}
+
+// replayed returns the messages of the deltas a resuming client missed, ok is
+// false if it has to start with the full payload as one of them can't be
+// encoded for it.
+func replayed(replay []*wsBroadcast, c *wsClient) (messages [][]byte, ok bool) {
+	deltas, ok := missed(replay, c)
+	if !ok {
+		return nil, false
+	}
+	for _, b := range deltas {
+		_, _, delta := b.messages(c)
+		if delta == nil {
+			return nil, false
+		}
+		messages = append(messages, delta)
+	}
+	return messages, true
+}
+
+func (h *wsHub) run() {
+	clients := make(map[*wsClient]bool)
+	remove := func(c *wsClient) {
+		delete(clients, c)
+		close(c.send)
+	}
+	// replay are the deltas of the last rounds by namespace for resuming
+	// clients
+	replay := make(map[string][]*wsBroadcast)
+	for {
+		select {
+		case c := <-h.register:
+			// the first messages are queued by the hub so a broadcast can't
+			// get between them and the following deltas
+			if deltas, ok := replayed(replay[c.namespace], c); ok {
+				for _, delta := range deltas {
+					c.send <- delta
+				}
+				clients[c] = true
+				break
+			}
+			encoded, err := encodedStatus(c.namespace)
+			var message []byte
+			if err == nil {
+				message, err = encoded.message(c)
+			}
+			if err != nil {
+				websocketLog.Error("Error encoding the status", "error", err)
+				close(c.send)
+				go c.close(websocket.CloseInternalServerErr, "error encoding the status")
+				continue
+			}
+			c.send <- message
+			clients[c] = true
+		case c := <-h.unregister:
+			if clients[c] {
+				remove(c)
+			}
+		case broadcasts := <-h.broadcast:
+			for namespace, b := range broadcasts {
+				kept := replay[namespace]
+				if b.delta == nil {
+					// the deltas before can't be combined with the next ones
+					kept = nil
+				} else {
+					if len(kept) == wsReplayRounds {
+						kept[0] = nil
+						kept = kept[1:]
+					}
+					kept = append(kept, b)
+				}
+				replay[namespace] = kept
+			}
+			for namespace := range replay {
+				if _, ok := broadcasts[namespace]; !ok {
+					delete(replay, namespace)
+				}
+			}
+			for c := range clients {
+				b, ok := broadcasts[c.namespace]
+				if !ok {
+					continue // removed by a config reload
+				}
+				full, items, delta := b.messages(c)
+				message := full
+				switch {
+				case c.legacy:
+					message = items
+				case c.delta && delta != nil:
+					message = delta
+				}
+				if message == nil {
+					continue
+				}
+				// the queue has room for a replay, a client is only slow if
+				// it has more than wsSendBuffer messages queued
+				if len(c.send) >= wsSendBuffer {
+					websocketLog.Warn("Disconnecting slow websocket client", "remote", c.conn.RemoteAddr())
+					h.dropped.Add(1)
+					remove(c)
+					go c.close(websocket.CloseTryAgainLater, "client too slow")
+					continue
+				}
+				c.send <- message
+			}
+		case done := <-h.shutdown:
+			var wg sync.WaitGroup
+			for c := range clients {
+				remove(c)
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					c.close(websocket.CloseGoingAway, "server shutting down")
+				}()
+			}
+			wg.Wait()
+			close(done)
+		}
+		h.clients.Store(int64(len(clients)))
+	}
+}
+
+// closeAll tells all clients that the server is going away and waits until
+// the close messages are sent.
+func (h *wsHub) closeAll() {
+	done := make(chan struct{})
+	h.shutdown <- done
+	<-done
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+// replayRounds returns the broadcasts of the rounds from seq first to last.
+func replayRounds(first, last uint64) []*wsBroadcast {
+	var replay []*wsBroadcast
+	for seq := first; seq <= last; seq++ {
+		delta := statusDelta{Delta: true, Stream: wsStream, Seq: seq, Items: []map[string]json.RawMessage{}, Removed: []string{}}
+		encoded, _ := json.Marshal(delta)
+		replay = append(replay, &wsBroadcast{seq: seq, delta: encoded, deltaPayload: delta})
+	}
+	return replay
+}
+
+func TestMissed(t *testing.T) {
+	replay := replayRounds(5, 8)
+	tests := []struct {
+		name   string
+		client wsClient
+		replay []*wsBroadcast
+		seqs   []uint64
+		ok     bool
+	}{
+		{"full payloads", wsClient{since: 6, stream: wsStream}, replay, nil, false},
+		{"new client", wsClient{delta: true, stream: wsStream}, replay, nil, false},
+		{"other stream", wsClient{delta: true, since: 6, stream: "restarted"}, replay, nil, false},
+		{"nothing kept", wsClient{delta: true, since: 6, stream: wsStream}, nil, nil, false},
+		{"too old", wsClient{delta: true, since: 3, stream: wsStream}, replay, nil, false},
+		{"from the oldest", wsClient{delta: true, since: 4, stream: wsStream}, replay, []uint64{5, 6, 7, 8}, true},
+		{"some", wsClient{delta: true, since: 6, stream: wsStream}, replay, []uint64{7, 8}, true},
+		{"up to date", wsClient{delta: true, since: 8, stream: wsStream}, replay, nil, true},
+		{"ahead", wsClient{delta: true, since: 9, stream: wsStream}, replay, nil, false},
+	}
+	for _, test := range tests {
+		deltas, ok := missed(test.replay, &test.client)
+		var seqs []uint64
+		for _, b := range deltas {
+			seqs = append(seqs, b.seq)
+		}
+		if ok != test.ok || !slices.Equal(seqs, test.seqs) {
+			t.Errorf("%s: missed = %v, %t, want %v, %t", test.name, seqs, ok, test.seqs, test.ok)
+		}
+	}
+}
+
+func TestReplayed(t *testing.T) {
+	replay := replayRounds(5, 8)
+	client := &wsClient{delta: true, since: 6, stream: wsStream}
+	messages, ok := replayed(replay, client)
+	if !ok || len(messages) != 2 || !bytes.Equal(messages[0], replay[2].delta) {
+		t.Fatalf("replayed = %q, %t, want the deltas 7 and 8", messages, ok)
+	}
+
+	binary := &wsClient{delta: true, binary: true, since: 6, stream: wsStream}
+	messages, ok = replayed(replay, binary)
+	want, err := msgpackMarshal(replay[3].deltaPayload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok || len(messages) != 2 || !bytes.Equal(messages[1], want) {
+		t.Fatalf("replayed for a binary client = % x, %t, want the deltas 7 and 8 as MessagePack", messages, ok)
+	}
+
+	// a delta that can't be encoded for the client means starting over
+	broken := replayRounds(5, 8)
+	broken[3].deltaPayload.Items = []map[string]json.RawMessage{{"url": json.RawMessage(`{`)}}
+	if messages, ok := replayed(broken, binary); ok {
+		t.Errorf("replayed with a delta that can't be encoded = % x, want the full payload", messages)
+	}
+	if _, ok := replayed(broken, client); !ok {
+		t.Errorf("JSON clients can't replay the deltas encoded for them")
+	}
+}
+
+func TestPageOriginCheck(t *testing.T) {
+	tests := []struct {
+		publicUrl string
+		host      string
+		origin    string
+		allowed   bool
+	}{
+		{"", "status.example.com", "", true},
+		{"", "status.example.com", "https://status.example.com", true},
+		{"", "status.example.com", "https://Status.Example.com", true},
+		{"", "status.example.com:8080", "http://status.example.com:8080", true},
+		{"", "status.example.com:8080", "http://status.example.com", false},
+		{"", "status.example.com", "https://evil.example.com", false},
+		{"", "status.example.com", "null", false},
+		{"https://status.example.com/", "127.0.0.1:8080", "https://status.example.com", true},
+		{"https://status.example.com/", "127.0.0.1:8080", "https://evil.example.com", false},
+		{"not a url", "status.example.com", "https://evil.example.com", false},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+		r.Host = test.host
+		if test.origin != "" {
+			r.Header.Set("Origin", test.origin)
+		}
+		if allowed := pageOriginCheck(test.publicUrl)(r); allowed != test.allowed {
+			t.Errorf("origin %q for host %q and public url %q allowed = %t, want %t", test.origin, test.host, test.publicUrl, allowed, test.allowed)
+		}
+	}
+}
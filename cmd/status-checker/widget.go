@@ -0,0 +1,28 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// The widget is embedded in the binary as the static files are only the
+// page itself.
+var (
+	//go:embed widget.html
+	widgetHTML []byte
+	//go:embed widget.js
+	widgetScript []byte
+)
+
+// handleWidget serves the widget, which can be embedded into other sites as
+// iframe of /widget or with a script tag loading /widget.js.
+func handleWidget(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(widgetHTML)
+}
+
+func handleWidgetScript(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+	w.Header().Set("Cache-Control", "max-age=3600")
+	w.Write(widgetScript)
+}
@@ -0,0 +1,12 @@
+// Embeds the status widget as iframe in place of the script tag:
+// <script src="https://status.example.com/widget.js" data-width="320" data-height="120"></script>
+(function () {
+  const script = document.currentScript;
+  const iframe = document.createElement("iframe");
+  iframe.src = new URL("/widget", script.src).href;
+  iframe.title = "Status";
+  iframe.width = script.dataset.width ?? "320";
+  iframe.height = script.dataset.height ?? "120";
+  iframe.style.border = "0";
+  script.after(iframe);
+})();
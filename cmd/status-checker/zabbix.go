@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultZabbixKeyPrefix = "status_checker"
+	zabbixTimeout          = 10 * time.Second
+	// zabbixMaxResponse limits the response read, it is a short JSON object.
+	zabbixMaxResponse = 1 << 16
+)
+
+// Zabbix sends the state, response time and response code of every item to
+// a Zabbix server with the sender protocol after each check round. The items
+// have to exist as trapper items with the keys <keyPrefix>.up[<item>],
+// <keyPrefix>.response_time[<item>] and <keyPrefix>.response_code[<item>].
+type Zabbix struct {
+	// Server is host:port of the server or proxy, the port is 10051 if
+	// missing.
+	Server string `json:"server"`
+	// Host is the Zabbix host of the items, Hosts overrides it for some
+	// target URLs or composite names.
+	Host      string            `json:"host"`
+	Hosts     map[string]string `json:"hosts,omitempty"`
+	KeyPrefix string            `json:"keyPrefix,omitempty"` // defaultZabbixKeyPrefix if not set
+}
+
+var zabbixKeyPrefixPattern = regexp.MustCompile(`^[0-9A-Za-z_.-]+$`)
+
+func (z Zabbix) validate() error {
+	if z.Server == "" || z.Host == "" {
+		return fmt.Errorf("zabbix requires a server and a host")
+	}
+	if z.KeyPrefix != "" && !zabbixKeyPrefixPattern.MatchString(z.KeyPrefix) {
+		return fmt.Errorf("zabbix keyPrefix %q may only contain letters, digits, _, . and -", z.KeyPrefix)
+	}
+	return nil
+}
+
+// zabbixKeyParameter quotes an item for a key parameter, quotes inside it
+// are escaped.
+func zabbixKeyParameter(item string) string {
+	return `"` + strings.ReplaceAll(item, `"`, `\"`) + `"`
+}
+
+type zabbixValue struct {
+	Host  string `json:"host"`
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	Clock int64  `json:"clock"`
+}
+
+// zabbixHeader starts every message, followed by the data length as 64 bit
+// little endian.
+var zabbixHeader = []byte("ZBXD\x01")
+
+func zabbixMessage(data []byte) []byte {
+	message := append([]byte(nil), zabbixHeader...)
+	message = binary.LittleEndian.AppendUint64(message, uint64(len(data)))
+	return append(message, data...)
+}
+
+type zabbixSender struct {
+	zabbix Zabbix
+	busy   atomic.Bool
+}
+
+// zabbix is nil if it isn't configured.
+var zabbix *zabbixSender
+
+func setupZabbix() {
+	if config.Zabbix != nil {
+		zabbix = &zabbixSender{zabbix: *config.Zabbix}
+	}
+}
+
+func (s *zabbixSender) values(views []StatusView, now time.Time) []zabbixValue {
+	prefix := s.zabbix.KeyPrefix
+	if prefix == "" {
+		prefix = defaultZabbixKeyPrefix
+	}
+	var values []zabbixValue
+	for _, view := range views {
+		host := s.zabbix.Host
+		if mapped, ok := s.zabbix.Hosts[view.Url]; ok {
+			host = mapped
+		}
+		parameter := "[" + zabbixKeyParameter(view.Url) + "]"
+		values = append(values,
+			zabbixValue{Host: host, Key: prefix + ".up" + parameter, Value: fmt.Sprint(boolMetricValue(view.Healthy)), Clock: now.Unix()},
+			zabbixValue{Host: host, Key: prefix + ".response_time" + parameter, Value: fmt.Sprint(view.ResponseTime), Clock: now.Unix()},
+			zabbixValue{Host: host, Key: prefix + ".response_code" + parameter, Value: fmt.Sprint(view.ResponseCode), Clock: now.Unix()},
+		)
+	}
+	return values
+}
+
+// emit sends the views in the background, the round is skipped if the
+// previous one is still being sent.
+func (s *zabbixSender) emit(views []StatusView) {
+	if !s.busy.CompareAndSwap(false, true) {
+		slog.Warn("Skipping Zabbix values, the previous round is still being sent")
+		return
+	}
+	values := s.values(views, time.Now())
+	go func() {
+		defer s.busy.Store(false)
+		if err := s.send(values); err != nil {
+			slog.Warn("Error sending values to Zabbix", "server", s.zabbix.Server, "error", err)
+		}
+	}()
+}
+
+func (s *zabbixSender) send(values []zabbixValue) error {
+	now := time.Now()
+	data, err := json.Marshal(map[string]any{"request": "sender data", "data": values, "clock": now.Unix()})
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.DialTimeout("tcp", hostWithDefaultPort(s.zabbix.Server, "10051"), zabbixTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(now.Add(zabbixTimeout))
+	if _, err := conn.Write(zabbixMessage(data)); err != nil {
+		return err
+	}
+
+	var header [13]byte
+	if _, err := io.ReadFull(conn, header[:]); err != nil {
+		return fmt.Errorf("reading response: %w", err)
+	}
+	if !bytes.Equal(header[:5], zabbixHeader) {
+		return fmt.Errorf("unexpected response header %q", header[:5])
+	}
+	length := binary.LittleEndian.Uint64(header[5:])
+	if length > zabbixMaxResponse {
+		return fmt.Errorf("response of %d bytes is too long", length)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(conn, body); err != nil {
+		return fmt.Errorf("reading response: %w", err)
+	}
+
+	var response struct {
+		Response string `json:"response"`
+		Info     string `json:"info"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return fmt.Errorf("parsing response: %w", err)
+	}
+	if response.Response != "success" {
+		return fmt.Errorf("server responded %s: %s", response.Response, response.Info)
+	}
+	// e.g. "processed: 3; failed: 0; total: 3; seconds spent: 0.000055"
+	if !strings.Contains(response.Info, "failed: 0;") {
+		return fmt.Errorf("not all values were accepted, check that the trapper items exist: %s", response.Info)
+	}
+	return nil
+}